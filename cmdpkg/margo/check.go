@@ -0,0 +1,24 @@
+package margo
+
+import (
+	"fmt"
+	"github.com/urfave/cli"
+	"margo.sh/sublime"
+)
+
+var checkCmd = cli.Command{
+	Name:  "check",
+	Usage: "Check files or packages with the reducers of your margo extension, without an editor",
+	Description: "build " + sublime.AgentName + " with your margo extension, and use it to check files or packages without an editor, " +
+		"so the issues are the same as those reported in the editor. See `" + sublime.AgentName + " check --help` for the flags",
+	ArgsUsage:       "[--format=text|json|checkstyle] [files or package patterns...] (default '.')",
+	SkipFlagParsing: true,
+	SkipArgReorder:  true,
+	Action: func(cx *cli.Context) error {
+		mc := cmdMap[sublime.AgentName]
+		if err := mc.Build.Run(agentCtx(cx, mc, nil)); err != nil {
+			return fmt.Errorf("%s build failed: %s", mc.Name, err)
+		}
+		return mc.Run.Run(agentCtx(cx, mc, append([]string{"check"}, cx.Args()...)))
+	},
+}
@@ -0,0 +1,24 @@
+package margo
+
+import (
+	"fmt"
+	"github.com/urfave/cli"
+	"margo.sh/sublime"
+)
+
+var fmtCmd = cli.Command{
+	Name:  "fmt",
+	Usage: "Format files with the fmt reducers of your margo extension, without an editor",
+	Description: "build " + sublime.AgentName + " with your margo extension, and use it to format files without an editor, " +
+		"so the formatting is the same as in the editor e.g. in pre-commit hooks. See `" + sublime.AgentName + " fmt --help` for the flags",
+	ArgsUsage:       "[-l] [-d] [-w] [files...] (default stdin)",
+	SkipFlagParsing: true,
+	SkipArgReorder:  true,
+	Action: func(cx *cli.Context) error {
+		mc := cmdMap[sublime.AgentName]
+		if err := mc.Build.Run(agentCtx(cx, mc, nil)); err != nil {
+			return fmt.Errorf("%s build failed: %s", mc.Name, err)
+		}
+		return mc.Run.Run(agentCtx(cx, mc, append([]string{"fmt"}, cx.Args()...)))
+	},
+}
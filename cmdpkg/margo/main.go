@@ -65,6 +65,9 @@ func Main() {
 		startCmd,
 		devCmd,
 		ciCmd,
+		replayCmd,
+		checkCmd,
+		fmtCmd,
 	}
 	app.RunAndExitOnError()
 }
@@ -78,23 +81,25 @@ func appendSubCmd(cmd *cli.Command, cmds mgcli.Commands, subCmd cli.Command) {
 
 func startAction(cx *cli.Context) error {
 	mc := cmdMap[cx.Command.Name]
-	app := &mgcli.NewApp().App
-	app.Name = mc.Name
-	newCtx := func(args []string) *cli.Context {
-		flags := flag.NewFlagSet(mc.Name, 0)
-		flags.Usage = func() {}
-		flags.Parse(append([]string{mc.Name}, args...))
-		return cli.NewContext(app, flags, cx)
-	}
 	if mc.Build != nil {
-		err := mc.Build.Run(newCtx(nil))
+		err := mc.Build.Run(agentCtx(cx, mc, nil))
 		if err != nil {
 			e := fmt.Sprintf("%s build failed: %s", mc.Name, err)
 			os.Setenv("MARGO_BUILD_ERROR", e)
 		}
 	}
 	if mc.Run != nil {
-		return mc.Run.Run(newCtx(cx.Args()))
+		return mc.Run.Run(agentCtx(cx, mc, cx.Args()))
 	}
 	return nil
 }
+
+// agentCtx returns a new context for running the agent's Build and Run commands with args
+func agentCtx(cx *cli.Context, mc mgcli.Commands, args []string) *cli.Context {
+	app := &mgcli.NewApp().App
+	app.Name = mc.Name
+	flags := flag.NewFlagSet(mc.Name, 0)
+	flags.Usage = func() {}
+	flags.Parse(append([]string{mc.Name}, args...))
+	return cli.NewContext(app, flags, cx)
+}
@@ -0,0 +1,24 @@
+package margo
+
+import (
+	"fmt"
+	"github.com/urfave/cli"
+	"margo.sh/sublime"
+)
+
+var replayCmd = cli.Command{
+	Name:  "replay",
+	Usage: "Replay a recorded session with the reducers of your margo extension",
+	Description: "build " + sublime.AgentName + " with your margo extension, and use it to replay a session recorded by an agent started with `--record=file`, " +
+		"printing the differences between the recorded and replayed states. See `" + sublime.AgentName + " replay --help` for the flags",
+	ArgsUsage:       "[--ignore=field...] [--default] <file>",
+	SkipFlagParsing: true,
+	SkipArgReorder:  true,
+	Action: func(cx *cli.Context) error {
+		mc := cmdMap[sublime.AgentName]
+		if err := mc.Build.Run(agentCtx(cx, mc, nil)); err != nil {
+			return fmt.Errorf("%s build failed: %s", mc.Name, err)
+		}
+		return mc.Run.Run(agentCtx(cx, mc, append([]string{"replay"}, cx.Args()...)))
+	},
+}
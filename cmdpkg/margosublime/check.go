@@ -0,0 +1,214 @@
+package margosublime
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/urfave/cli"
+	"io"
+	"margo.sh/mg"
+	"margo.sh/sublime"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	checkFormats = map[string]func(io.Writer, mg.IssueSet) error{
+		"text":       checkText,
+		"json":       checkJSON,
+		"checkstyle": checkCheckstyle,
+	}
+
+	checkCmd = cli.Command{
+		Name:        "check",
+		Usage:       "Check files or packages without an editor",
+		Description: "check files or packages with the agent's reducers, and print the issues they report. It exits with status 1 if there are errors",
+		ArgsUsage:   "[files or package patterns...] (default '.')",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "format",
+				Value: "text",
+				Usage: "The output format: text (compiler-style), json or checkstyle",
+			},
+			cli.DurationFlag{
+				Name:  "timeout",
+				Value: time.Minute,
+				Usage: "The maximum time to wait for the checks of each file",
+			},
+			cli.BoolFlag{
+				Name:  "log",
+				Usage: "Show the agent's logs",
+			},
+		},
+		Action: checkAction,
+	}
+)
+
+func checkAction(cx *cli.Context) error {
+	format := checkFormats[cx.String("format")]
+	if format == nil {
+		return fmt.Errorf("Invalid format '%s'. Expected text, json or checkstyle", cx.String("format"))
+	}
+	args := []string(cx.Args())
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+	files, err := checkFiles(args)
+	if err != nil {
+		return err
+	}
+
+	cfg := mg.CheckConfig{
+		Files:   files,
+		Margo:   headlessMargo,
+		Timeout: cx.Duration("timeout"),
+	}
+	if cx.Bool("log") {
+		cfg.Stderr = os.Stderr
+	}
+	issues, err := mg.Check(cfg)
+	if err != nil {
+		return err
+	}
+
+	wd, _ := os.Getwd()
+	for i, isu := range issues {
+		if fn, err := filepath.Rel(wd, isu.Path); err == nil && !strings.HasPrefix(fn, "..") {
+			issues[i].Path = fn
+		}
+	}
+	if err := format(os.Stdout, issues); err != nil {
+		return err
+	}
+	for _, isu := range issues {
+		if isu.Tag == mg.Error {
+			return cli.NewExitError("", 1)
+		}
+	}
+	return nil
+}
+
+// headlessMargo sets up the agents used by the commands that run without an editor, like the editor's agent
+func headlessMargo(ma mg.Args) {
+	ma.Store.SetBaseConfig(sublime.DefaultConfig)
+	if margoExt != nil {
+		margoExt(ma)
+	}
+}
+
+// checkFiles returns the list of files in args.
+// Args that aren't files are package patterns, expanded with `go list`, to their Go files, including tests.
+func checkFiles(args []string) ([]string, error) {
+	var files, pats []string
+	for _, s := range args {
+		if fi, err := os.Stat(s); err == nil && fi.Mode().IsRegular() {
+			files = append(files, s)
+		} else {
+			pats = append(pats, s)
+		}
+	}
+	if len(pats) == 0 {
+		return files, nil
+	}
+
+	tpl := `{{.Dir}}{{range .GoFiles}}{{"\t"}}{{.}}{{end}}{{range .CgoFiles}}{{"\t"}}{{.}}{{end}}` +
+		`{{range .TestGoFiles}}{{"\t"}}{{.}}{{end}}{{range .XTestGoFiles}}{{"\t"}}{{.}}{{end}}`
+	cmd := exec.Command("go", append([]string{"list", "-e", "-f", tpl}, pats...)...)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go list: %s\n%s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	for _, ln := range strings.Split(string(out), "\n") {
+		l := strings.Split(ln, "\t")
+		for _, fn := range l[1:] {
+			files = append(files, filepath.Join(l[0], fn))
+		}
+	}
+	return files, nil
+}
+
+func checkText(w io.Writer, issues mg.IssueSet) error {
+	for _, isu := range issues {
+		if _, err := fmt.Fprintln(w, isu.Error()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkJSON(w io.Writer, issues mg.IssueSet) error {
+	type Issue struct {
+		Path    string
+		Line    int
+		Column  int
+		Tag     mg.IssueTag
+		Label   string
+		Message string
+	}
+	l := make([]Issue, len(issues))
+	for i, isu := range issues {
+		l[i] = Issue{
+			Path:    isu.Path,
+			Line:    isu.Row + 1,
+			Column:  isu.Col + 1,
+			Tag:     isu.Tag,
+			Label:   isu.Label,
+			Message: isu.Message,
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(l)
+}
+
+func checkCheckstyle(w io.Writer, issues mg.IssueSet) error {
+	type Error struct {
+		Line     int    `xml:"line,attr"`
+		Column   int    `xml:"column,attr"`
+		Severity string `xml:"severity,attr"`
+		Message  string `xml:"message,attr"`
+		Source   string `xml:"source,attr,omitempty"`
+	}
+	type File struct {
+		Name   string  `xml:"name,attr"`
+		Errors []Error `xml:"error"`
+	}
+	doc := struct {
+		XMLName xml.Name `xml:"checkstyle"`
+		Version string   `xml:"version,attr"`
+		Files   []File   `xml:"file"`
+	}{Version: "5.0"}
+	for _, isu := range issues {
+		if n := len(doc.Files); n == 0 || doc.Files[n-1].Name != isu.Path {
+			doc.Files = append(doc.Files, File{Name: isu.Path})
+		}
+		f := &doc.Files[len(doc.Files)-1]
+		severity := string(isu.Tag)
+		if isu.Tag == mg.Notice {
+			severity = "info"
+		}
+		f.Errors = append(f.Errors, Error{
+			Line:     isu.Row + 1,
+			Column:   isu.Col + 1,
+			Severity: severity,
+			Message:  isu.Message,
+			Source:   isu.Label,
+		})
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,129 @@
+package margosublime
+
+import (
+	"fmt"
+	"github.com/urfave/cli"
+	"io/ioutil"
+	"margo.sh/mg"
+	"margo.sh/mgutil"
+	"os"
+	"time"
+)
+
+var fmtCmd = cli.Command{
+	Name:  "fmt",
+	Usage: "Format files with the agent's fmt reducers, without an editor",
+	Description: "format files with the agent's fmt reducers, as if they were formatted in the editor. " +
+		"If no files are given, the src is read from stdin. " +
+		"By default, the formatted src is printed to stdout. It exits with status 1 if a file can't be formatted",
+	ArgsUsage: "[files...]",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "l",
+			Usage: "List the files whose formatting differs from the formatted src",
+		},
+		cli.BoolFlag{
+			Name:  "d",
+			Usage: "Print the diffs between the files and the formatted src",
+		},
+		cli.BoolFlag{
+			Name:  "w",
+			Usage: "Write the formatted src back to the files, if it differs",
+		},
+		cli.StringFlag{
+			Name:  "stdin-path",
+			Value: "stdin.go",
+			Usage: "The `path` of the src read from stdin. Its language selects the fmt reducers that run",
+		},
+		cli.DurationFlag{
+			Name:  "timeout",
+			Value: time.Minute,
+			Usage: "The maximum time to wait for each file to be formatted",
+		},
+		cli.BoolFlag{
+			Name:  "log",
+			Usage: "Show the agent's logs",
+		},
+	},
+	Action: fmtAction,
+}
+
+func fmtAction(cx *cli.Context) error {
+	var files []mg.FmtFile
+	stdin := !cx.Args().Present()
+	if stdin {
+		if cx.Bool("w") {
+			return fmt.Errorf("cannot use -w with stdin")
+		}
+		src, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		files = append(files, mg.FmtFile{Path: cx.String("stdin-path"), Src: src})
+	} else {
+		for _, fn := range cx.Args() {
+			files = append(files, mg.FmtFile{Path: fn})
+		}
+	}
+
+	cfg := mg.FmtConfig{
+		Margo:   headlessMargo,
+		Timeout: cx.Duration("timeout"),
+	}
+	if cx.Bool("log") {
+		cfg.Stderr = os.Stderr
+	}
+	results, err := mg.Fmt(cfg, files...)
+	if err != nil {
+		return err
+	}
+
+	failed := false
+	for _, res := range results {
+		name := res.Path
+		if stdin {
+			name = "<standard input>"
+		}
+		if res.Error != nil {
+			failed = true
+			fmt.Fprintf(os.Stderr, "%s: %s\n", name, res.Error)
+			continue
+		}
+		if err := fmtResult(cx, name, res); err != nil {
+			failed = true
+			fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+		}
+	}
+	if failed {
+		return cli.NewExitError("", 1)
+	}
+	return nil
+}
+
+// fmtResult outputs res according to the -l, -d and -w flags
+func fmtResult(cx *cli.Context, name string, res mg.FmtResult) error {
+	l, d, w := cx.Bool("l"), cx.Bool("d"), cx.Bool("w")
+	if !l && !d && !w {
+		_, err := os.Stdout.Write(res.Fmt)
+		return err
+	}
+	if !res.Changed() {
+		return nil
+	}
+	if l {
+		fmt.Println(name)
+	}
+	if w {
+		fi, err := os.Stat(res.Path)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(res.Path, res.Fmt, fi.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	if d {
+		os.Stdout.Write(mgutil.UnifiedDiff("a/"+name, "b/"+name, res.Src, res.Fmt))
+	}
+	return nil
+}
@@ -3,9 +3,14 @@ package margosublime
 import (
 	"fmt"
 	"github.com/urfave/cli"
+	"io"
 	"margo.sh/mg"
 	"margo.sh/mgcli"
 	"margo.sh/sublime"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 var (
@@ -22,11 +27,40 @@ func Main() {
 			Destination: &agentConfig.Codec,
 			Usage:       fmt.Sprintf("The IPC codec: %s (default %s)", mg.CodecNamesStr, mg.DefaultCodec),
 		},
+		cli.StringFlag{
+			Name:        "protocol",
+			Value:       agentConfig.Protocol,
+			Destination: &agentConfig.Protocol,
+			Usage:       fmt.Sprintf("The IPC protocol: margo or %s (default margo)", mg.LSPProtocol),
+		},
+		cli.StringFlag{
+			Name:        "record",
+			Value:       agentConfig.Record,
+			Destination: &agentConfig.Record,
+			EnvVar:      "MARGO_RECORD",
+			Usage:       "Record the session in `file`, for margo.sh replay. The recording includes the src of views and the editor's environment, with credentials redacted",
+		},
+		cli.StringSliceFlag{
+			Name:  "listen",
+			Usage: "Run as a daemon that serves multiple clients on the Unix domain socket `addr`: unix:path. It's only accessible by the current user. It may be repeated",
+		},
+		cli.StringFlag{
+			Name:  "connect",
+			Usage: "Connect stdin and stdout to the daemon listening on `addr`, instead of running an agent",
+		},
+	}
+	app.Commands = []cli.Command{
+		checkCmd,
+		fmtCmd,
+		replayCmd,
 	}
 	app.Action = func(ctx *cli.Context) error {
 		if ctx.Args().Present() {
 			return cli.ShowAppHelp(ctx)
 		}
+		if addr := ctx.String("connect"); addr != "" {
+			return mgcli.Error("connect failed", connect(addr))
+		}
 
 		ag, err := mg.NewAgent(agentConfig)
 		if err != nil {
@@ -38,6 +72,9 @@ func Main() {
 			margoExt(ag.Args())
 		}
 
+		if addrs := ctx.StringSlice("listen"); len(addrs) != 0 {
+			return mgcli.Error("daemon failed", serve(ag, addrs))
+		}
 		if err := ag.Run(); err != nil {
 			return mgcli.Error("agent failed:", err)
 		}
@@ -45,3 +82,57 @@ func Main() {
 	}
 	app.RunAndExitOnError()
 }
+
+// serve runs ag as a daemon listening on addrs, until it's interrupted
+func serve(ag *mg.Agent, addrs []string) error {
+	var ls []net.Listener
+	for _, addr := range addrs {
+		ln, err := mg.Listen(addr)
+		if err != nil {
+			for _, ln := range ls {
+				ln.Close()
+			}
+			return err
+		}
+		ls = append(ls, ln)
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	stopped := make(chan struct{})
+	go func() {
+		<-sigs
+		close(stopped)
+		for _, ln := range ls {
+			ln.Close()
+		}
+	}()
+
+	err := ag.Serve(ls...)
+	select {
+	case <-stopped:
+		return nil
+	default:
+		return err
+	}
+}
+
+// connect copies stdin to the daemon listening on addr, and its responses to stdout
+func connect(addr string) error {
+	conn, err := mg.Dial(addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	go func() {
+		io.Copy(conn, os.Stdin)
+		if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+			cw.CloseWrite()
+		} else {
+			conn.Close()
+		}
+	}()
+	_, err = io.Copy(os.Stdout, conn)
+	return err
+}
@@ -0,0 +1,71 @@
+package margosublime
+
+import (
+	"fmt"
+	"github.com/urfave/cli"
+	"margo.sh/mg"
+	"os"
+	"time"
+)
+
+var replayCmd = cli.Command{
+	Name:        "replay",
+	Usage:       "Replay a recorded session",
+	Description: "replay a session recorded by an agent started with `--record=file` with the agent's reducers, and print the differences between the recorded and replayed states. It exits with status 1 if there are differences",
+	ArgsUsage:   "<file>",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "default",
+			Usage: "Replay the session with mg.DefaultReducers only, instead of the agent's reducers",
+		},
+		cli.StringSliceFlag{
+			Name:  "ignore",
+			Usage: "A State field to exclude from the comparison e.g. Status. It may be repeated",
+		},
+		cli.DurationFlag{
+			Name:  "timeout",
+			Value: time.Minute,
+			Usage: "The maximum time to wait for the response to each request",
+		},
+		cli.BoolFlag{
+			Name:  "log",
+			Usage: "Show the agent's logs",
+		},
+	},
+	Action: replayAction,
+}
+
+func replayAction(cx *cli.Context) error {
+	args := cx.Args()
+	if len(args) != 1 {
+		return fmt.Errorf("Please specify the recording file")
+	}
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	cfg := mg.ReplayConfig{
+		Recording: f,
+		Margo:     headlessMargo,
+		Ignore:    cx.StringSlice("ignore"),
+		Output:    os.Stdout,
+		Timeout:   cx.Duration("timeout"),
+	}
+	if cx.Bool("default") {
+		cfg.Margo = nil
+	}
+	if cx.Bool("log") {
+		cfg.Stderr = os.Stderr
+	}
+	res, err := mg.Replay(cfg)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "replayed %d requests: %d differ, %d have no recorded response\n", res.Requests, res.Diffs, res.Missing)
+	if res.Diffs != 0 {
+		return cli.NewExitError("", 1)
+	}
+	return nil
+}
@@ -11,6 +11,18 @@ func Margo(m mg.Args) {
 	// See the documentation for `mg.Reducer`
 	// comments beginning with `gs:` denote features that replace old GoSublime settings
 
+	// the watchdog is disabled by default.
+	// When enabled, it reports reducers that take longer than their budget
+	// to handle an action, in the HUD and the logs.
+	// Budgets overrides the budget of slow reducers, like fmt'ers that run external commands.
+	// DisableAfter disables reducers that repeatedly exceed it,
+	// until they're re-enabled with the command `.reducer.enable`
+	// m.SetWatchdogConfig(mg.WatchdogConfig{
+	// 	Budget:       250 * time.Millisecond,
+	// 	Budgets:      map[string]time.Duration{"mg.Reduce(margo.sh/golang.goImports)": 2 * time.Second},
+	// 	DisableAfter: 3,
+	// })
+
 	// add our reducers (margo plugins) to the store
 	// they are run in the specified order
 	// and should ideally not block for more than a couple milliseconds
@@ -40,6 +52,18 @@ func Margo(m mg.Args) {
 			// Interval: 3600e9, // automatically fetch updates every hour
 		},
 
+		// VFSWatcher watches the directories that were scanned for changes made outside the editor
+		// e.g. by `git checkout`, so that cached packages, etc. are not stale.
+		// On Linux it uses inotify, on other platforms (or if Poll is set) the directories are polled.
+		// &mg.VFSWatcher{Poll: false},
+
+		// VFSTrim configures how much data is kept in the VFS cache.
+		// Trimming is enabled by default: every minute, the least-recently-used files and cached packages
+		// that have been unused for 5 minutes are removed until at most 200,000 files and 20,000 packages, etc. remain.
+		// If memory usage gets close to the limit, the cache is trimmed to half its size.
+		// Use `.vfs-trim` to trim it manually, and NoAutoTrim to disable the periodic trimming.
+		// &mg.VFSTrim{MaxNodes: 200000, MaxMemos: 20000, MinIdle: 5 * time.Minute, NoAutoTrim: false},
+
 		mg.NewReducer(func(mx *mg.Ctx) *mg.State {
 			// By default, events (e.g. ViewSaved) are triggered in all files.
 			// Replace `mg.AllLangs` with `mg.Go` to restrict events to Go(-lang) files.
@@ -115,6 +139,18 @@ func Margo(m mg.Args) {
 		// gs: this replaces the `calltips` setting
 		&golang.GocodeCalltips{},
 
+		// set State.SignatureHelp to the type-checked signature of the function being called,
+		// including the active parameter and doc comment, so editors can show it in a popup
+		// &golang.SignatureHelp{},
+
+		// set State.Outline to the types, funcs, vars and consts declared in the current file
+		// so editors can show it in a side panel, and add UserCmds that go to each of them
+		// &golang.Outline{},
+
+		// set State.SemanticTokens to the kinds of the identifiers in the current file
+		// so editors can highlight e.g. locals, params and fields differently, and mark unused or deprecated names
+		// &golang.SemanticTokens{},
+
 		// use guru for goto-definition
 		// new commands `goto.definition` and `guru.definition` are defined
 		// gs: by default `goto.definition` is bound to ctrl+.,ctrl+g or cmd+.,cmd+g
@@ -128,6 +164,10 @@ func Margo(m mg.Args) {
 		// gs: this replaces the `snippets` setting
 		MySnippets,
 
+		// load snippets from JSON files in the `.margo/snippets` directory of the project
+		// they're reloaded when changed, so they can be shared in the repo without rebuilding margo
+		// &golang.SnippetFiles{Dirs: []string{".margo/snippets"}},
+
 		// check the file for syntax errors
 		// gs: this and other linters e.g. below,
 		//     replaces the settings `gslint_enabled`, `lint_filter`, `comp_lint_enabled`,
@@ -142,11 +182,25 @@ func Margo(m mg.Args) {
 
 			// additional args to add to the command when running benchmarks
 			BenchArgs: []string{"-benchmem"},
+
+			// run tests with `go test -json`, reporting failed tests as issues
+			// and summarising the results in the HUD
+			JSON: false,
 		},
 
+		// Coverage adds the UserCmd `Go Coverage` that reports code not covered by tests as issues
+		// and the coverage of each function in the HUD.
+		// set OnSave to update the coverage when a file is saved
+		// &golang.Coverage{OnSave: false},
+
 		// GoGenerate adds a UserCmd that calls `go generate` in go packages and sub-dirs
 		&golang.GoGenerate{Args: []string{"-v", "-x"}},
 
+		// GoMod adds the commands `go.mod.require`, `go.mod.replace` and `go.mod.tidy`
+		// (and UserCmds for them) that edit the go.mod file of the current module.
+		// go.mod files are also checked for errors when they're changed.
+		// &golang.GoMod{},
+
 		// run `go install -i` on save
 		// golang.GoInstall("-i"),
 		// or
@@ -0,0 +1,404 @@
+package golang
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"golang.org/x/crypto/blake2b"
+	"io"
+	"margo.sh/htm"
+	"margo.sh/mg"
+	"margo.sh/mgutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// coverLabel is the label of issues reported for blocks not covered by tests
+	coverLabel = "Go/Coverage"
+
+	// maxCoverHUD is the maximum number of functions listed in the HUD
+	maxCoverHUD = 30
+)
+
+// Coverage reports the test coverage of the package of the active view.
+//
+// Blocks of code that are not covered by tests are reported as Notice issues,
+// and the HUD lists the coverage of each function in the active view.
+// Coverage is updated using the UserCmd `Go Coverage` or, if OnSave is set, when a view is saved.
+//
+// Results are cached per package and only updated when its source files change.
+type Coverage struct {
+	mg.ReducerType
+
+	// OnSave if true, coverage is updated when a view is saved
+	OnSave bool
+
+	// Args is a list of extra arguments to pass to `go test`
+	Args []string
+
+	q     *mgutil.ChanQ
+	mu    sync.Mutex
+	cache map[string]*coverReport
+}
+
+// coverBlock is a block in a cover profile
+type coverBlock struct {
+	StartLine, StartCol int
+	EndLine, EndCol     int
+	NumStmt, Count      int
+}
+
+// coverFunc is the coverage of a function
+type coverFunc struct {
+	Name    string
+	Pos     token.Position
+	Stmts   int
+	Covered int
+}
+
+func (cf coverFunc) percent() float64 {
+	return coverPercent(cf.Covered, cf.Stmts)
+}
+
+// coverReport is the coverage of a package
+type coverReport struct {
+	// Key identifies the state of the package's source when the tests were run
+	Key string
+	Dir string
+	// Blocks is a map of filename to the file's blocks
+	Blocks map[string][]coverBlock
+	// Funcs is a map of filename to the coverage of the file's functions
+	Funcs   map[string][]coverFunc
+	Stmts   int
+	Covered int
+}
+
+func (cr *coverReport) percent() float64 {
+	return coverPercent(cr.Covered, cr.Stmts)
+}
+
+func (cr *coverReport) issues() mg.IssueSet {
+	issues := mg.IssueSet{}
+	for fn, blocks := range cr.Blocks {
+		for _, b := range blocks {
+			if b.Count != 0 || b.NumStmt == 0 {
+				continue
+			}
+			msg := "not covered by tests"
+			if b.EndLine > b.StartLine {
+				msg = fmt.Sprintf("lines %d-%d are not covered by tests", b.StartLine, b.EndLine)
+			}
+			issues = append(issues, mg.Issue{
+				Path:    fn,
+				Row:     b.StartLine - 1,
+				Col:     b.StartCol - 1,
+				Tag:     mg.Notice,
+				Label:   coverLabel,
+				Message: msg,
+			})
+		}
+	}
+	return issues
+}
+
+func coverPercent(covered, stmts int) float64 {
+	if stmts == 0 {
+		return 0
+	}
+	return 100 * float64(covered) / float64(stmts)
+}
+
+func (cv *Coverage) RCond(mx *mg.Ctx) bool {
+	return mx.LangIs(mg.Go)
+}
+
+func (cv *Coverage) RMount(mx *mg.Ctx) {
+	cv.cache = map[string]*coverReport{}
+	cv.q = mgutil.NewChanQ(1)
+	go cv.loop()
+}
+
+func (cv *Coverage) RUnmount(mx *mg.Ctx) {
+	cv.q.Close()
+}
+
+func (cv *Coverage) Reduce(mx *mg.Ctx) *mg.State {
+	st := mx.State
+	switch mx.Action.(type) {
+	case mg.ViewSaved:
+		if cv.OnSave {
+			cv.q.Put(mx)
+		}
+	case mg.QueryUserCmds:
+		st = st.AddUserCmds(
+			mg.UserCmd{
+				Title: "Go Coverage",
+				Name:  "golang.coverage",
+				Desc:  "Run the package's tests and report the blocks of code not covered by them",
+			},
+			mg.UserCmd{
+				Title: "Go Coverage: Clear",
+				Name:  "golang.coverage",
+				Desc:  "Clear the coverage issues and HUD",
+				Args:  []string{"-clear"},
+			},
+		)
+	case mg.RunCmd:
+		st = st.AddBuiltinCmds(mg.BuiltinCmd{
+			Name: "golang.coverage",
+			Desc: "Report the test coverage of the current package. Usage: golang.coverage [-f] [-clear]",
+			Run:  cv.runBuiltin,
+		})
+	}
+	return cv.addHUD(mx, st)
+}
+
+func (cv *Coverage) addHUD(mx *mg.Ctx, st *mg.State) *mg.State {
+	v := mx.View
+	cv.mu.Lock()
+	cr := cv.cache[v.Dir()]
+	cv.mu.Unlock()
+	if cr == nil {
+		return st
+	}
+
+	funcs := cr.Funcs[v.Filename()]
+	els := make([]htm.Element, 0, len(funcs))
+	for i, f := range funcs {
+		if i >= maxCoverHUD {
+			els = append(els, htm.Textf("... %d more functions", len(funcs)-i))
+			break
+		}
+		act := mg.Activate{Path: f.Pos.Filename, Row: f.Pos.Line - 1, Col: f.Pos.Column - 1}
+		els = append(els, htm.A(&htm.AAttrs{Action: act}, htm.Textf("%5.1f%% %s", f.percent(), f.Name)))
+	}
+	return st.AddHUD(htm.Textf("Coverage ( %.1f%% of statements )", cr.percent()), els...)
+}
+
+func (cv *Coverage) loop() {
+	for v := range cv.q.C() {
+		mx := v.(*mg.Ctx)
+		cx := &mg.CmdCtx{
+			Ctx:    mx,
+			RunCmd: mg.RunCmd{Name: "golang.coverage"},
+			Output: &mgutil.IOWrapper{},
+		}
+		if _, _, err := cv.coverage(cx, false); err != nil {
+			mx.Log.Println("golang.coverage:", err)
+		}
+	}
+}
+
+func (cv *Coverage) runBuiltin(cx *mg.CmdCtx) *mg.State {
+	go cv.runCmd(cx)
+	return cx.State
+}
+
+func (cv *Coverage) runCmd(cx *mg.CmdCtx) {
+	defer cx.Output.Close()
+
+	fs := cx.Flags()
+	force := fs.Bool("f", false, "Run the tests even if the package didn't change since the last run")
+	clear := fs.Bool("clear", false, "Clear the coverage issues and HUD")
+	if err := fs.Parse(); err != nil {
+		fmt.Fprintln(cx.Output, "golang.coverage:", err)
+		return
+	}
+
+	if *clear {
+		cv.clear(cx.Ctx)
+		return
+	}
+
+	cr, cached, err := cv.coverage(cx, *force)
+	if err != nil {
+		fmt.Fprintln(cx.Output, "golang.coverage:", err)
+		return
+	}
+	sfx := ""
+	if cached {
+		sfx = " (cached)"
+	}
+	fmt.Fprintf(cx.Output, "golang.coverage: %.1f%% of statements%s\n", cr.percent(), sfx)
+}
+
+func (cv *Coverage) clear(mx *mg.Ctx) {
+	dir := mx.View.Dir()
+	cv.mu.Lock()
+	delete(cv.cache, dir)
+	cv.mu.Unlock()
+	mx.Store.Dispatch(mg.StoreIssues{IssueKey: cv.issueKey(dir)})
+}
+
+func (cv *Coverage) issueKey(dir string) mg.IssueKey {
+	type Key struct{}
+	return mg.IssueKey{Key: Key{}, Dir: dir}
+}
+
+// coverage returns the coverage of the package in the view's directory.
+// The tests are only run if its source changed since the last run, or force is true.
+func (cv *Coverage) coverage(cx *mg.CmdCtx, force bool) (cr *coverReport, cached bool, err error) {
+	v := cx.View
+	dir := v.Dir()
+	key := cv.srcKey(cx.Ctx, dir)
+
+	cv.mu.Lock()
+	cr = cv.cache[dir]
+	cv.mu.Unlock()
+	if !force && cr != nil && cr.Key == key {
+		return cr, true, nil
+	}
+
+	tDir, err := mg.MkTempDir("golang.coverage")
+	if err != nil {
+		return nil, false, fmt.Errorf("cannot MkTempDir: %s", err)
+	}
+	defer os.RemoveAll(tDir)
+	profile := filepath.Join(tDir, "cover.out")
+
+	// the output is shared with the caller, so it must not be closed
+	cx = cx.Copy(func(cx *mg.CmdCtx) {
+		out := cx.Output
+		cx.Output = &mgutil.IOWrapper{Writer: out, Flusher: out}
+	})
+	gx := newGoCmdCtx(&GoCmd{}, cx, coverLabel, "golang.coverage`"+dir+"`", "", "", v, true)
+	gx.Args = append([]string{"test", "-coverprofile=" + profile}, cv.Args...)
+	runErr := gx.run(v)
+	gx.Output.Close()
+
+	f, err := os.Open(profile)
+	if err != nil {
+		if runErr != nil {
+			return nil, false, runErr
+		}
+		return nil, false, err
+	}
+	defer f.Close()
+
+	cr = &coverReport{Key: key, Dir: dir, Funcs: map[string][]coverFunc{}}
+	cr.Blocks, err = parseCoverProfile(f, dir)
+	if err != nil {
+		return nil, false, err
+	}
+	for fn, blocks := range cr.Blocks {
+		for _, b := range blocks {
+			cr.Stmts += b.NumStmt
+			if b.Count != 0 {
+				cr.Covered += b.NumStmt
+			}
+		}
+		pf := ParseFile(cx.Ctx, fn, nil)
+		cr.Funcs[fn] = coverFuncs(pf.Fset, pf.AstFile, blocks)
+	}
+
+	cv.mu.Lock()
+	cv.cache[dir] = cr
+	cv.mu.Unlock()
+	cx.Store.Dispatch(mg.StoreIssues{IssueKey: cv.issueKey(dir), Issues: cr.issues()})
+	return cr, false, nil
+}
+
+// srcKey returns a hash of the Go files in dir
+func (cv *Coverage) srcKey(mx *mg.Ctx, dir string) string {
+	b2, _ := blake2b.New256(nil)
+	fmt.Fprintln(b2, cv.Args)
+	for _, nd := range mx.VFS.Poke(dir).Ls().Filter(symbolsNdFilter).Sorted().Nodes() {
+		src, _ := nd.ReadBlob().ReadFile()
+		fmt.Fprintln(b2, nd.Name(), len(src))
+		b2.Write(src)
+	}
+	return hex.EncodeToString(b2.Sum(nil))
+}
+
+// parseCoverProfile parses the cover profile generated by `go test -coverprofile` for the package in dir.
+// It returns a map of filename to the file's blocks, sorted by position.
+func parseCoverProfile(r io.Reader, dir string) (map[string][]coverBlock, error) {
+	files := map[string][]coverBlock{}
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		ln := strings.TrimSpace(sc.Text())
+		if ln == "" || strings.HasPrefix(ln, "mode:") {
+			continue
+		}
+		// name.go:line.column,line.column numberOfStatements count
+		i := strings.LastIndexByte(ln, ':')
+		if i < 0 {
+			return nil, fmt.Errorf("invalid cover profile line `%s`", ln)
+		}
+		b := coverBlock{}
+		_, err := fmt.Sscanf(ln[i+1:], "%d.%d,%d.%d %d %d",
+			&b.StartLine, &b.StartCol, &b.EndLine, &b.EndCol, &b.NumStmt, &b.Count)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cover profile line `%s`: %s", ln, err)
+		}
+		fn := filepath.Join(dir, path.Base(ln[:i]))
+		files[fn] = append(files[fn], b)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	for fn, l := range files {
+		sort.Slice(l, func(i, j int) bool {
+			p, q := l[i], l[j]
+			if p.StartLine != q.StartLine {
+				return p.StartLine < q.StartLine
+			}
+			return p.StartCol < q.StartCol
+		})
+		// merge duplicate blocks e.g. from profiles of multiple test binaries
+		x := l[:0]
+		for _, b := range l {
+			if n := len(x); n != 0 && x[n-1].StartLine == b.StartLine && x[n-1].StartCol == b.StartCol &&
+				x[n-1].EndLine == b.EndLine && x[n-1].EndCol == b.EndCol {
+				x[n-1].Count += b.Count
+				continue
+			}
+			x = append(x, b)
+		}
+		files[fn] = x
+	}
+	return files, nil
+}
+
+// coverFuncs returns the coverage of the functions in af, in source order
+func coverFuncs(fset *token.FileSet, af *ast.File, blocks []coverBlock) []coverFunc {
+	funcs := []coverFunc{}
+	for _, d := range af.Decls {
+		fd, ok := d.(*ast.FuncDecl)
+		if !ok || fd.Body == nil {
+			continue
+		}
+		start, end := fset.Position(fd.Pos()), fset.Position(fd.End())
+		cf := coverFunc{Name: fd.Name.Name, Pos: fset.Position(fd.Name.Pos())}
+		if fd.Recv != nil && len(fd.Recv.List) != 0 {
+			cf.Name = symbolsRecvName(fd.Recv.List[0].Type) + "." + cf.Name
+		}
+		for _, b := range blocks {
+			if !coverPosBefore(start.Line, start.Column, b.StartLine, b.StartCol) ||
+				!coverPosBefore(b.EndLine, b.EndCol, end.Line, end.Column) {
+				continue
+			}
+			cf.Stmts += b.NumStmt
+			if b.Count != 0 {
+				cf.Covered += b.NumStmt
+			}
+		}
+		if cf.Stmts != 0 {
+			funcs = append(funcs, cf)
+		}
+	}
+	return funcs
+}
+
+// coverPosBefore reports whether line:col a is at or before line:col b
+func coverPosBefore(aLine, aCol, bLine, bCol int) bool {
+	return aLine < bLine || (aLine == bLine && aCol <= bCol)
+}
@@ -0,0 +1,66 @@
+package golang
+
+import (
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+func TestCoverProfile(t *testing.T) {
+	src := `package cov
+
+type T struct{}
+
+func (t *T) Abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func Unused() int {
+	y := 1
+	return y
+}
+`
+	profile := `mode: set
+example.com/cov/c.go:6.2,6.11 1 1
+example.com/cov/c.go:7.3,8.1 1 0
+example.com/cov/c.go:9.2,9.10 1 1
+example.com/cov/c.go:13.2,15.1 2 0
+`
+	files, err := parseCoverProfile(strings.NewReader(profile), "/src/cov")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := files["/src/cov/c.go"]
+	if len(files) != 1 || len(blocks) != 4 {
+		t.Fatalf("expected 4 blocks in /src/cov/c.go, got %v", files)
+	}
+	if b := blocks[1]; b.StartLine != 7 || b.StartCol != 3 || b.EndLine != 8 || b.EndCol != 1 || b.NumStmt != 1 || b.Count != 0 {
+		t.Errorf("unexpected block %+v", b)
+	}
+
+	fset := token.NewFileSet()
+	af, err := parser.ParseFile(fset, "/src/cov/c.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	funcs := coverFuncs(fset, af, blocks)
+	expect := []struct {
+		name    string
+		percent float64
+	}{
+		{"T.Abs", 100 * 2.0 / 3.0},
+		{"Unused", 0},
+	}
+	if len(funcs) != len(expect) {
+		t.Fatalf("expected %d funcs, got %v", len(expect), funcs)
+	}
+	for i, e := range expect {
+		if f := funcs[i]; f.Name != e.name || f.percent() != e.percent {
+			t.Errorf("expected %s %.1f%%, got %s %.1f%%", e.name, e.percent, f.Name, f.percent())
+		}
+	}
+}
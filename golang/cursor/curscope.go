@@ -1,6 +1,7 @@
 package cursor
 
 import (
+	"fmt"
 	"sort"
 	"strings"
 )
@@ -75,3 +76,23 @@ func (cs CurScope) Is(scopes ...CurScope) bool {
 	}
 	return false
 }
+
+// ParseCurScope parses a list of scope names separated by `|` e.g. `BlockScope|ExprScope`
+func ParseCurScope(s string) (CurScope, error) {
+	cs := CurScope(0)
+	for _, nm := range strings.Split(s, "|") {
+		nm = strings.TrimSpace(nm)
+		found := false
+		for scope, name := range scopeNames {
+			if name == nm {
+				cs |= scope
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown cursor scope `%s`", nm)
+		}
+	}
+	return cs, nil
+}
@@ -0,0 +1,350 @@
+package golang
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"margo.sh/golang/cursor"
+	"margo.sh/mg"
+	"margo.sh/mgutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+func init() {
+	mg.DefaultReducers.Before(&genTestCmd{})
+}
+
+// genTestCmd implements the `golang.gentest` builtin command.
+//
+// It generates a table-driven test for the function or method whose name is under the cursor.
+// The test is appended to the corresponding _test.go file, which is created if necessary.
+// If the flag `-x` is set, new test files are created in the external `_test` package.
+type genTestCmd struct{ mg.ReducerType }
+
+// genTest holds the details of the test being generated
+type genTest struct {
+	Fn       string
+	Src      []byte
+	PkgName  string
+	External bool
+	Name     string
+
+	pkg    *types.Package
+	pkgImp impSpec
+	imps   impSpecList
+}
+
+func (gc *genTestCmd) RCond(mx *mg.Ctx) bool {
+	return mx.LangIs(mg.Go)
+}
+
+func (gc *genTestCmd) Reduce(mx *mg.Ctx) *mg.State {
+	switch mx.Action.(type) {
+	case mg.QueryUserCmds:
+		return mx.AddUserCmds(
+			mg.UserCmd{
+				Title: "Generate Test",
+				Name:  "golang.gentest",
+				Desc:  "Generate a table-driven test for the selected function or method",
+			},
+			mg.UserCmd{
+				Title: "Generate Test (external package)",
+				Name:  "golang.gentest",
+				Desc:  "Generate a table-driven test for the selected function or method in the external _test package",
+				Args:  []string{"-x"},
+			},
+		)
+	case mg.RunCmd:
+		return mx.AddBuiltinCmds(mg.BuiltinCmd{
+			Name: "golang.gentest",
+			Desc: "Generate a table-driven test for the selected function or method. Usage: golang.gentest [-x]",
+			Run:  gc.run,
+		})
+	}
+	return mx.State
+}
+
+func (gc *genTestCmd) run(cx *mg.CmdCtx) *mg.State {
+	go gc.gen(cx)
+	return cx.State
+}
+
+func (gc *genTestCmd) gen(cx *mg.CmdCtx) {
+	defer cx.Output.Close()
+
+	fs := cx.Flags()
+	external := fs.Bool("x", false, "Create new test files in the external _test package")
+	if err := fs.Parse(); err != nil {
+		fmt.Fprintln(cx.Output, "golang.gentest:", err)
+		return
+	}
+
+	gt, pos, err := gc.genTest(cx.Ctx, *external)
+	if err != nil {
+		fmt.Fprintln(cx.Output, "golang.gentest:", err)
+		return
+	}
+	if err := gc.writeFile(cx.Ctx, gt); err != nil {
+		fmt.Fprintln(cx.Output, "golang.gentest:", err)
+		return
+	}
+	fmt.Fprintf(cx.Output, "golang.gentest: added %s to %s\n", gt.Name, mgutil.ShortFn(gt.Fn, cx.Env))
+	cx.Store.Dispatch(mg.Activate{Path: gt.Fn, Row: pos.Line - 1})
+}
+
+func (gc *genTestCmd) writeFile(mx *mg.Ctx, gt *genTest) error {
+	defer mx.VFS.Invalidate(gt.Fn)
+
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(gt.Fn); err == nil {
+		mode = fi.Mode()
+	}
+	return ioutil.WriteFile(gt.Fn, gt.Src, mode)
+}
+
+// genTest returns the updated test file, and the position of the new test in it
+func (gc *genTestCmd) genTest(mx *mg.Ctx, external bool) (*genTest, token.Position, error) {
+	v := mx.View
+	cx := cursor.NewViewCurCtx(mx)
+	name, _ := cx.FuncDeclName()
+	switch {
+	case name == "":
+		return nil, token.Position{}, fmt.Errorf("the cursor must be on the name of a function or method declaration")
+	case cx.IsTestFile:
+		return nil, token.Position{}, fmt.Errorf("cannot generate tests for functions in test files")
+	case v.Path == "":
+		return nil, token.Position{}, fmt.Errorf("the file must be saved first")
+	}
+
+	ti, err := typChkR.info(mx)
+	if err != nil {
+		return nil, token.Position{}, err
+	}
+	fun, ok := ti.Obj.(*types.Func)
+	if !ok {
+		return nil, token.Position{}, fmt.Errorf("%s is not a function", ti.Obj.Name())
+	}
+	sig := fun.Type().(*types.Signature)
+	if sig.TypeParams().Len() != 0 || sig.RecvTypeParams().Len() != 0 {
+		return nil, token.Position{}, fmt.Errorf("cannot generate tests for generic functions: %s has type parameters", fun.Name())
+	}
+
+	gt := &genTest{
+		Fn:       strings.TrimSuffix(v.Filename(), ".go") + "_test.go",
+		PkgName:  fun.Pkg().Name(),
+		External: external,
+		pkg:      fun.Pkg(),
+	}
+	// the test file is never the active view, so it can't be updated through a view edit
+	if mx.ViewIsDirty(gt.Fn) {
+		return nil, token.Position{}, fmt.Errorf("%s has unsaved changes, save it first", filepath.Base(gt.Fn))
+	}
+	gt.Src, err = ioutil.ReadFile(gt.Fn)
+	switch {
+	case err == nil:
+		af, err := parser.ParseFile(token.NewFileSet(), gt.Fn, gt.Src, parser.PackageClauseOnly)
+		if err != nil {
+			return nil, token.Position{}, err
+		}
+		gt.PkgName = af.Name.Name
+		gt.External = strings.HasSuffix(gt.PkgName, "_test")
+	case os.IsNotExist(err):
+		if gt.External {
+			gt.PkgName += "_test"
+		}
+		gt.Src = []byte("package " + gt.PkgName + "\n")
+	default:
+		return nil, token.Position{}, err
+	}
+
+	recvName := ""
+	if recv := sig.Recv(); recv != nil {
+		recvName = genTestRecvName(recv.Type())
+	}
+	if gt.External && (!fun.Exported() || (recvName != "" && !ast.IsExported(recvName))) {
+		return nil, token.Position{}, fmt.Errorf("%s is not exported, it cannot be tested from package %s", fun.Name(), gt.PkgName)
+	}
+	gt.Name = "Test" + genTestTitle(fun.Name())
+	if recvName != "" {
+		gt.Name = "Test" + genTestTitle(recvName) + "_" + fun.Name()
+	}
+	if bytes.Contains(gt.Src, []byte("func "+gt.Name+"(")) {
+		return nil, token.Position{}, fmt.Errorf("%s already exists in %s", gt.Name, filepath.Base(gt.Fn))
+	}
+
+	if gt.External {
+		ipath := projectImportPath(mx, v.Dir())
+		if ipath == "" || ipath == "." {
+			ipath = tcUnvendorPath(fun.Pkg().Path())
+		}
+		gt.pkgImp = impSpec{Path: ipath}
+	}
+	code := gt.funcSrc(fun, sig)
+
+	src := append(bytes.TrimRight(gt.Src, "\n"), "\n\n"...)
+	src = append(src, code...)
+	src, _, err = append(impSpecList{{Path: "testing"}}, gt.imps...).mergeWithSrc(gt.Fn, src)
+	if err != nil {
+		return nil, token.Position{}, err
+	}
+	fmtSrc, err := format.Source(src)
+	if err != nil {
+		return nil, token.Position{}, fmt.Errorf("cannot format the generated test: %s", err)
+	}
+	gt.Src = fmtSrc
+
+	pos := token.Position{Filename: gt.Fn, Line: 1}
+	if i := bytes.Index(gt.Src, []byte("func "+gt.Name+"(")); i >= 0 {
+		pos.Line = bytes.Count(gt.Src[:i], []byte{'\n'}) + 1
+	}
+	return gt, pos, nil
+}
+
+// genTestRecvName returns the name of the receiver type t e.g. `T` for `*T`
+func genTestRecvName(t types.Type) string {
+	if p, ok := t.(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	if n, ok := t.(*types.Named); ok {
+		return n.Obj().Name()
+	}
+	return ""
+}
+
+// genTestTitle returns s with its first letter in upper case
+func genTestTitle(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[n:]
+}
+
+// qualifier qualifies types with the package name, and records the import
+func (gt *genTest) qualifier(p *types.Package) string {
+	if p == gt.pkg && !gt.External {
+		return ""
+	}
+	imp := impSpec{Path: tcUnvendorPath(p.Path())}
+	if p == gt.pkg {
+		imp = gt.pkgImp
+	}
+	if !gt.imps.contains(imp) {
+		gt.imps = append(gt.imps, imp)
+	}
+	return p.Name()
+}
+
+func (gt *genTest) typeString(t types.Type) string {
+	return types.TypeString(t, gt.qualifier)
+}
+
+// funcSrc returns the source of the test function for fun
+func (gt *genTest) funcSrc(fun *types.Func, sig *types.Signature) []byte {
+	type field struct{ name, typ string }
+
+	params := []field{}
+	args := []string{}
+	for i := 0; i < sig.Params().Len(); i++ {
+		p := sig.Params().At(i)
+		nm := p.Name()
+		if nm == "" || nm == "_" {
+			nm = fmt.Sprintf("arg%d", i)
+		}
+		params = append(params, field{nm, gt.typeString(p.Type())})
+		arg := "tt.args." + nm
+		if sig.Variadic() && i == sig.Params().Len()-1 {
+			arg += "..."
+		}
+		args = append(args, arg)
+	}
+
+	results := []field{}
+	hasErr := false
+	for i := 0; i < sig.Results().Len(); i++ {
+		r := sig.Results().At(i)
+		if i == sig.Results().Len()-1 && types.Identical(r.Type(), types.Universe.Lookup("error").Type()) {
+			hasErr = true
+			break
+		}
+		sfx := ""
+		if len(results) != 0 {
+			sfx = fmt.Sprint(len(results))
+		}
+		results = append(results, field{sfx, gt.typeString(r.Type())})
+	}
+	if imp := (impSpec{Path: "reflect"}); len(results) != 0 && !gt.imps.contains(imp) {
+		gt.imps = append(gt.imps, imp)
+	}
+
+	call := fun.Name() + "(" + strings.Join(args, ", ") + ")"
+	switch recv := sig.Recv(); {
+	case recv != nil:
+		call = "tt.recv." + call
+	case gt.External:
+		call = gt.qualifier(gt.pkg) + "." + call
+	}
+	dispName := fun.Name()
+	if recv := sig.Recv(); recv != nil {
+		dispName = genTestRecvName(recv.Type()) + "." + dispName
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "func %s(t *testing.T) {\n", gt.Name)
+	if len(params) != 0 {
+		fmt.Fprintf(buf, "type args struct {\n")
+		for _, p := range params {
+			fmt.Fprintf(buf, "%s %s\n", p.name, p.typ)
+		}
+		fmt.Fprintf(buf, "}\n")
+	}
+	fmt.Fprintf(buf, "tests := []struct {\nname string\n")
+	if recv := sig.Recv(); recv != nil {
+		fmt.Fprintf(buf, "recv %s\n", gt.typeString(recv.Type()))
+	}
+	if len(params) != 0 {
+		fmt.Fprintf(buf, "args args\n")
+	}
+	for _, r := range results {
+		fmt.Fprintf(buf, "want%s %s\n", r.name, r.typ)
+	}
+	if hasErr {
+		fmt.Fprintf(buf, "wantErr bool\n")
+	}
+	fmt.Fprintf(buf, "}{\n// TODO: add test cases\n}\n")
+	fmt.Fprintf(buf, "for _, tt := range tests {\nt.Run(tt.name, func(t *testing.T) {\n")
+
+	lhs := []string{}
+	for _, r := range results {
+		lhs = append(lhs, "got"+r.name)
+	}
+	if hasErr {
+		lhs = append(lhs, "err")
+	}
+	if len(lhs) != 0 {
+		fmt.Fprintf(buf, "%s := %s\n", strings.Join(lhs, ", "), call)
+	} else {
+		fmt.Fprintf(buf, "%s\n", call)
+	}
+	if hasErr {
+		fmt.Fprintf(buf, "if (err != nil) != tt.wantErr {\n")
+		fmt.Fprintf(buf, "t.Errorf(\"%s() error = %%v, wantErr %%v\", err, tt.wantErr)\n", dispName)
+		if len(results) != 0 {
+			fmt.Fprintf(buf, "return\n")
+		}
+		fmt.Fprintf(buf, "}\n")
+	}
+	for _, r := range results {
+		fmt.Fprintf(buf, "if !reflect.DeepEqual(got%s, tt.want%s) {\n", r.name, r.name)
+		fmt.Fprintf(buf, "t.Errorf(\"%s() got%s = %%v, want %%v\", got%s, tt.want%s)\n", dispName, r.name, r.name, r.name)
+		fmt.Fprintf(buf, "}\n")
+	}
+	fmt.Fprintf(buf, "})\n}\n}\n")
+	return buf.Bytes()
+}
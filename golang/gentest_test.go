@@ -0,0 +1,62 @@
+package golang
+
+import (
+	"margo.sh/mg"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenTest(t *testing.T) {
+	mx, dir, cleanup := testModule(t, map[string]string{
+		"a/a.go": "package a\n\nfunc Add(a, b int) (int, error) { return a + b, nil }\n\n" +
+			"func Map[T any](x T) T { return x }\n\n" +
+			"type L[T any] []T\n\nfunc (l L[T]) Len() int { return len(l) }\n",
+	})
+	defer cleanup()
+
+	tests := []struct {
+		at      string
+		want    []string
+		wantErr string
+	}{
+		{
+			at: "func |Add(",
+			want: []string{
+				"func TestAdd(t *testing.T) {",
+				"got, err := Add(tt.args.a, tt.args.b)",
+				"\"reflect\"",
+			},
+		},
+		{at: "func |Map[", wantErr: "generic"},
+		{at: "func (l L[T]) |Len()", wantErr: "generic"},
+	}
+	for _, tt := range tests {
+		gt, _, err := (&genTestCmd{}).genTest(testView(t, mx, dir, "a/a.go", tt.at), false)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("genTest(%q) error = %v, want it to contain %q", tt.at, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("genTest(%q) failed: %s", tt.at, err)
+			continue
+		}
+		for _, s := range tt.want {
+			if !strings.Contains(string(gt.Src), s) {
+				t.Errorf("genTest(%q) = \n%s\nwant it to contain %q", tt.at, gt.Src, s)
+			}
+		}
+	}
+
+	mx.Store.ObserveTestingView(&mg.View{
+		Path:  filepath.Join(dir, "a", "a_test.go"),
+		Name:  "a_test.go",
+		Dirty: true,
+	})
+	_, _, err := (&genTestCmd{}).genTest(testView(t, mx, dir, "a/a.go", "func |Add("), false)
+	if err == nil || !strings.Contains(err.Error(), "unsaved changes") {
+		t.Errorf("genTest with a_test.go modified error = %v, want it to refuse to overwrite the unsaved changes", err)
+	}
+}
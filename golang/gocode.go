@@ -70,9 +70,27 @@ func (gr *gocodeReq) addUnimportedPkg(st *mg.State, p impSpec) *mg.State {
 }
 
 func (gr *gocodeReq) reduce() *mg.State {
-	sugg := gr.gx.suggestions()
+	gx := gr.gx
+	rank := !gx.gsu.cfg.NoRanking
+	var expC <-chan gcExpType
+	if rank {
+		gcHist.observe(gr.mx, gx.src, gx.pos)
+		expC = gx.expectedType()
+	}
+
+	sugg := gx.suggestions()
 	completions := make([]mg.Completion, 0, len(sugg.candidates))
 
+	if rank && len(sugg.candidates) != 0 {
+		exp := gcExpType{}
+		select {
+		case exp = <-expC:
+		case <-time.After(gcRankTimeout):
+		}
+		sugg.candidates = newGcRanker(gr.mx, gx, sugg, exp).rank(sugg.candidates)
+		gcHist.offered(gr.mx, gx.src, gx.pos, sugg.candidates)
+	}
+
 	st := gr.st
 	if len(sugg.candidates) != 0 {
 		st = gr.addUnimportedPkg(st, sugg.unimported)
@@ -0,0 +1,627 @@
+package golang
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"kuroku.io/margocode/suggest"
+	"margo.sh/bolt"
+	"margo.sh/mg"
+	"margo.sh/mgutil"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	gcRankTypeMatch   = 40
+	gcRankConvertible = 30
+	gcRankTypeName    = 20
+	gcRankLocal       = 8
+	gcRankImported    = 5
+	gcRankBuiltin     = 2
+	gcRankRecent      = 5
+	gcRankDeprecated  = -50
+
+	// gcRankTimeout is how long to wait for the expected type after the candidates are ready
+	gcRankTimeout = 50 * time.Millisecond
+
+	// gcHistMaxEnts is the number of accepted completions to remember
+	gcHistMaxEnts = 1000
+)
+
+var (
+	gcHist = &gcHistory{}
+)
+
+// gcExpType is the type expected at the cursor
+type gcExpType struct {
+	typ types.Type
+	str string
+}
+
+// gcRanker orders completion candidates by relevance
+type gcRanker struct {
+	mx         *mg.Ctx
+	gx         *gocodeCtx
+	exp        gcExpType
+	imports    map[string]bool
+	unimported string
+	hist       map[string]gcHistEnt
+	deprecated map[string]map[string]bool
+}
+
+func newGcRanker(mx *mg.Ctx, gx *gocodeCtx, sugg suggestions, exp gcExpType) *gcRanker {
+	rk := &gcRanker{
+		mx:         mx,
+		gx:         gx,
+		exp:        exp,
+		imports:    map[string]bool{},
+		unimported: sugg.unimported.Path,
+		hist:       gcHist.entries(),
+		deprecated: map[string]map[string]bool{},
+	}
+	if af := gx.AstFile; af != nil {
+		for _, spec := range af.Imports {
+			rk.imports[unquote(spec.Path.Value)] = true
+		}
+	}
+	return rk
+}
+
+// rank sorts l, the most relevant candidates first
+func (rk *gcRanker) rank(l []suggest.Candidate) []suggest.Candidate {
+	defer rk.mx.Profile.Push("gcRanker.rank").Pop()
+
+	scores := make(map[suggest.Candidate]int, len(l))
+	for _, c := range l {
+		scores[c] = rk.score(c)
+	}
+	sort.SliceStable(l, func(i, j int) bool { return scores[l[i]] > scores[l[j]] })
+	return l
+}
+
+func (rk *gcRanker) score(c suggest.Candidate) int {
+	n := rk.typeScore(c) + rk.localityScore(c) + rk.histScore(c)
+	if rk.isDeprecated(c) {
+		n += gcRankDeprecated
+	}
+	return n
+}
+
+func (rk *gcRanker) typeScore(c suggest.Candidate) int {
+	exp := rk.exp.str
+	if exp == "" {
+		return 0
+	}
+	switch c.Class {
+	case "var", "const":
+		if c.Type == exp {
+			return gcRankTypeMatch
+		}
+		if rk.untypedOk(c.Type) {
+			return gcRankConvertible
+		}
+	case "func":
+		if c.Type == exp {
+			return gcRankTypeMatch
+		}
+		if gcFuncResult(c.Type) == exp {
+			return gcRankConvertible
+		}
+	case "type":
+		nm := strings.TrimLeft(exp, "*&")
+		if nm == c.Name || strings.HasSuffix(nm, "."+c.Name) {
+			return gcRankTypeName
+		}
+	}
+	return 0
+}
+
+// untypedOk returns true if a constant of type typ e.g. `untyped int` can be used as the expected type
+func (rk *gcRanker) untypedOk(typ string) bool {
+	if !strings.HasPrefix(typ, "untyped ") {
+		return false
+	}
+	b, ok := rk.exp.typ.Underlying().(*types.Basic)
+	if !ok {
+		return false
+	}
+	switch strings.TrimPrefix(typ, "untyped ") {
+	case "int", "rune":
+		return b.Info()&types.IsNumeric != 0
+	case "float":
+		return b.Info()&(types.IsFloat|types.IsComplex) != 0
+	case "complex":
+		return b.Info()&types.IsComplex != 0
+	case "string":
+		return b.Info()&types.IsString != 0
+	case "bool":
+		return b.Info()&types.IsBoolean != 0
+	}
+	return false
+}
+
+func (rk *gcRanker) localityScore(c suggest.Candidate) int {
+	switch {
+	case c.PkgPath == "":
+		return gcRankLocal
+	case c.PkgPath == "builtin":
+		return gcRankBuiltin
+	case rk.imports[c.PkgPath]:
+		return gcRankImported
+	default:
+		// unimported, including sugg.unimported
+		return 0
+	}
+}
+
+func (rk *gcRanker) histScore(c suggest.Candidate) int {
+	e, ok := rk.hist[gcHistKey(c)]
+	if !ok {
+		return 0
+	}
+	n := int(10 * math.Log2(float64(1+e.N)))
+	if n > 20 {
+		n = 20
+	}
+	if time.Since(time.Unix(e.At, 0)) < 24*time.Hour {
+		n += gcRankRecent
+	}
+	return n
+}
+
+func (rk *gcRanker) isDeprecated(c suggest.Candidate) bool {
+	if c.PkgPath == "builtin" {
+		return false
+	}
+	m, ok := rk.deprecated[c.PkgPath]
+	if !ok {
+		dir := rk.mx.View.Dir()
+		if c.PkgPath != "" {
+			dir = ""
+			if p, err := mctl.pkgInfo(rk.mx, c.PkgPath, rk.mx.View.Dir()); err == nil {
+				dir = p.Dir
+			}
+		}
+		if dir != "" {
+			m = gcDeprecatedNames(rk.mx, dir)
+		}
+		rk.deprecated[c.PkgPath] = m
+	}
+	return m[c.Name]
+}
+
+// gcFuncResult returns the result type of the func type typ, if it has a single result
+func gcFuncResult(typ string) string {
+	x, _ := parser.ParseExpr(typ)
+	fx, _ := x.(*ast.FuncType)
+	if fx == nil || fx.Results == nil || fx.Results.NumFields() != 1 {
+		return ""
+	}
+	buf := &strings.Builder{}
+	printer.Fprint(buf, token.NewFileSet(), fx.Results.List[0].Type)
+	return buf.String()
+}
+
+// gcDeprecatedNames returns the names of the declarations, fields and methods in dir
+// whose documentation contains a paragraph starting with `Deprecated:`
+func gcDeprecatedNames(mx *mg.Ctx, dir string) map[string]bool {
+	type K struct{}
+	m, _ := mx.VFS.ReadMemo(dir, K{}, func() interface{} {
+		m := map[string]bool{}
+		fset := token.NewFileSet()
+		for _, nd := range mx.VFS.Poke(dir).Ls().Nodes() {
+			nm := nd.Name()
+			if !strings.HasSuffix(nm, ".go") || strings.HasSuffix(nm, "_test.go") {
+				continue
+			}
+			src, err := nd.ReadBlob().ReadFile()
+			if err != nil {
+				continue
+			}
+			af, _ := parser.ParseFile(fset, filepath.Join(dir, nm), src, parser.ParseComments)
+			if af != nil {
+				gcCollectDeprecated(af, m)
+			}
+		}
+		return m
+	}).(map[string]bool)
+	return m
+}
+
+func gcCollectDeprecated(af *ast.File, m map[string]bool) {
+	isDep := func(docs ...*ast.CommentGroup) bool {
+		for _, cg := range docs {
+			if cg == nil {
+				continue
+			}
+			for _, ln := range strings.Split(cg.Text(), "\n") {
+				if strings.HasPrefix(ln, "Deprecated:") {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	addFields := func(fl *ast.FieldList) {
+		if fl == nil {
+			return
+		}
+		for _, f := range fl.List {
+			if !isDep(f.Doc, f.Comment) {
+				continue
+			}
+			for _, id := range f.Names {
+				m[id.Name] = true
+			}
+		}
+	}
+	for _, d := range af.Decls {
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			if isDep(d.Doc) {
+				m[d.Name.Name] = true
+			}
+		case *ast.GenDecl:
+			var gdoc *ast.CommentGroup
+			if len(d.Specs) == 1 {
+				gdoc = d.Doc
+			}
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					if isDep(s.Doc, gdoc) {
+						m[s.Name.Name] = true
+					}
+					switch t := s.Type.(type) {
+					case *ast.StructType:
+						addFields(t.Fields)
+					case *ast.InterfaceType:
+						addFields(t.Methods)
+					}
+				case *ast.ValueSpec:
+					if isDep(s.Doc, s.Comment, gdoc) {
+						for _, id := range s.Names {
+							m[id.Name] = true
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// expectedType asynchronously determines the type expected at the cursor.
+// The returned channel receives a single value.
+func (gx *gocodeCtx) expectedType() <-chan gcExpType {
+	ch := make(chan gcExpType, 1)
+	if !gx.wantsExpectedType() {
+		ch <- gcExpType{}
+		return ch
+	}
+	go func() {
+		defer func() {
+			// type-checking broken code is not expected to be reliable
+			recover()
+		}()
+		ch <- gx.typeCheckExpectedType()
+	}()
+	return ch
+}
+
+func (gx *gocodeCtx) wantsExpectedType() bool {
+	return gx.CallExpr != nil ||
+		gx.Scope.Is(AssignmentScope, ReturnScope, VarScope, ConstScope) ||
+		gx.Contains((*ast.BinaryExpr)(nil)) ||
+		gx.Contains((*ast.CompositeLit)(nil)) ||
+		gx.Contains((*ast.SendStmt)(nil))
+}
+
+func (gx *gocodeCtx) typeCheckExpectedType() gcExpType {
+	defer gx.mx.Profile.Push("gocodeCtx.expectedType").Pop()
+
+	// the partially typed identifier is kept as-is, but if there is none
+	// we insert a placeholder so that the code parses e.g. `x = |` or `f(x.|)`
+	src, pos := gx.src, mgutil.ClampPos(gx.src, gx.pos)
+	start := mgutil.RepositionLeft(src, pos, IsLetter)
+	if start == pos {
+		s := make([]byte, 0, len(src)+1)
+		s = append(s, src[:pos]...)
+		s = append(s, '_')
+		src = append(s, src[pos:]...)
+	}
+
+	pp := checkPartialPkg(gx.mx, src)
+	if pp == nil {
+		return gcExpType{}
+	}
+	t := gcExpectedTypeOf(pp.Info, pp.path(start, start))
+	if t == nil || t == types.Typ[types.Invalid] {
+		return gcExpType{}
+	}
+	return gcExpType{typ: t, str: pp.typeString(t)}
+}
+
+// gcExpectedTypeOf returns the type expected for the identifier path[0]
+func gcExpectedTypeOf(inf *types.Info, path []ast.Node) types.Type {
+	if len(path) == 0 {
+		return nil
+	}
+	e, ok := path[0].(ast.Expr)
+	if !ok {
+		return nil
+	}
+	index := func(l []ast.Expr) int {
+		for i, x := range l {
+			if x == e {
+				return i
+			}
+		}
+		return -1
+	}
+	for i, n := range path[1:] {
+		switch x := n.(type) {
+		case *ast.SelectorExpr:
+			if x.Sel != e {
+				return nil
+			}
+			e = x
+		case *ast.ParenExpr:
+			e = x
+		case *ast.CallExpr:
+			j := index(x.Args)
+			sig, _ := inf.TypeOf(x.Fun).(*types.Signature)
+			if j < 0 || sig == nil {
+				return nil
+			}
+			params := sig.Params()
+			switch {
+			case sig.Variadic() && j >= params.Len()-1 && !x.Ellipsis.IsValid():
+				sl, _ := params.At(params.Len() - 1).Type().(*types.Slice)
+				if sl == nil {
+					return nil
+				}
+				return sl.Elem()
+			case j < params.Len():
+				return params.At(j).Type()
+			}
+			return nil
+		case *ast.AssignStmt:
+			j := index(x.Rhs)
+			if j < 0 || x.Tok == token.DEFINE || len(x.Lhs) != len(x.Rhs) {
+				return nil
+			}
+			return inf.TypeOf(x.Lhs[j])
+		case *ast.ValueSpec:
+			if x.Type == nil || index(x.Values) < 0 {
+				return nil
+			}
+			return inf.TypeOf(x.Type)
+		case *ast.ReturnStmt:
+			j := index(x.Results)
+			sig := gcEnclosingSig(inf, path[i+2:])
+			if j < 0 || sig == nil || sig.Results().Len() != len(x.Results) {
+				return nil
+			}
+			return sig.Results().At(j).Type()
+		case *ast.BinaryExpr:
+			switch x.Op {
+			case token.LAND, token.LOR:
+				return types.Typ[types.Bool]
+			case token.SHL, token.SHR:
+				return nil
+			}
+			if x.X == e {
+				return inf.TypeOf(x.Y)
+			}
+			return inf.TypeOf(x.X)
+		case *ast.SendStmt:
+			if x.Value != e {
+				return nil
+			}
+			if ch, ok := inf.TypeOf(x.Chan).Underlying().(*types.Chan); ok {
+				return ch.Elem()
+			}
+			return nil
+		case *ast.KeyValueExpr:
+			if x.Value != e || i+2 >= len(path) {
+				return nil
+			}
+			lit, _ := path[i+2].(*ast.CompositeLit)
+			if lit == nil {
+				return nil
+			}
+			key, _ := x.Key.(*ast.Ident)
+			return gcEltType(inf.TypeOf(lit), key, -1)
+		case *ast.CompositeLit:
+			j := index(x.Elts)
+			if j < 0 {
+				return nil
+			}
+			return gcEltType(inf.TypeOf(x), nil, j)
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// gcEltType returns the type of an element in a composite literal of type t
+func gcEltType(t types.Type, key *ast.Ident, index int) types.Type {
+	if t == nil {
+		return nil
+	}
+	if p, ok := t.Underlying().(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	switch t := t.Underlying().(type) {
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			f := t.Field(i)
+			if (key != nil && f.Name() == key.Name) || (key == nil && i == index) {
+				return f.Type()
+			}
+		}
+	case *types.Slice:
+		return t.Elem()
+	case *types.Array:
+		return t.Elem()
+	case *types.Map:
+		return t.Elem()
+	}
+	return nil
+}
+
+// gcEnclosingSig returns the signature of the first function in path
+func gcEnclosingSig(inf *types.Info, path []ast.Node) *types.Signature {
+	for _, n := range path {
+		switch x := n.(type) {
+		case *ast.FuncLit:
+			sig, _ := inf.TypeOf(x).(*types.Signature)
+			return sig
+		case *ast.FuncDecl:
+			if obj := inf.Defs[x.Name]; obj != nil {
+				sig, _ := obj.Type().(*types.Signature)
+				return sig
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+func gcHistKey(c suggest.Candidate) string {
+	return c.PkgPath + "." + c.Name
+}
+
+// gcHistEnt records how often, and when last, a completion was accepted
+type gcHistEnt struct {
+	N  int
+	At int64
+}
+
+type gcHistStoreKey struct{}
+
+type gcHistState struct {
+	Ents map[string]gcHistEnt
+}
+
+// gcOffer is the list of candidates last offered to the user
+type gcOffer struct {
+	view  mg.ViewKey
+	start int
+	names map[string]string
+}
+
+// gcHistory keeps track of completions accepted by the user.
+//
+// Editors don't report which completion was accepted, so after completions are offered,
+// the identifier at that position is checked once the cursor moves past it.
+type gcHistory struct {
+	mu     sync.Mutex
+	loaded bool
+	ents   map[string]gcHistEnt
+	offer  gcOffer
+	q      *mgutil.ChanQ
+}
+
+func (gh *gcHistory) load() {
+	if gh.loaded {
+		return
+	}
+	gh.loaded = true
+	hs := gcHistState{}
+	bolt.DS.Load(gcHistStoreKey{}, &hs)
+	gh.ents = hs.Ents
+	if gh.ents == nil {
+		gh.ents = map[string]gcHistEnt{}
+	}
+}
+
+func (gh *gcHistory) entries() map[string]gcHistEnt {
+	gh.mu.Lock()
+	defer gh.mu.Unlock()
+
+	gh.load()
+	return gh.ents
+}
+
+// observe checks whether the last offered completion was accepted
+func (gh *gcHistory) observe(mx *mg.Ctx, src []byte, pos int) {
+	gh.mu.Lock()
+	defer gh.mu.Unlock()
+
+	of := gh.offer
+	gh.offer = gcOffer{}
+	if of.view != mx.ViewKey() || of.start >= len(src) {
+		return
+	}
+	end := mgutil.RepositionRight(src, of.start, IsLetter)
+	if pos >= of.start && pos <= end {
+		// we're still typing the same identifier
+		gh.offer = of
+		return
+	}
+	k, ok := of.names[string(src[of.start:end])]
+	if !ok {
+		return
+	}
+
+	gh.load()
+	e := gh.ents[k]
+	e.N++
+	e.At = time.Now().Unix()
+	// the map is shared with rankers, so it's replaced instead of modified
+	ents := make(map[string]gcHistEnt, len(gh.ents)+1)
+	for k, v := range gh.ents {
+		ents[k] = v
+	}
+	ents[k] = e
+	gh.prune(ents)
+	gh.ents = ents
+
+	if gh.q == nil {
+		gh.q = mgutil.NewChanQLoop(1, func(v interface{}) {
+			bolt.DS.Store(gcHistStoreKey{}, v)
+		})
+	}
+	gh.q.Put(gcHistState{Ents: ents})
+}
+
+// prune removes the least-recently accepted entries if there are too many
+func (gh *gcHistory) prune(ents map[string]gcHistEnt) {
+	if len(ents) <= gcHistMaxEnts {
+		return
+	}
+	keys := make([]string, 0, len(ents))
+	for k := range ents {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return ents[keys[i]].At < ents[keys[j]].At })
+	for _, k := range keys[:len(keys)-gcHistMaxEnts] {
+		delete(ents, k)
+	}
+}
+
+// offered records the list of candidates offered at pos
+func (gh *gcHistory) offered(mx *mg.Ctx, src []byte, pos int, l []suggest.Candidate) {
+	of := gcOffer{
+		view:  mx.ViewKey(),
+		start: mgutil.RepositionLeft(src, pos, IsLetter),
+		names: make(map[string]string, len(l)),
+	}
+	for _, c := range l {
+		of.names[c.Name] = gcHistKey(c)
+	}
+
+	gh.mu.Lock()
+	defer gh.mu.Unlock()
+
+	gh.offer = of
+}
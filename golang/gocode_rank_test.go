@@ -0,0 +1,120 @@
+package golang
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"golang.org/x/tools/go/ast/astutil"
+	"kuroku.io/margocode/suggest"
+	"margo.sh/mg"
+	"strings"
+	"testing"
+)
+
+func TestGcExpectedTypeOf(t *testing.T) {
+	const src = `package p
+
+import "io"
+
+type T struct {
+	N int
+	W io.Writer
+}
+
+func f(s string, n ...int) {}
+
+func g() (int, error) {
+	var w io.Writer
+	var b bool
+	w = @W
+	f(@S, 1)
+	f("", 1, @N)
+	_ = T{N: @N}
+	_ = b && @B
+	_ = []string{@S}
+	return 1, @E
+}
+`
+	tests := []string{}
+	clean := &strings.Builder{}
+	offsets := []int{}
+	for i := 0; i < len(src); i++ {
+		if src[i] == '@' {
+			j := i + 1
+			for j < len(src) && src[j] >= 'A' && src[j] <= 'Z' {
+				j++
+			}
+			tests = append(tests, src[i+1:j])
+			offsets = append(offsets, clean.Len())
+			clean.WriteString("_")
+			i = j - 1
+			continue
+		}
+		clean.WriteByte(src[i])
+	}
+	expected := map[string]string{
+		"W": "io.Writer",
+		"S": "string",
+		"N": "int",
+		"B": "bool",
+		"E": "error",
+	}
+
+	fset := token.NewFileSet()
+	af, err := parser.ParseFile(fset, "p.go", clean.String(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inf := &types.Info{
+		Types: map[ast.Expr]types.TypeAndValue{},
+		Defs:  map[*ast.Ident]types.Object{},
+		Uses:  map[*ast.Ident]types.Object{},
+	}
+	tc := types.Config{Importer: importer.Default(), Error: func(error) {}}
+	pkg, _ := tc.Check("p", fset, []*ast.File{af}, inf)
+	qual := func(p *types.Package) string {
+		if p == pkg {
+			return ""
+		}
+		return p.Name()
+	}
+	tf := fset.File(af.Pos())
+	for i, nm := range tests {
+		p := tf.Pos(offsets[i])
+		path, _ := astutil.PathEnclosingInterval(af, p, p)
+		typ := gcExpectedTypeOf(inf, path)
+		got := ""
+		if typ != nil {
+			got = types.TypeString(typ, qual)
+		}
+		if want := expected[nm]; got != want {
+			t.Errorf("placeholder #%d (%s): expected type `%s`, got `%s`", i, nm, want, got)
+		}
+	}
+}
+
+func TestGcRankerRank(t *testing.T) {
+	rk := &gcRanker{
+		mx:         mg.NewTestingCtx(nil),
+		exp:        gcExpType{typ: types.Universe.Lookup("error").Type(), str: "error"},
+		imports:    map[string]bool{"io": true},
+		hist:       map[string]gcHistEnt{},
+		deprecated: map[string]map[string]bool{"io": {"Old": true}, "": {}},
+	}
+	l := []suggest.Candidate{
+		{Class: "var", PkgPath: "io", Name: "Old", Type: "error"},
+		{Class: "func", PkgPath: "", Name: "cleanup", Type: "func()"},
+		{Class: "var", PkgPath: "io", Name: "EOF", Type: "error"},
+		{Class: "func", PkgPath: "", Name: "check", Type: "func(v int) error"},
+	}
+	got := []string{}
+	for _, c := range rk.rank(l) {
+		got = append(got, c.Name)
+	}
+	want := "EOF check cleanup Old"
+	if s := strings.Join(got, " "); s != want {
+		t.Fatalf("rank() returned `%s`, expected `%s`", s, want)
+	}
+}
@@ -0,0 +1,361 @@
+package golang
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/rogpeppe/go-internal/modfile"
+	"github.com/rogpeppe/go-internal/semver"
+	"io/ioutil"
+	"margo.sh/golang/goutil"
+	"margo.sh/mg"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// GoMod adds builtin commands, and UserCmds, to edit the go.mod file of the current module:
+//
+//	go.mod.require [-indirect] path[@version]
+//		adds a requirement, or changes its version i.e. upgrades or downgrades it.
+//		version is a module query e.g. `v1.2.3`, `v1.2`, `master` or `latest` (the default)
+//		and is resolved with `go list -m`.
+//
+//	go.mod.replace path[@version] dir
+//		replaces the module with the module in the local directory dir.
+//
+//	go.mod.tidy
+//		runs `go mod tidy`.
+//
+// go.mod files are also checked when they're changed, and errors are reported as issues.
+type GoMod struct {
+	mg.ReducerType
+}
+
+type goModIssueKey struct{}
+
+func (gm *GoMod) RCond(mx *mg.Ctx) bool {
+	return mx.LangIs(mg.Go, mg.GoMod)
+}
+
+func (gm *GoMod) Reduce(mx *mg.Ctx) *mg.State {
+	switch mx.Action.(type) {
+	case mg.ViewActivated, mg.ViewModified, mg.ViewSaved:
+		if mx.LangIs(mg.GoMod) && mx.View.Path != "" {
+			src, _ := mx.View.ReadAll()
+			gm.storeIssues(mx, mx.View.Path, goModCheck(mx.View.Path, src), nil)
+		}
+	case mg.QueryUserCmds:
+		return mx.AddUserCmds(gm.userCmds(mx)...)
+	case mg.RunCmd:
+		return mx.AddBuiltinCmds(
+			mg.BuiltinCmd{
+				Name: "go.mod.require",
+				Desc: "Add a requirement to go.mod, or change its version. Usage: go.mod.require [-indirect] path[@version]",
+				Run:  gm.runFunc(gm.require),
+			},
+			mg.BuiltinCmd{
+				Name: "go.mod.replace",
+				Desc: "Replace a module with a local directory in go.mod. Usage: go.mod.replace path[@version] dir",
+				Run:  gm.runFunc(gm.replace),
+			},
+			mg.BuiltinCmd{
+				Name: "go.mod.tidy",
+				Desc: "Run `go mod tidy` in the current module. Usage: go.mod.tidy",
+				Run:  gm.runFunc(gm.tidy),
+			},
+		)
+	}
+	return mx.State
+}
+
+func (gm *GoMod) userCmds(mx *mg.Ctx) []mg.UserCmd {
+	if goutil.ModFileNd(mx, mx.View.Dir()) == nil {
+		return nil
+	}
+	return []mg.UserCmd{
+		{
+			Title:   "Go Mod: Require",
+			Name:    "go.mod.require",
+			Desc:    "Add a requirement to go.mod, or change its version",
+			Prompts: []string{"Module path[@version]"},
+		},
+		{
+			Title:   "Go Mod: Replace With Local Directory",
+			Name:    "go.mod.replace",
+			Desc:    "Replace a module with the module in a local directory",
+			Prompts: []string{"Module path[@version]", "Directory"},
+		},
+		{
+			Title: "Go Mod: Tidy",
+			Name:  "go.mod.tidy",
+			Desc:  "Run `go mod tidy` in the current module",
+		},
+	}
+}
+
+func (gm *GoMod) runFunc(f func(cx *mg.CmdCtx, gf *goModFile) error) mg.BuiltinCmdRunFunc {
+	return func(cx *mg.CmdCtx) *mg.State {
+		go func() {
+			defer cx.Output.Close()
+			defer cx.Begin(mg.Task{Title: cx.Name}).Done()
+
+			gf, err := loadGoModFile(cx.Ctx)
+			if err == nil {
+				err = f(cx, gf)
+			}
+			if err != nil {
+				fmt.Fprintf(cx.Output, "%s: %s\n", cx.Name, err)
+			}
+		}()
+		return cx.State
+	}
+}
+
+// goModArgs returns the command's args, or the user's input if it was run through a UserCmd
+func goModArgs(cx *mg.CmdCtx, fs mg.RunCmdFlagSet) []string {
+	if len(cx.Prompts) != 0 {
+		return cx.Prompts
+	}
+	return fs.Args()
+}
+
+func (gm *GoMod) require(cx *mg.CmdCtx, gf *goModFile) error {
+	fs := cx.Flags()
+	indirect := fs.Bool("indirect", false, "Mark the requirement as indirect, if it's new")
+	if err := fs.Parse(); err != nil {
+		return err
+	}
+	args := goModArgs(cx, fs)
+	if len(args) != 1 || args[0] == "" {
+		return fmt.Errorf("expected a module path[@version]")
+	}
+	path, query := goModSplitQuery(args[0])
+	if query == "" {
+		query = "latest"
+	}
+	vers, err := gm.resolve(cx, gf.Dir, path, query)
+	if err != nil {
+		return err
+	}
+
+	var oldVers string
+	for _, r := range gf.File.Require {
+		if r.Mod.Path == path {
+			oldVers = r.Mod.Version
+		}
+	}
+	if oldVers == "" {
+		gf.File.AddNewRequire(path, vers, *indirect)
+	} else if err := gf.File.AddRequire(path, vers); err != nil {
+		return err
+	}
+	if err := gf.save(cx); err != nil {
+		return err
+	}
+
+	switch c := semver.Compare(vers, oldVers); {
+	case oldVers == "":
+		fmt.Fprintf(cx.Output, "%s: added %s %s\n", cx.Name, path, vers)
+	case c > 0:
+		fmt.Fprintf(cx.Output, "%s: upgraded %s %s => %s\n", cx.Name, path, oldVers, vers)
+	case c < 0:
+		fmt.Fprintf(cx.Output, "%s: downgraded %s %s => %s\n", cx.Name, path, oldVers, vers)
+	default:
+		fmt.Fprintf(cx.Output, "%s: %s is already at %s\n", cx.Name, path, vers)
+	}
+	return nil
+}
+
+// resolve returns the version of the module path matching the module query
+func (gm *GoMod) resolve(cx *mg.CmdCtx, dir, path, query string) (string, error) {
+	if v := semver.Canonical(query); v == query {
+		return v, nil
+	}
+	cmd := exec.Command("go", "list", "-m", "-f", "{{.Version}}", path+"@"+query)
+	cmd.Dir = dir
+	cmd.Env = cx.Env.Environ()
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if s := strings.TrimSpace(stderr.String()); s != "" {
+			return "", fmt.Errorf("%s", s)
+		}
+		return "", err
+	}
+	vers := strings.TrimSpace(string(out))
+	if vers == "" {
+		return "", fmt.Errorf("cannot resolve %s@%s", path, query)
+	}
+	return vers, nil
+}
+
+func (gm *GoMod) replace(cx *mg.CmdCtx, gf *goModFile) error {
+	fs := cx.Flags()
+	if err := fs.Parse(); err != nil {
+		return err
+	}
+	args := goModArgs(cx, fs)
+	if len(args) != 2 || args[0] == "" || args[1] == "" {
+		return fmt.Errorf("expected a module path[@version] and a directory")
+	}
+	path, vers := goModSplitQuery(args[0])
+	dir := args[1]
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(gf.Dir, dir)
+	}
+	if !cx.VFS.Poke(filepath.Join(dir, "go.mod")).IsFile() {
+		return fmt.Errorf("%s does not contain a go.mod file", dir)
+	}
+
+	// keep the path relative if possible, so the go.mod file isn't tied to this machine
+	newPath := filepath.Clean(dir)
+	if rel, err := filepath.Rel(gf.Dir, newPath); err == nil && !filepath.IsAbs(args[1]) {
+		newPath = filepath.ToSlash(rel)
+		if !strings.HasPrefix(newPath, "../") {
+			newPath = "./" + newPath
+		}
+	}
+	if err := gf.File.AddReplace(path, vers, newPath, ""); err != nil {
+		return err
+	}
+	if err := gf.save(cx); err != nil {
+		return err
+	}
+	fmt.Fprintf(cx.Output, "%s: replaced %s => %s\n", cx.Name, args[0], newPath)
+	return nil
+}
+
+func (gm *GoMod) tidy(cx *mg.CmdCtx, gf *goModFile) error {
+	if cx.ViewIsDirty(gf.Path) {
+		return fmt.Errorf("go.mod has unsaved changes, save it first")
+	}
+
+	defer cx.VFS.Invalidate(filepath.Join(gf.Dir, "go.sum"))
+	defer cx.VFS.Invalidate(gf.Path)
+
+	iw := &mg.IssueOut{
+		Base:     mg.Issue{Label: "Go/Mod", Tag: mg.Error},
+		Patterns: mg.CommonPatterns(mg.GoMod),
+		Dir:      gf.Dir,
+	}
+	gx := cx.Copy(func(gx *mg.CmdCtx) {
+		gx.Name = "go"
+		gx.Args = []string{"mod", "tidy"}
+		gx.Dir = gf.Dir
+		gx.Output = mg.OutputStreams{cx.Output, iw}
+	})
+	p, err := gx.StartProc()
+	if err == nil {
+		err = p.Wait()
+	}
+	iw.Flush()
+
+	src, _ := ioutil.ReadFile(gf.Path)
+	gm.storeIssues(cx.Ctx, gf.Path, goModCheck(gf.Path, src), iw.Issues())
+	return err
+}
+
+// storeIssues reports the issues in the go.mod file fn
+func (gm *GoMod) storeIssues(mx *mg.Ctx, fn string, l ...mg.IssueSet) {
+	issues := mg.IssueSet{}
+	for _, s := range l {
+		for _, isu := range s {
+			if isu.Path == "" || filepath.Base(isu.Path) == "go.mod" {
+				isu.Path = fn
+			}
+			issues = append(issues, isu)
+		}
+	}
+	mx.Store.Dispatch(mg.StoreIssues{
+		IssueKey: mg.IssueKey{Key: goModIssueKey{}, Path: fn},
+		Issues:   issues,
+	})
+}
+
+// goModFile is the go.mod file of the current module
+type goModFile struct {
+	Dir  string
+	Path string
+	File *modfile.File
+}
+
+// loadGoModFile parses the go.mod file of the current module.
+// If the current view is the go.mod file, its src is used instead of the file on disk.
+func loadGoModFile(mx *mg.Ctx) (*goModFile, error) {
+	nd := goutil.ModFileNd(mx, mx.View.Dir())
+	if nd == nil {
+		return nil, fmt.Errorf("cannot find go.mod for %s", mx.View.Dir())
+	}
+	gf := &goModFile{Dir: filepath.Dir(nd.Path()), Path: nd.Path()}
+	var src []byte
+	var err error
+	if v := mx.View; v.Path == gf.Path {
+		src, err = v.ReadAll()
+	} else {
+		src, err = ioutil.ReadFile(gf.Path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	gf.File, err = modfile.Parse(gf.Path, src, nil)
+	if err != nil {
+		return nil, err
+	}
+	return gf, nil
+}
+
+// save writes the go.mod file.
+// If it's the current view, the view is updated instead, so it's not written while there are unsaved changes.
+// If it's open in another view with unsaved changes, an error is returned.
+func (gf *goModFile) save(cx *mg.CmdCtx) error {
+	gf.File.Cleanup()
+	src, err := gf.File.Format()
+	if err != nil {
+		return err
+	}
+	if v := cx.View; v.Path == gf.Path {
+		cx.Store.Dispatch(viewSrcEdit{
+			Title: cx.Name,
+			Name:  v.Name,
+			Hash:  v.Hash,
+			Src:   src,
+		})
+		return nil
+	}
+	if cx.ViewIsDirty(gf.Path) {
+		return fmt.Errorf("go.mod has unsaved changes, save it first")
+	}
+
+	defer cx.VFS.Invalidate(gf.Path)
+	fi, err := os.Stat(gf.Path)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(gf.Path, src, fi.Mode())
+}
+
+// goModCheck parses the go.mod file fn and returns its errors as issues
+func goModCheck(fn string, src []byte) mg.IssueSet {
+	_, err := modfile.Parse(fn, src, nil)
+	if err == nil {
+		return nil
+	}
+	iw := &mg.IssueOut{
+		Base:     mg.Issue{Label: "Go/Mod", Tag: mg.Error},
+		Patterns: mg.CommonPatterns(mg.GoMod),
+		Dir:      filepath.Dir(fn),
+	}
+	iw.Write([]byte(err.Error() + "\n"))
+	iw.Close()
+	return iw.Issues()
+}
+
+// goModSplitQuery splits s in the form path[@query]
+func goModSplitQuery(s string) (path, query string) {
+	if i := strings.LastIndexByte(s, '@'); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return s, ""
+}
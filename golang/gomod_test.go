@@ -0,0 +1,95 @@
+package golang
+
+import (
+	"bytes"
+	"io/ioutil"
+	"margo.sh/mg"
+	"margo.sh/mgutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGoModCheck(t *testing.T) {
+	fn := "/src/m/go.mod"
+	src := []byte("module example.com/m\n\nrequire (\n\texample.com/a v1.0.0\n\texample.com/b master\n)\n")
+	issues := goModCheck(fn, src)
+	if len(issues) != 1 {
+		t.Fatalf("expected 1 issue, got %#v", issues)
+	}
+	if isu := issues[0]; isu.Path != fn || isu.Row != 4 || isu.Label != "Go/Mod" {
+		t.Errorf("expected an issue in %s on row 4, got %#v", fn, isu)
+	}
+
+	if issues := goModCheck(fn, []byte("module example.com/m\n")); len(issues) != 0 {
+		t.Errorf("expected no issues, got %#v", issues)
+	}
+}
+
+func TestGoModEdits(t *testing.T) {
+	mx, dir, cleanup := testModule(t, map[string]string{
+		"go.mod":   "module example.com/m\n\nrequire example.com/a v1.1.0\n",
+		"m.go":     "package m\n",
+		"b/go.mod": "module example.com/b\n",
+	})
+	defer cleanup()
+	mx = testView(t, mx, dir, "m.go", "")
+	modFn := filepath.Join(dir, "go.mod")
+
+	gm := &GoMod{}
+	run := func(name string, f func(*mg.CmdCtx, *goModFile) error, args ...string) (string, error) {
+		gf, err := loadGoModFile(mx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := &bytes.Buffer{}
+		cx := &mg.CmdCtx{
+			Ctx:    mx,
+			RunCmd: mg.RunCmd{Name: name, Args: args},
+			Output: &mgutil.IOWrapper{Writer: buf},
+		}
+		err = f(cx, gf)
+		return buf.String(), err
+	}
+
+	tests := []struct {
+		name string
+		f    func(*mg.CmdCtx, *goModFile) error
+		args []string
+		out  string
+		want string
+	}{
+		{"go.mod.require", gm.require, []string{"example.com/c@v1.0.0"}, "added example.com/c v1.0.0", "example.com/c v1.0.0"},
+		{"go.mod.require", gm.require, []string{"example.com/a@v1.2.0"}, "upgraded example.com/a v1.1.0 => v1.2.0", "example.com/a v1.2.0"},
+		{"go.mod.require", gm.require, []string{"example.com/a@v1.0.0"}, "downgraded example.com/a v1.2.0 => v1.0.0", "example.com/a v1.0.0"},
+		{"go.mod.replace", gm.replace, []string{"example.com/b", "b"}, "replaced example.com/b => ./b", "replace example.com/b => ./b"},
+		{"go.mod.replace", gm.replace, []string{"example.com/a@v1.0.0", "b"}, "replaced example.com/a@v1.0.0 => ./b", "replace example.com/a v1.0.0 => ./b"},
+	}
+	for _, tt := range tests {
+		out, err := run(tt.name, tt.f, tt.args...)
+		if err != nil {
+			t.Errorf("%s %s failed: %s", tt.name, tt.args, err)
+			continue
+		}
+		if !strings.Contains(out, tt.out) {
+			t.Errorf("%s %s output = %q, want it to contain %q", tt.name, tt.args, out, tt.out)
+		}
+		src, _ := ioutil.ReadFile(modFn)
+		if !strings.Contains(string(src), tt.want) {
+			t.Errorf("%s %s: go.mod = \n%s\nwant it to contain %q", tt.name, tt.args, src, tt.want)
+		}
+	}
+
+	// go.mod is open in another view, with unsaved changes
+	mx.Store.ObserveTestingView(&mg.View{Path: modFn, Name: "go.mod", Dirty: true})
+	before, _ := ioutil.ReadFile(modFn)
+	if _, err := run("go.mod.require", gm.require, "example.com/d@v1.0.0"); err == nil || !strings.Contains(err.Error(), "unsaved changes") {
+		t.Errorf("go.mod.require with go.mod modified error = %v, want it to refuse to overwrite the unsaved changes", err)
+	}
+	if _, err := run("go.mod.tidy", gm.tidy); err == nil || !strings.Contains(err.Error(), "unsaved changes") {
+		t.Errorf("go.mod.tidy with go.mod modified error = %v, want it to refuse to overwrite the unsaved changes", err)
+	}
+	if after, _ := ioutil.ReadFile(modFn); !bytes.Equal(before, after) {
+		t.Errorf("go.mod was changed while it had unsaved changes: \n%s", after)
+	}
+}
@@ -1,12 +1,16 @@
 package golang
 
 import (
+	"fmt"
 	"go/ast"
+	"go/build"
 	"margo.sh/golang/goutil"
 	"margo.sh/mg"
+	"margo.sh/mgutil"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"unicode"
 	"unicode/utf8"
 )
@@ -21,6 +25,15 @@ type TestCmds struct {
 	// TestArgs is a list of extra arguments to pass to `go test` for tests and examples
 	// these are in addition to the usual `-test.run` arg
 	TestArgs []string
+
+	// JSON if true, runs tests using the `go.test` builtin instead of `go test`
+	// it uses `go test -json` to report failed tests as issues
+	// and summarises the results (pass/fail/skip counts, slowest tests, etc.) in the HUD
+	JSON bool
+
+	mu     sync.Mutex
+	rep    *goTestReport
+	repDir string
 }
 
 func (tc *TestCmds) RCond(mx *mg.Ctx) bool {
@@ -28,14 +41,26 @@ func (tc *TestCmds) RCond(mx *mg.Ctx) bool {
 }
 
 func (tc *TestCmds) Reduce(mx *mg.Ctx) *mg.State {
+	st := mx.State
 	switch act := mx.Action.(type) {
 	case mg.QueryTestCmds:
-		return tc.queryTestCmds(mx)
+		st = tc.queryTestCmds(mx)
 	case mg.RunCmd:
-		return tc.actuateCmd(mx, act)
-	default:
-		return mx.State
+		st = tc.actuateCmd(mx, act).AddBuiltinCmds(mg.BuiltinCmd{
+			Name: "go.test",
+			Desc: "Run `go test -json` reporting failed tests as issues, and a summary in the HUD",
+			Run:  tc.goTestBuiltin,
+		})
 	}
+
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if tc.rep != nil && tc.repDir == mx.View.Dir() {
+		heading, content := tc.rep.HUD()
+		st = st.AddHUD(heading, content...)
+	}
+	return st
 }
 
 func (tc *TestCmds) actuateCmd(mx *mg.Ctx, rc mg.RunCmd) *mg.State {
@@ -63,15 +88,24 @@ func (tc *TestCmds) actuateCmd(mx *mg.Ctx, rc mg.RunCmd) *mg.State {
 		return mx.State
 	}
 
-	args := tc.pfxArgs(pfx, pat)
+	uc := tc.userCmd("", tc.pfxArgs(pfx, pat))
 	return mx.AddBuiltinCmds(mg.BuiltinCmd{
 		Name: mg.RcActuate,
 		Run: func(cx *mg.CmdCtx) *mg.State {
-			return cx.WithCmd("go", args...).Run()
+			return cx.WithCmd(uc.Name, uc.Args...).Run()
 		},
 	})
 }
 
+// userCmd returns a UserCmd that runs `go` with args args,
+// or the `go.test` builtin if TestCmds.JSON is set
+func (tc *TestCmds) userCmd(title string, args []string) mg.UserCmd {
+	if tc.JSON && len(args) != 0 && args[0] == "test" {
+		return mg.UserCmd{Name: "go.test", Args: args[1:], Title: title}
+	}
+	return mg.UserCmd{Name: "go", Args: args, Title: title}
+}
+
 func (tc *TestCmds) queryTestCmds(mx *mg.Ctx) *mg.State {
 	dir := mx.View.Dir()
 	bld := BuildContext(mx)
@@ -95,26 +129,18 @@ func (tc *TestCmds) queryTestCmds(mx *mg.Ctx) *mg.State {
 	}
 
 	cl := make(mg.UserCmdList, 0, 4+numCmds)
-	cl = append(cl, mg.UserCmd{
-		Name:  "go",
-		Args:  tc.testArgs("."),
-		Title: "Run all Tests and Examples",
-	})
+	cl = append(cl, tc.userCmd("Run all Tests and Examples", tc.testArgs(".")))
 	for _, pfx := range []string{"Test", "Benchmark", "Example"} {
 		if len(cmds[pfx]) == 0 {
 			continue
 		}
 
-		cmd := mg.UserCmd{
-			Name:  "go",
-			Title: "Run all " + pfx + "s",
-		}
+		title := "Run all " + pfx + "s"
 		if pfx == "Benchmark" {
-			cmd.Args = tc.benchArgs(".")
+			cl = append(cl, tc.userCmd(title, tc.benchArgs(".")))
 		} else {
-			cmd.Args = tc.testArgs(pfx + ".+")
+			cl = append(cl, tc.userCmd(title, tc.testArgs(pfx+".+")))
 		}
-		cl = append(cl, cmd)
 	}
 	for _, pfx := range []string{"Test", "Benchmark", "Example"} {
 		l := cmds[pfx]
@@ -153,11 +179,7 @@ func (tc *TestCmds) processIdent(cmds map[string]mg.UserCmdList, id *ast.Ident)
 	if !ok {
 		return
 	}
-	cmds[pfx] = append(cmds[pfx], mg.UserCmd{
-		Name:  "go",
-		Args:  tc.pfxArgs(pfx, "^"+name+"$"),
-		Title: pfx + ": " + sfx,
-	})
+	cmds[pfx] = append(cmds[pfx], tc.userCmd(pfx+": "+sfx, tc.pfxArgs(pfx, "^"+name+"$")))
 }
 
 func (tc *TestCmds) splitName(nm string) (name, pfx, sfx string, ok bool) {
@@ -176,3 +198,72 @@ func (tc *TestCmds) splitName(nm string) (name, pfx, sfx string, ok bool) {
 	}
 	return "", "", "", false
 }
+
+func (tc *TestCmds) goTestBuiltin(cx *mg.CmdCtx) *mg.State {
+	go tc.goTest(cx)
+	return cx.State
+}
+
+func (tc *TestCmds) goTest(cx *mg.CmdCtx) {
+	defer cx.Output.Close()
+
+	v := cx.View
+	dir := v.Dir()
+	rep := newGoTestReport()
+	iw := &mg.IssueOut{
+		Base:     mg.Issue{Label: goTestLabel},
+		Patterns: cx.CommonPatterns(),
+		Dir:      dir,
+	}
+	out := mgutil.NewSplitStream(mgutil.SplitLine, &goTestWriter{
+		Report: rep,
+		Output: cx.Output,
+		Issues: iw,
+	})
+	gx := cx.Copy(func(gx *mg.CmdCtx) {
+		gx.Name = "go"
+		gx.Args = append([]string{"test", "-json"}, cx.Args...)
+		gx.Output = out
+	})
+	p, err := gx.StartProc()
+	if err == nil {
+		err = p.Wait()
+	}
+	out.Close()
+	if err != nil {
+		fmt.Fprintf(cx.Output, "%s exited: %s\n", p.Title, err)
+	}
+
+	issues := append(iw.Issues(), rep.Issues(cx.Ctx, tc.pkgDirFunc(cx.Ctx))...)
+	for i, isu := range issues {
+		if isu.Path == "" {
+			isu.Name = v.Name
+			isu.Path = v.Path
+		}
+		issues[i] = isu
+	}
+	type Key struct{}
+	cx.Store.Dispatch(mg.StoreIssues{
+		IssueKey: mg.IssueKey{Key: Key{}, Dir: dir},
+		Issues:   issues,
+	})
+
+	tc.mu.Lock()
+	tc.rep, tc.repDir = rep, dir
+	tc.mu.Unlock()
+	cx.Store.Dispatch(mg.Render)
+}
+
+// pkgDirFunc returns a function that returns the directory of the package with import path importPath.
+// If the package can't be found, the current view's directory is returned.
+func (tc *TestCmds) pkgDirFunc(mx *mg.Ctx) func(importPath string) string {
+	dir := mx.View.Dir()
+	bctx := BuildContext(mx)
+	return func(importPath string) string {
+		bp, _ := bctx.Import(importPath, dir, build.FindOnly)
+		if bp != nil && bp.Dir != "" {
+			return bp.Dir
+		}
+		return dir
+	}
+}
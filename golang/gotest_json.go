@@ -0,0 +1,348 @@
+package golang
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"io"
+	"margo.sh/htm"
+	"margo.sh/mg"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// goTestLabel is the label of issues reported for failed tests
+	goTestLabel = "go/test"
+
+	// maxTestsHUD is the maximum number of failed, and slowest tests listed in the HUD
+	maxTestsHUD = 5
+)
+
+var (
+	// goTestLocPat matches test output like `    x_test.go:12: message`
+	// and stack frames like `	/path/x_test.go:12 +0x1d`
+	goTestLocPat = regexp.MustCompile(`^(\s*)([^\s:]+\.go):(\d+)(?::\d+)?(?::\s?|\s+)(.*)$`)
+)
+
+// goTestEvent is an event emitted by `go test -json`, see `go doc test2json`
+type goTestEvent struct {
+	Time    time.Time
+	Action  string
+	Package string
+	Test    string
+	Elapsed float64
+	Output  string
+}
+
+// goTestResult is the result of a test, or a package if Name is empty
+type goTestResult struct {
+	Package string
+	Name    string
+	// Action is one of pass, fail or skip, or empty if the test didn't finish
+	Action  string
+	Elapsed time.Duration
+	Output  []string
+}
+
+// goTestReport collects the results of `go test -json`
+type goTestReport struct {
+	// Tests is the list of tests, in the order in which they were started
+	Tests []*goTestResult
+	// Pkgs is the list of package results
+	Pkgs []*goTestResult
+
+	results map[[2]string]*goTestResult
+}
+
+func newGoTestReport() *goTestReport {
+	return &goTestReport{results: map[[2]string]*goTestResult{}}
+}
+
+// parseGoTestJSON reads the output of `go test -json` from r
+func parseGoTestJSON(r io.Reader) *goTestReport {
+	rep := newGoTestReport()
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		rep.ParseLine(sc.Bytes())
+	}
+	return rep
+}
+
+// ParseLine parses a line of output from `go test -json` and records the event.
+//
+// It returns the text that `go test` would have output without the `-json` flag.
+// inPkg is false for output that's not associated with a package e.g. build errors.
+// Lines that are not JSON events are returned as-is.
+func (rep *goTestReport) ParseLine(ln []byte) (output string, inPkg bool) {
+	ln = bytes.TrimRight(ln, "\r\n")
+	if len(ln) == 0 || ln[0] != '{' {
+		return string(ln) + "\n", false
+	}
+	e := goTestEvent{}
+	if err := json.Unmarshal(ln, &e); err != nil || e.Action == "" {
+		return string(ln) + "\n", false
+	}
+	rep.event(e)
+	return e.Output, e.Package != ""
+}
+
+func (rep *goTestReport) event(e goTestEvent) {
+	if e.Package == "" {
+		// build output, etc. isn't associated with a test
+		return
+	}
+	k := [2]string{e.Package, e.Test}
+	res := rep.results[k]
+	if res == nil {
+		res = &goTestResult{Package: e.Package, Name: e.Test}
+		rep.results[k] = res
+		if e.Test == "" {
+			rep.Pkgs = append(rep.Pkgs, res)
+		} else {
+			rep.Tests = append(rep.Tests, res)
+		}
+	}
+	switch e.Action {
+	case "output":
+		res.Output = append(res.Output, strings.TrimRight(e.Output, "\r\n"))
+	case "pass", "fail", "skip":
+		res.Action = e.Action
+		res.Elapsed = time.Duration(e.Elapsed * float64(time.Second))
+	}
+}
+
+// Count returns the number of tests whose Action is action
+func (rep *goTestReport) Count(action string) int {
+	n := 0
+	for _, t := range rep.Tests {
+		if t.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// Elapsed returns the sum of the time taken to run each package's tests
+func (rep *goTestReport) Elapsed() time.Duration {
+	d := time.Duration(0)
+	for _, p := range rep.Pkgs {
+		d += p.Elapsed
+	}
+	return d
+}
+
+// Failed returns the list of failed tests.
+// Tests that failed because one of its sub-tests failed are excluded.
+func (rep *goTestReport) Failed() []*goTestResult {
+	l := []*goTestResult{}
+	for _, t := range rep.Tests {
+		if t.Action != "fail" || rep.hasFailedSubTest(t) {
+			continue
+		}
+		l = append(l, t)
+	}
+	return l
+}
+
+func (rep *goTestReport) hasFailedSubTest(t *goTestResult) bool {
+	pfx := t.Name + "/"
+	for _, s := range rep.Tests {
+		if s.Package == t.Package && s.Action == "fail" && strings.HasPrefix(s.Name, pfx) {
+			return true
+		}
+	}
+	return false
+}
+
+// Slowest returns the n slowest finished tests, excluding sub-tests
+func (rep *goTestReport) Slowest(n int) []*goTestResult {
+	l := []*goTestResult{}
+	for _, t := range rep.Tests {
+		if t.Action != "" && !strings.Contains(t.Name, "/") {
+			l = append(l, t)
+		}
+	}
+	sort.SliceStable(l, func(i, j int) bool { return l[i].Elapsed > l[j].Elapsed })
+	if len(l) > n {
+		l = l[:n]
+	}
+	return l
+}
+
+// Issues returns the list of issues for the failed tests.
+//
+// pkgDir returns the directory of the package with the specified import path.
+// If a test's output doesn't refer to a file in its package,
+// the issue is reported on the declaration of the test function.
+func (rep *goTestReport) Issues(mx *mg.Ctx, pkgDir func(importPath string) string) mg.IssueSet {
+	issues := mg.IssueSet{}
+	for _, t := range rep.Failed() {
+		dir := pkgDir(t.Package)
+		l := goTestOutputIssues(t, dir)
+		if len(l) == 0 {
+			l = append(l, goTestDeclIssue(mx, t, dir))
+		}
+		issues = append(issues, l...)
+	}
+	return issues
+}
+
+// goTestOutputIssues returns the issues for the locations in the output of the failed test t.
+// Only locations in the package directory dir are considered.
+func goTestOutputIssues(t *goTestResult, dir string) mg.IssueSet {
+	issues := mg.IssueSet{}
+	panicMsg := ""
+	for i := 0; i < len(t.Output); i++ {
+		s := t.Output[i]
+		if strings.HasPrefix(s, "panic: ") && panicMsg == "" {
+			panicMsg = s
+			continue
+		}
+		m := goTestLocPat.FindStringSubmatch(s)
+		if m == nil {
+			continue
+		}
+		indent, fn, msg := m[1], m[2], m[4]
+		line, _ := strconv.Atoi(m[3])
+		if !filepath.IsAbs(fn) {
+			fn = filepath.Join(dir, fn)
+		}
+		if line < 1 || filepath.Dir(fn) != dir {
+			continue
+		}
+
+		if strings.HasPrefix(msg, "+0x") {
+			// a stack frame, only report the first frame in the package
+			if panicMsg == "" || len(issues) != 0 {
+				continue
+			}
+			msg = panicMsg
+		} else {
+			// multi-line messages are indented further than the first line
+			for i+1 < len(t.Output) && goTestIndent(t.Output[i+1]) > len(indent) {
+				i++
+				msg += "\n" + strings.TrimSpace(t.Output[i])
+			}
+		}
+		issues = append(issues, mg.Issue{
+			Path:    fn,
+			Row:     line - 1,
+			Tag:     mg.Error,
+			Label:   goTestLabel,
+			Message: t.Name + ": " + msg,
+		})
+	}
+	return issues
+}
+
+func goTestIndent(s string) int {
+	return len(s) - len(strings.TrimLeft(s, " \t"))
+}
+
+// goTestDeclIssue returns an issue on the declaration of the failed test t
+func goTestDeclIssue(mx *mg.Ctx, t *goTestResult, dir string) mg.Issue {
+	name := t.Name
+	if i := strings.IndexByte(name, '/'); i >= 0 {
+		name = name[:i]
+	}
+	isu := mg.Issue{
+		Tag:     mg.Error,
+		Label:   goTestLabel,
+		Message: fmt.Sprintf("%s failed", t.Name),
+	}
+	for i := len(t.Output) - 1; i >= 0; i-- {
+		s := strings.TrimSpace(t.Output[i])
+		if s != "" && !strings.HasPrefix(s, "=== ") && !strings.HasPrefix(s, "--- ") {
+			isu.Message += ": " + s
+			break
+		}
+	}
+
+	bp, _ := BuildContext(mx).ImportDir(dir, 0)
+	if bp == nil {
+		return isu
+	}
+	for _, nm := range append(bp.TestGoFiles, bp.XTestGoFiles...) {
+		pf := ParseFile(mx, filepath.Join(dir, nm), nil)
+		for _, d := range pf.AstFile.Decls {
+			fd, ok := d.(*ast.FuncDecl)
+			if !ok || fd.Recv != nil || fd.Name == nil || fd.Name.Name != name {
+				continue
+			}
+			p := pf.Fset.Position(fd.Name.Pos())
+			isu.Path = p.Filename
+			isu.Row = p.Line - 1
+			isu.Col = p.Column - 1
+			return isu
+		}
+	}
+	return isu
+}
+
+// HUD returns the HUD article content summarising the report
+func (rep *goTestReport) HUD() (heading htm.IElement, content []htm.Element) {
+	heading = htm.Textf("Tests ( %d passed, %d failed, %d skipped, %s )",
+		rep.Count("pass"), rep.Count("fail"), rep.Count("skip"), rep.Elapsed())
+
+	for i, t := range rep.Failed() {
+		if i >= maxTestsHUD {
+			content = append(content, htm.Textf("... %d more failed tests", len(rep.Failed())-i))
+			break
+		}
+		content = append(content, htm.Span(nil,
+			htm.StrongText("FAIL"),
+			htm.Textf(" %s ( %s )", t.Name, t.Elapsed),
+		))
+	}
+
+	slowest := rep.Slowest(maxTestsHUD)
+	if len(slowest) != 0 {
+		l := []htm.IElement{htm.Text("Slowest:")}
+		for _, t := range slowest {
+			l = append(l, htm.Textf(" %s ( %s )", t.Name, t.Elapsed))
+		}
+		content = append(content, htm.Span(nil, l...))
+	}
+	return heading, content
+}
+
+// goTestWriter parses the output of `go test -json`.
+// The test output is written to Output and other output e.g. build errors,
+// is written to Issues as well.
+type goTestWriter struct {
+	Report *goTestReport
+	Output mg.OutputStream
+	Issues *mg.IssueOut
+}
+
+func (w *goTestWriter) Write(ln []byte) (int, error) {
+	s, inPkg := w.Report.ParseLine(ln)
+	if s == "" {
+		return len(ln), nil
+	}
+	if !inPkg {
+		w.Issues.Write([]byte(s))
+	}
+	if _, err := w.Output.Write([]byte(s)); err != nil {
+		return 0, err
+	}
+	return len(ln), nil
+}
+
+func (w *goTestWriter) Flush() error {
+	return w.Output.Flush()
+}
+
+// Close flushes the output, but doesn't close the underlying streams
+func (w *goTestWriter) Close() error {
+	w.Issues.Flush()
+	return w.Output.Flush()
+}
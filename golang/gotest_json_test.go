@@ -0,0 +1,101 @@
+package golang
+
+import (
+	"strings"
+	"testing"
+)
+
+const goTestJSONOutput = `# example.com/p
+{"Action":"output","Package":"example.com/p","Test":"TestPass","Output":"=== RUN   TestPass\n"}
+{"Action":"output","Package":"example.com/p","Test":"TestPass","Output":"--- PASS: TestPass (0.00s)\n"}
+{"Action":"pass","Package":"example.com/p","Test":"TestPass","Elapsed":0}
+{"Action":"output","Package":"example.com/p","Test":"TestFail","Output":"=== RUN   TestFail\n"}
+{"Action":"output","Package":"example.com/p","Test":"TestFail","Output":"    x_test.go:8: got 1,\n"}
+{"Action":"output","Package":"example.com/p","Test":"TestFail","Output":"        want 2\n"}
+{"Action":"output","Package":"example.com/p","Test":"TestFail","Output":"--- FAIL: TestFail (0.00s)\n"}
+{"Action":"fail","Package":"example.com/p","Test":"TestFail","Elapsed":0}
+{"Action":"output","Package":"example.com/p","Test":"TestSub","Output":"=== RUN   TestSub\n"}
+{"Action":"output","Package":"example.com/p","Test":"TestSub/a","Output":"=== RUN   TestSub/a\n"}
+{"Action":"output","Package":"example.com/p","Test":"TestSub/a","Output":"--- PASS: TestSub/a (0.00s)\n"}
+{"Action":"pass","Package":"example.com/p","Test":"TestSub/a","Elapsed":0}
+{"Action":"output","Package":"example.com/p","Test":"TestSub/b","Output":"=== RUN   TestSub/b\n"}
+{"Action":"output","Package":"example.com/p","Test":"TestSub/b","Output":"    x_test.go:13: boom\n"}
+{"Action":"output","Package":"example.com/p","Test":"TestSub/b","Output":"--- FAIL: TestSub/b (0.00s)\n"}
+{"Action":"fail","Package":"example.com/p","Test":"TestSub/b","Elapsed":0}
+{"Action":"output","Package":"example.com/p","Test":"TestSub","Output":"--- FAIL: TestSub (0.00s)\n"}
+{"Action":"fail","Package":"example.com/p","Test":"TestSub","Elapsed":0}
+{"Action":"output","Package":"example.com/p","Test":"TestSkip","Output":"=== RUN   TestSkip\n"}
+{"Action":"output","Package":"example.com/p","Test":"TestSkip","Output":"    x_test.go:16: later\n"}
+{"Action":"output","Package":"example.com/p","Test":"TestSkip","Output":"--- SKIP: TestSkip (0.00s)\n"}
+{"Action":"skip","Package":"example.com/p","Test":"TestSkip","Elapsed":0}
+{"Action":"output","Package":"example.com/p","Test":"TestPanic","Output":"=== RUN   TestPanic\n"}
+{"Action":"output","Package":"example.com/p","Test":"TestPanic","Output":"--- FAIL: TestPanic (0.00s)\n"}
+{"Action":"output","Package":"example.com/p","Test":"TestPanic","Output":"panic: assignment to entry in nil map [recovered, repanicked]\n"}
+{"Action":"output","Package":"example.com/p","Test":"TestPanic","Output":"\n"}
+{"Action":"output","Package":"example.com/p","Test":"TestPanic","Output":"goroutine 12 [running]:\n"}
+{"Action":"output","Package":"example.com/p","Test":"TestPanic","Output":"testing.tRunner.func1.2({0x6b7490, 0x6ef100})\n"}
+{"Action":"output","Package":"example.com/p","Test":"TestPanic","Output":"\t/usr/local/go/src/testing/testing.go:2123 +0x232\n"}
+{"Action":"output","Package":"example.com/p","Test":"TestPanic","Output":"testing.tRunner.func1()\n"}
+{"Action":"output","Package":"example.com/p","Test":"TestPanic","Output":"\t/usr/local/go/src/testing/testing.go:2126 +0x329\n"}
+{"Action":"output","Package":"example.com/p","Test":"TestPanic","Output":"panic({0x6b7490?, 0x6ef100?})\n"}
+{"Action":"output","Package":"example.com/p","Test":"TestPanic","Output":"\t/usr/local/go/src/runtime/panic.go:859 +0x125\n"}
+{"Action":"output","Package":"example.com/p","Test":"TestPanic","Output":"example.com/p.TestPanic(0x3ce17b6e2fc8?)\n"}
+{"Action":"output","Package":"example.com/p","Test":"TestPanic","Output":"\t/src/p/x_test.go:20 +0x28\n"}
+{"Action":"output","Package":"example.com/p","Test":"TestPanic","Output":"testing.tRunner(0x3ce17b6e2fc8, 0x6d4e80)\n"}
+{"Action":"output","Package":"example.com/p","Test":"TestPanic","Output":"\t/usr/local/go/src/testing/testing.go:2193 +0xea\n"}
+{"Action":"output","Package":"example.com/p","Test":"TestPanic","Output":"created by testing.(*T).Run in goroutine 1\n"}
+{"Action":"output","Package":"example.com/p","Test":"TestPanic","Output":"\t/usr/local/go/src/testing/testing.go:2258 +0x4d4\n"}
+{"Action":"fail","Package":"example.com/p","Test":"TestPanic","Elapsed":0}
+{"Action":"output","Package":"example.com/p","Output":"FAIL\texample.com/p\t0.006s\n"}
+{"Action":"fail","Package":"example.com/p","Elapsed":0.006}
+`
+
+func TestGoTestJSON(t *testing.T) {
+	rep := parseGoTestJSON(strings.NewReader(goTestJSONOutput))
+	counts := map[string]int{"pass": 2, "fail": 4, "skip": 1}
+	for act, n := range counts {
+		if got := rep.Count(act); got != n {
+			t.Errorf("Count(%q): expected %d, got %d", act, n, got)
+		}
+	}
+
+	failed := []string{}
+	for _, r := range rep.Failed() {
+		failed = append(failed, r.Name)
+	}
+	if s := strings.Join(failed, " "); s != "TestFail TestSub/b TestPanic" {
+		t.Errorf("Failed(): expected TestFail TestSub/b TestPanic, got %s", s)
+	}
+
+	type issue struct {
+		Row int
+		Msg string
+	}
+	expect := []issue{
+		{7, "TestFail: got 1,\nwant 2"},
+		{12, "TestSub/b: boom"},
+		{19, "TestPanic: panic: assignment to entry in nil map [recovered, repanicked]"},
+	}
+	got := []issue{}
+	for _, r := range rep.Failed() {
+		for _, isu := range goTestOutputIssues(r, "/src/p") {
+			if isu.Path != "/src/p/x_test.go" || isu.Label != goTestLabel {
+				t.Errorf("unexpected issue %#v", isu)
+			}
+			got = append(got, issue{isu.Row, isu.Message})
+		}
+	}
+	if len(got) != len(expect) {
+		t.Fatalf("expected issues %v, got %v", expect, got)
+	}
+	for i, e := range expect {
+		if got[i] != e {
+			t.Errorf("expected issue %v, got %v", e, got[i])
+		}
+	}
+
+	out, inPkg := rep.ParseLine([]byte("# example.com/p"))
+	if out != "# example.com/p\n" || inPkg {
+		t.Errorf("ParseLine: expected non-JSON output to be returned as-is, got %q, %v", out, inPkg)
+	}
+}
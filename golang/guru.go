@@ -160,9 +160,10 @@ func (g *Guru) definition(bx *mg.CmdCtx) {
 		fn = v.Name
 	}
 	bx.Store.Dispatch(mg.Activate{
-		Path: fn,
-		Row:  n(m[2]),
-		Col:  n(m[3]),
+		Path:   fn,
+		Row:    n(m[2]),
+		Col:    n(m[3]),
+		Cookie: bx.Cookie,
 	})
 }
 
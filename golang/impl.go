@@ -0,0 +1,337 @@
+package golang
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"margo.sh/golang/goutil"
+	kim "margo.sh/kimporter"
+	"margo.sh/mg"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+func init() {
+	mg.DefaultReducers.Before(&implCmd{})
+}
+
+// implCmd implements the `golang.impl` builtin command.
+//
+// It adds stubs for the methods of an interface that are not implemented by the type under the cursor.
+// The interface is named by the first prompt, or the first argument, in the form `io.Reader`,
+// `net/http.Handler` or `Iface` for interfaces declared in the current package.
+type implCmd struct{ mg.ReducerType }
+
+func (ic *implCmd) RCond(mx *mg.Ctx) bool {
+	return mx.LangIs(mg.Go)
+}
+
+func (ic *implCmd) Reduce(mx *mg.Ctx) *mg.State {
+	switch mx.Action.(type) {
+	case mg.QueryUserCmds:
+		return mx.AddUserCmds(mg.UserCmd{
+			Title:   "Implement Interface",
+			Name:    "golang.impl",
+			Desc:    "Add stubs for the interface methods not implemented by the selected type",
+			Prompts: []string{"Interface e.g. io.Reader"},
+		})
+	case mg.RunCmd:
+		return mx.AddBuiltinCmds(mg.BuiltinCmd{
+			Name: "golang.impl",
+			Desc: "Add stubs for the interface methods not implemented by the selected type. Usage: golang.impl [interface]",
+			Run:  ic.run,
+		})
+	}
+	return mx.State
+}
+
+func (ic *implCmd) run(cx *mg.CmdCtx) *mg.State {
+	go ic.impl(cx)
+	return cx.State
+}
+
+func (ic *implCmd) impl(cx *mg.CmdCtx) {
+	defer cx.Output.Close()
+
+	iface := ""
+	if len(cx.Args) != 0 {
+		iface = cx.Args[0]
+	}
+	if len(cx.Prompts) != 0 {
+		iface = cx.Prompts[0]
+	}
+	iface = strings.TrimSpace(iface)
+	if iface == "" {
+		fmt.Fprintln(cx.Output, "golang.impl: no interface specified")
+		return
+	}
+
+	v := cx.View
+	src, names, err := ic.stubs(cx.Ctx, iface)
+	if err != nil {
+		fmt.Fprintln(cx.Output, "golang.impl:", err)
+		return
+	}
+	if len(names) == 0 {
+		fmt.Fprintf(cx.Output, "golang.impl: all the methods of %s are already implemented\n", iface)
+		return
+	}
+	cx.Store.Dispatch(viewSrcEdit{
+		Title: "golang.impl",
+		Name:  v.Name,
+		Hash:  v.Hash,
+		Src:   src,
+	})
+	fmt.Fprintf(cx.Output, "golang.impl: added %s\n", strings.Join(names, ", "))
+}
+
+// stubs returns the view's src updated with stubs for the methods of iface
+// not implemented by the type under the cursor, and the names of the methods added
+func (ic *implCmd) stubs(mx *mg.Ctx, iface string) (src []byte, names []string, err error) {
+	ti, err := typChkR.info(mx)
+	if err != nil {
+		return nil, nil, err
+	}
+	tn, ok := ti.Obj.(*types.TypeName)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s is not a type", ti.Obj.Name())
+	}
+	named, ok := tn.Type().(*types.Named)
+	if !ok || types.IsInterface(named) {
+		return nil, nil, fmt.Errorf("%s is not a concrete named type", tn.Name())
+	}
+	if tn.Pkg() == nil || ti.Pkg.Fset.Position(tn.Pos()).Filename == "" {
+		return nil, nil, fmt.Errorf("cannot find the declaration of %s", tn.Name())
+	}
+
+	v := mx.View
+	src, err = v.ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	pf := goutil.ParseFile(mx, v.Filename(), src)
+	if pf.AstFile == goutil.NilAstFile {
+		return nil, nil, fmt.Errorf("cannot parse %s: %v", v.Basename(), pf.Error)
+	}
+
+	itn, err := ic.lookupIface(mx, pf.AstFile, tn.Pkg(), iface)
+	if err != nil {
+		return nil, nil, err
+	}
+	it := itn.Type().Underlying().(*types.Interface)
+
+	recvName, ptr := ic.recv(named)
+	recvType := tn.Name()
+	if ptr {
+		recvType = "*" + recvType
+	}
+
+	qf, imps := ic.qualifier(pf.AstFile, tn.Pkg())
+	ifaceName := types.TypeString(itn.Type(), qf)
+	stubs := &bytes.Buffer{}
+	for i := 0; i < it.NumMethods(); i++ {
+		m := it.Method(i)
+		if !m.Exported() && m.Pkg() != tn.Pkg() {
+			return nil, nil, fmt.Errorf("%s has the unexported method %s, it cannot be implemented outside package %s",
+				iface, m.Name(), m.Pkg().Name())
+		}
+		obj, _, _ := types.LookupFieldOrMethod(types.NewPointer(named), false, tn.Pkg(), m.Name())
+		if obj != nil {
+			if _, isMeth := obj.(*types.Func); !isMeth {
+				return nil, nil, fmt.Errorf("%s has a field named %s, it cannot have a method with the same name", tn.Name(), m.Name())
+			}
+			continue
+		}
+
+		sig := ic.renameParams(m.Type().(*types.Signature), recvName)
+		fmt.Fprintf(stubs, "\n// %s implements %s\n", m.Name(), ifaceName)
+		fmt.Fprintf(stubs, "func (%s %s) %s", recvName, recvType, m.Name())
+		types.WriteSignature(stubs, sig, qf)
+		fmt.Fprintf(stubs, " {\n\tpanic(\"not implemented\")\n}\n")
+		names = append(names, m.Name())
+	}
+	if len(names) == 0 {
+		return src, nil, nil
+	}
+
+	ofs := ic.insertOffset(pf, src, tn.Name(), ti.Pkg.Fset.Position(tn.Pos()))
+	buf := &bytes.Buffer{}
+	buf.Write(src[:ofs])
+	if ofs == len(src) && ofs != 0 && src[ofs-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+	buf.Write(stubs.Bytes())
+	buf.Write(src[ofs:])
+
+	src, _, err = (*imps).mergeWithSrc(v.Filename(), buf.Bytes())
+	if err != nil {
+		return nil, nil, err
+	}
+	return src, names, nil
+}
+
+// insertOffset returns the offset in src at which to insert the stubs for the type typName declared at declPos.
+//
+// The stubs are inserted after the type's last method in the file,
+// or after its declaration, otherwise they're appended to the file.
+func (ic *implCmd) insertOffset(pf *goutil.ParsedFile, src []byte, typName string, declPos token.Position) int {
+	var end token.Pos
+	for _, d := range pf.AstFile.Decls {
+		switch d := d.(type) {
+		case *ast.GenDecl:
+			tf := pf.TokenFile
+			if d.Tok == token.TYPE && declPos.Filename == tf.Name() &&
+				tf.Offset(d.Pos()) <= declPos.Offset && declPos.Offset <= tf.Offset(d.End()) && d.End() > end {
+				end = d.End()
+			}
+		case *ast.FuncDecl:
+			if d.Recv != nil && len(d.Recv.List) != 0 && symbolsRecvName(d.Recv.List[0].Type) == typName && d.End() > end {
+				end = d.End()
+			}
+		}
+	}
+	if end == token.NoPos {
+		return len(src)
+	}
+	ofs := pf.TokenFile.Offset(end)
+	if i := bytes.IndexByte(src[ofs:], '\n'); i >= 0 {
+		return ofs + i + 1
+	}
+	return len(src)
+}
+
+// lookupIface finds the interface named name e.g. `io.Reader`
+func (ic *implCmd) lookupIface(mx *mg.Ctx, af *ast.File, pkg *types.Package, name string) (*types.TypeName, error) {
+	pkgPath, typName := "", name
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		pkgPath, typName = name[:i], name[i+1:]
+	}
+
+	scope := pkg.Scope()
+	if pkgPath != "" {
+		ipath := ic.importPath(mx, af, pkgPath)
+		kp, err := kim.New(mx, nil).ImportPackage(ipath, mx.View.Dir())
+		if err != nil {
+			return nil, fmt.Errorf("cannot import `%s`: %s", ipath, err)
+		}
+		scope = kp.Scope()
+	}
+
+	obj := scope.Lookup(typName)
+	if obj == nil && pkgPath == "" {
+		// e.g. `error`
+		obj = types.Universe.Lookup(typName)
+	}
+	tn, _ := obj.(*types.TypeName)
+	if tn == nil || !types.IsInterface(tn.Type()) {
+		return nil, fmt.Errorf("`%s` is not an interface", name)
+	}
+	return tn, nil
+}
+
+// importPath returns the import path of the package named pkg.
+// If pkg is not an import path, it's resolved using the file's imports and the list of known packages.
+func (ic *implCmd) importPath(mx *mg.Ctx, af *ast.File, pkg string) string {
+	if strings.Contains(pkg, "/") {
+		return pkg
+	}
+	for _, spec := range af.Imports {
+		ipath, _ := strconv.Unquote(spec.Path.Value)
+		nm := path.Base(ipath)
+		if spec.Name != nil {
+			nm = spec.Name.Name
+		}
+		if nm == pkg {
+			return ipath
+		}
+	}
+	if ipath := mctl.importPathByName(pkg, mx.View.Dir()); ipath != "" {
+		return ipath
+	}
+	// it might be a std package that hasn't been scanned yet
+	return pkg
+}
+
+// recv returns the receiver name and whether or not the receiver should be a pointer
+// based on the type's existing methods
+func (ic *implCmd) recv(named *types.Named) (name string, ptr bool) {
+	ptr = true
+	for i := 0; i < named.NumMethods(); i++ {
+		sig := named.Method(i).Type().(*types.Signature)
+		r := sig.Recv()
+		if r == nil {
+			continue
+		}
+		_, ptr = r.Type().(*types.Pointer)
+		if nm := r.Name(); nm != "" && nm != "_" {
+			return nm, ptr
+		}
+	}
+	r, _ := utf8.DecodeRuneInString(named.Obj().Name())
+	return string(unicode.ToLower(r)), ptr
+}
+
+// renameParams returns sig with its params and results renamed if their names collide with the receiver name recv
+func (ic *implCmd) renameParams(sig *types.Signature, recv string) *types.Signature {
+	names := map[string]bool{}
+	collides := false
+	for _, t := range []*types.Tuple{sig.Params(), sig.Results()} {
+		for i := 0; i < t.Len(); i++ {
+			nm := t.At(i).Name()
+			names[nm] = true
+			collides = collides || nm == recv
+		}
+	}
+	if !collides {
+		return sig
+	}
+
+	name := recv
+	for i := 1; names[name]; i++ {
+		name = recv + strconv.Itoa(i)
+	}
+	rename := func(t *types.Tuple) *types.Tuple {
+		vars := make([]*types.Var, t.Len())
+		for i := range vars {
+			v := t.At(i)
+			if v.Name() == recv {
+				v = types.NewParam(v.Pos(), v.Pkg(), name, v.Type())
+			}
+			vars[i] = v
+		}
+		return types.NewTuple(vars...)
+	}
+	return types.NewSignature(nil, rename(sig.Params()), rename(sig.Results()), sig.Variadic())
+}
+
+// qualifier returns a types.Qualifier for the file af in package pkg.
+// Packages are named as they're imported in af, and imps is updated with those that need to be imported.
+func (ic *implCmd) qualifier(af *ast.File, pkg *types.Package) (types.Qualifier, *impSpecList) {
+	names := map[string]string{}
+	for _, spec := range af.Imports {
+		ipath, _ := strconv.Unquote(spec.Path.Value)
+		if spec.Name != nil {
+			names[ipath] = spec.Name.Name
+		}
+	}
+	imps := &impSpecList{}
+	qf := func(p *types.Package) string {
+		if p == pkg || p.Path() == pkg.Path() {
+			return ""
+		}
+		ipath := tcUnvendorPath(p.Path())
+		if nm, ok := names[ipath]; ok {
+			return nm
+		}
+		if imp := (impSpec{Path: ipath}); !imps.contains(imp) {
+			*imps = append(*imps, imp)
+		}
+		return p.Name()
+	}
+	return qf, imps
+}
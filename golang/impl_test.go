@@ -0,0 +1,42 @@
+package golang
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestImplStubs(t *testing.T) {
+	mx, dir, cleanup := testModule(t, map[string]string{
+		"a/a.go": "package a\n\ntype T struct{}\n\ntype I interface {\n\tM(t int) (t1 string)\n}\n",
+	})
+	defer cleanup()
+	mx = testView(t, mx, dir, "a/a.go", "type |T struct")
+
+	tests := []struct {
+		iface string
+		want  []string
+	}{
+		{"error", []string{"func (t *T) Error() string {"}},
+		{"I", []string{"func (t *T) M(t2 int) (t1 string) {"}},
+		{"io.Reader", []string{"import (\n\t\"io\"\n)", "func (t *T) Read(p []byte) (n int, err error) {"}},
+	}
+	for _, tt := range tests {
+		src, names, err := (&implCmd{}).stubs(mx, tt.iface)
+		if err != nil {
+			t.Errorf("stubs(%s) failed: %s", tt.iface, err)
+			continue
+		}
+		if len(names) != 1 {
+			t.Errorf("stubs(%s) added %v, want 1 method", tt.iface, names)
+		}
+		for _, s := range tt.want {
+			if !strings.Contains(string(src), s) {
+				t.Errorf("stubs(%s) = \n%s\nwant it to contain %q", tt.iface, src, s)
+			}
+		}
+	}
+
+	if _, _, err := (&implCmd{}).stubs(mx, "int"); err == nil {
+		t.Errorf("stubs(int) should fail")
+	}
+}
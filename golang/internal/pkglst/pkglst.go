@@ -117,6 +117,35 @@ func (cc *Cache) PruneDir(dir string) {
 	cc.view = cc.view.PruneDir(dir)
 }
 
+// Refresh reloads the packages in the list of directories dirs e.g. after they changed on disk.
+// Packages that no longer exist are removed, and directories that are not in the list are ignored.
+func (cc *Cache) Refresh(mx *mg.Ctx, dirs ...string) {
+	vu := cc.View()
+	lst := []*gopkg.Pkg{}
+	stale := []string{}
+	for _, dir := range dirs {
+		dir = filepath.Clean(dir)
+		if _, exists := vu.ByDir[dir]; !exists {
+			continue
+		}
+		stale = append(stale, dir)
+		if p, err := gopkg.ImportDirNd(mx, mx.VFS.Poke(dir)); err == nil {
+			lst = append(lst, p)
+		}
+	}
+	if len(stale) == 0 {
+		return
+	}
+
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	for _, dir := range stale {
+		cc.view = cc.view.PruneDir(dir)
+	}
+	cc.view = cc.view.Add(lst...)
+}
+
 func (cc *Cache) Add(l ...gopkg.Pkg) {
 	x := make([]*gopkg.Pkg, len(l))
 	for i, p := range l {
@@ -64,6 +64,15 @@ type marGocodeCtl struct {
 
 	mxQ *mgutil.ChanQ
 
+	// refresh holds the directories to refresh in plst after VFSChanged.
+	// Unlike mxQ, it never drops changes: pending directories are merged, see queueRefresh.
+	refresh struct {
+		sync.Mutex
+		mx   *mg.Ctx
+		dirs map[string]bool
+		c    chan struct{}
+	}
+
 	mu     sync.RWMutex
 	mgcctl MarGocodeCtl
 	pkgs   *mgcCache
@@ -161,6 +170,83 @@ func (mgc *marGocodeCtl) processQ(mx *mg.Ctx) {
 	}
 }
 
+// queueRefresh queues the refresh of the packages in dirs, in plst.
+// If a refresh is already pending, dirs are added to it.
+func (mgc *marGocodeCtl) queueRefresh(mx *mg.Ctx, dirs []string) {
+	mgc.refresh.Lock()
+	mgc.refresh.mx = mx
+	for _, dir := range dirs {
+		mgc.refresh.dirs[dir] = true
+	}
+	mgc.refresh.Unlock()
+
+	select {
+	case mgc.refresh.c <- struct{}{}:
+	default:
+	}
+}
+
+// refreshLoop refreshes the directories queued by queueRefresh
+func (mgc *marGocodeCtl) refreshLoop() {
+	for range mgc.refresh.c {
+		mgc.refresh.Lock()
+		mx, dirs := mgc.refresh.mx, mgc.refresh.dirs
+		mgc.refresh.mx, mgc.refresh.dirs = nil, map[string]bool{}
+		mgc.refresh.Unlock()
+
+		if len(dirs) == 0 {
+			continue
+		}
+		l := make([]string, 0, len(dirs))
+		for dir := range dirs {
+			l = append(l, dir)
+		}
+		sort.Strings(l)
+		func() {
+			defer func() { recover() }()
+			mgc.plst.Refresh(mx, l...)
+		}()
+	}
+}
+
+// changedDirs returns the list of directories that might contain packages affected by the changes to paths
+func (mgc *marGocodeCtl) changedDirs(paths []string) []string {
+	seen := map[string]bool{}
+	dirs := []string{}
+	add := func(dir string) {
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	for _, p := range paths {
+		add(filepath.Dir(p))
+		if filepath.Ext(p) != ".go" {
+			// it might be a package directory
+			add(p)
+		}
+	}
+	return dirs
+}
+
+// pruneChanged removes the cached packages in the directories affected by the changes to paths
+func (mgc *marGocodeCtl) pruneChanged(paths []string) {
+	dirs := map[string]bool{}
+	for _, dir := range mgc.changedDirs(paths) {
+		dirs[dir] = true
+	}
+	keys := []mgcCacheKey{}
+	mgc.pkgs.forEach(func(e mgcCacheEnt) bool {
+		if dirs[e.Key.Dir] {
+			keys = append(keys, e.Key)
+		}
+		return true
+	})
+	for _, k := range keys {
+		mgc.pkgs.del(k)
+	}
+}
+
 func (mgc *marGocodeCtl) preloadPackages(mx *mg.Ctx) {
 	cfg := mgc.cfg()
 	if cfg.NoPreloading {
@@ -247,6 +333,9 @@ func newMarGocodeCtl() *marGocodeCtl {
 			mgc.processQ(v.(*mg.Ctx))
 		}
 	}()
+	mgc.refresh.dirs = map[string]bool{}
+	mgc.refresh.c = make(chan struct{}, 1)
+	go mgc.refreshLoop()
 	return mgc
 }
 
@@ -254,6 +343,9 @@ func (mgc *marGocodeCtl) RCond(mx *mg.Ctx) bool {
 	if mx.LangIs(mg.Go) {
 		return true
 	}
+	if _, ok := mx.Action.(mg.VFSChanged); ok {
+		return true
+	}
 	if act, ok := mx.Action.(mg.RunCmd); ok {
 		for _, c := range mgc.cmds() {
 			if c.Name == act.Name {
@@ -269,9 +361,14 @@ func (mgc *marGocodeCtl) RMount(mx *mg.Ctx) {
 }
 
 func (mgc *marGocodeCtl) Reduce(mx *mg.Ctx) *mg.State {
-	switch mx.Action.(type) {
+	switch act := mx.Action.(type) {
 	case mg.RunCmd:
 		return mx.AddBuiltinCmds(mgc.cmds()...)
+	case mg.VFSChanged:
+		// mxQ only keeps the latest actions, so changes made outside the editor are handled here
+		// pruning is cheap, but refreshing the package list might involve scanning directories
+		mgc.pruneChanged(act.Paths)
+		mgc.queueRefresh(mx, mgc.changedDirs(act.Paths))
 	case mg.ViewModified, mg.ViewSaved, mg.ViewActivated:
 		// ViewSaved is probably not required, but saving might result in a `go install`
 		// which results in an updated package.a file
@@ -586,6 +683,12 @@ type MarGocodeCtl struct {
 
 	// Whether or not to propose builtin types and functions
 	ProposeTests bool
+
+	// Don't rank completions by relevance
+	// By default, candidates that match the type expected at the cursor,
+	// are declared in the current or imported packages, or were recently used are listed first,
+	// and deprecated ones are listed last
+	NoRanking bool
 }
 
 func (mgc *MarGocodeCtl) RInit(mx *mg.Ctx) {
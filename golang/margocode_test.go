@@ -0,0 +1,27 @@
+package golang
+
+import (
+	"go/types"
+	"margo.sh/mg"
+	"path/filepath"
+	"testing"
+)
+
+func TestMarGocodeVFSChanged(t *testing.T) {
+	mgc := newMarGocodeCtl()
+	dir := filepath.FromSlash("/src/p")
+	key := mgcCacheKey{gsuPkgInfo: gsuPkgInfo{Path: "p", Dir: dir}}
+	pkg := types.NewPackage("p", "p")
+	pkg.MarkComplete()
+	mgc.pkgs.put(mgcCacheEnt{Key: key, Pkg: pkg})
+
+	mx := mg.NewTestingCtx(mg.VFSChanged{Paths: []string{filepath.Join(dir, "p.go")}})
+	defer mx.Cancel()
+	mgc.Reduce(mx)
+	// the ViewModified queued after the change must not prevent the package from being pruned
+	mgc.Reduce(mg.NewTestingCtx(mg.ViewModified{}))
+
+	if _, ok := mgc.pkgs.get(key); ok {
+		t.Errorf("package %s is still cached after a file in it changed", dir)
+	}
+}
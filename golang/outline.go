@@ -0,0 +1,261 @@
+package golang
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/printer"
+	"go/token"
+	"margo.sh/golang/goutil"
+	"margo.sh/mg"
+	"strconv"
+	"strings"
+)
+
+// Outline sets mg.State.Outline to the declarations in the current view
+// i.e. types (with their fields and methods), funcs, vars and consts, so editors can display them in a side panel.
+//
+// It also adds a UserCmd for each declaration that goes to it,
+// and the builtin command `golang.outline` that prints the outline.
+type Outline struct {
+	mg.ReducerType
+
+	key   outlineKey
+	items []mg.OutlineItem
+}
+
+// outlineKey identifies the src of a view
+type outlineKey struct {
+	view mg.ViewKey
+	fn   string
+	hash string
+}
+
+func (ol *Outline) RCond(mx *mg.Ctx) bool {
+	return mx.LangIs(mg.Go)
+}
+
+func (ol *Outline) Reduce(mx *mg.Ctx) *mg.State {
+	st := mx.State.SetOutline(ol.outline(mx))
+	switch mx.Action.(type) {
+	case mg.QueryUserCmds:
+		return st.AddUserCmds(ol.userCmds(st.Outline, "")...)
+	case mg.RunCmd:
+		return st.AddBuiltinCmds(mg.BuiltinCmd{
+			Name: "golang.outline",
+			Desc: "Print the outline of the current file. Usage: golang.outline [-goto=line:col]",
+			Run:  ol.run,
+		})
+	}
+	return st
+}
+
+// outline returns the outline of the current view.
+// It's only rebuilt when the view changes e.g. after ViewModified.
+func (ol *Outline) outline(mx *mg.Ctx) []mg.OutlineItem {
+	v := mx.View
+	key := outlineKey{view: mx.ViewKey(), fn: v.Filename(), hash: v.Hash}
+	if key == ol.key {
+		return ol.items
+	}
+	src, _ := v.ReadAll()
+	pf := goutil.ParseFile(mx, v.Filename(), src)
+	ol.key, ol.items = key, outlineDecls(pf.Fset, pf.AstFile)
+	return ol.items
+}
+
+func (ol *Outline) userCmds(items []mg.OutlineItem, parent string) []mg.UserCmd {
+	var cmds []mg.UserCmd
+	for _, it := range items {
+		name := it.Name
+		if parent != "" {
+			name = parent + "." + name
+		}
+		cmds = append(cmds, mg.UserCmd{
+			Title: fmt.Sprintf("Outline: %s %s", it.Kind, name),
+			Name:  "golang.outline",
+			Desc:  it.Detail,
+			Args:  []string{fmt.Sprintf("-goto=%d:%d", it.Row+1, it.Col+1)},
+		})
+		cmds = append(cmds, ol.userCmds(it.Children, name)...)
+	}
+	return cmds
+}
+
+func (ol *Outline) run(cx *mg.CmdCtx) *mg.State {
+	go ol.print(cx, cx.State.Outline)
+	return cx.State
+}
+
+func (ol *Outline) print(cx *mg.CmdCtx, items []mg.OutlineItem) {
+	defer cx.Output.Close()
+
+	fs := cx.Flags()
+	gotoPos := fs.String("goto", "", "Go to the location line:col in the current file instead of printing the outline")
+	if err := fs.Parse(); err != nil {
+		fmt.Fprintln(cx.Output, "golang.outline:", err)
+		return
+	}
+
+	v := cx.View
+	if *gotoPos != "" {
+		l := strings.Split(*gotoPos, ":")
+		line, col := 0, 0
+		if len(l) == 2 {
+			line, _ = strconv.Atoi(l[0])
+			col, _ = strconv.Atoi(l[1])
+		}
+		if line < 1 || col < 1 {
+			fmt.Fprintf(cx.Output, "golang.outline: invalid location `%s`, expected line:col\n", *gotoPos)
+			return
+		}
+		cx.Store.Dispatch(mg.Activate{Path: v.Path, Name: v.Name, Row: line - 1, Col: col - 1})
+		return
+	}
+
+	fn := v.ShortFn(cx.Env)
+	var printItems func(l []mg.OutlineItem, indent string)
+	printItems = func(l []mg.OutlineItem, indent string) {
+		for _, it := range l {
+			fmt.Fprintf(cx.Output, "%s%s:%d:%d: %s %s %s\n", indent, fn, it.Row+1, it.Col+1, it.Kind, it.Name, it.Detail)
+			printItems(it.Children, indent+"\t")
+		}
+	}
+	printItems(items, "")
+}
+
+// outlineDecls returns the outline of the declarations in af.
+// Methods are nested inside their receiver's type if it's declared in af.
+func outlineDecls(fset *token.FileSet, af *ast.File) []mg.OutlineItem {
+	if af == nil {
+		return nil
+	}
+	ob := outlineBuilder{fset: fset}
+	items := []mg.OutlineItem{}
+	typeIdx := map[string]int{}
+	var methods []*ast.FuncDecl
+	for _, d := range af.Decls {
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			if d.Recv != nil && len(d.Recv.List) != 0 {
+				methods = append(methods, d)
+				continue
+			}
+			items = append(items, ob.item(d.Name, "func", ob.expr(d.Type), d))
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					typeIdx[spec.Name.Name] = len(items)
+					items = append(items, ob.typeItem(spec))
+				case *ast.ValueSpec:
+					kind := "var"
+					if d.Tok == token.CONST {
+						kind = "const"
+					}
+					for _, id := range spec.Names {
+						items = append(items, ob.item(id, kind, ob.expr(spec.Type), spec))
+					}
+				}
+			}
+		}
+	}
+	for _, d := range methods {
+		it := ob.item(d.Name, "method", ob.expr(d.Type), d)
+		recv := sigRecvExprName(d.Recv.List[0].Type)
+		if i, ok := typeIdx[recv]; ok {
+			items[i].Children = append(items[i].Children, it)
+			continue
+		}
+		if recv != "" {
+			it.Name = recv + "." + it.Name
+		}
+		items = append(items, it)
+	}
+	return items
+}
+
+type outlineBuilder struct {
+	fset *token.FileSet
+}
+
+func (ob outlineBuilder) item(id *ast.Ident, kind, detail string, decl ast.Node) mg.OutlineItem {
+	p := ob.fset.Position(id.Pos())
+	end := ob.fset.Position(decl.End())
+	return mg.OutlineItem{
+		Name:   id.Name,
+		Kind:   kind,
+		Detail: detail,
+		Row:    p.Line - 1,
+		Col:    p.Column - 1,
+		EndRow: end.Line - 1,
+		EndCol: end.Column - 1,
+	}
+}
+
+func (ob outlineBuilder) typeItem(spec *ast.TypeSpec) mg.OutlineItem {
+	switch t := spec.Type.(type) {
+	case *ast.StructType:
+		it := ob.item(spec.Name, "type", "struct", spec)
+		it.Children = ob.fields(t.Fields, "field")
+		return it
+	case *ast.InterfaceType:
+		it := ob.item(spec.Name, "type", "interface", spec)
+		it.Children = ob.fields(t.Methods, "method")
+		return it
+	}
+	detail := ob.expr(spec.Type)
+	if spec.Assign.IsValid() {
+		detail = "= " + detail
+	}
+	return ob.item(spec.Name, "type", detail, spec)
+}
+
+// fields returns the outline of the fields in fl.
+// Embedded fields are named after their type, and embedded interfaces are skipped.
+func (ob outlineBuilder) fields(fl *ast.FieldList, kind string) []mg.OutlineItem {
+	if fl == nil {
+		return nil
+	}
+	var items []mg.OutlineItem
+	for _, f := range fl.List {
+		detail := ob.expr(f.Type)
+		if len(f.Names) == 0 {
+			if kind == "method" {
+				continue
+			}
+			if id := outlineEmbeddedName(f.Type); id != nil {
+				items = append(items, ob.item(id, kind, detail, f))
+			}
+			continue
+		}
+		for _, id := range f.Names {
+			items = append(items, ob.item(id, kind, detail, f))
+		}
+	}
+	return items
+}
+
+// outlineEmbeddedName returns the name of the embedded field x e.g. `Buffer` in `*bytes.Buffer`
+func outlineEmbeddedName(x ast.Expr) *ast.Ident {
+	if sx, ok := x.(*ast.StarExpr); ok {
+		x = sx.X
+	}
+	switch t := x.(type) {
+	case *ast.Ident:
+		return t
+	case *ast.SelectorExpr:
+		return t.Sel
+	}
+	return nil
+}
+
+// expr returns the source of x on a single line
+func (ob outlineBuilder) expr(x ast.Expr) string {
+	if x == nil {
+		return ""
+	}
+	buf := &bytes.Buffer{}
+	printer.Fprint(buf, ob.fset, x)
+	return strings.Join(strings.Fields(buf.String()), " ")
+}
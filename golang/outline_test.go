@@ -0,0 +1,71 @@
+package golang
+
+import (
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+func TestOutlineDecls(t *testing.T) {
+	src := `package p
+
+type T struct {
+	A, B int
+	*bytes.Buffer
+}
+
+type I interface {
+	M() error
+	fmt.Stringer
+}
+
+const C = 1
+
+func (t *T) Len() int { return 0 }
+
+func F(s string) error { return nil }
+
+func (u U) X() {}
+`
+	fset := token.NewFileSet()
+	af, err := parser.ParseFile(fset, "p.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := outlineDecls(fset, af)
+	type item struct{ kind, name, detail string }
+	want := []item{
+		{"type", "T", "struct"},
+		{"type", "I", "interface"},
+		{"const", "C", ""},
+		{"func", "F", "func(s string) error"},
+		{"method", "U.X", "func()"},
+	}
+	if len(items) != len(want) {
+		t.Fatalf("expected %d items, got %d: %#v", len(want), len(items), items)
+	}
+	for i, w := range want {
+		it := items[i]
+		if got := (item{it.Kind, it.Name, it.Detail}); got != w {
+			t.Errorf("item %d is %#v, expected %#v", i, got, w)
+		}
+	}
+
+	children := func(i int) string {
+		l := []string{}
+		for _, c := range items[i].Children {
+			l = append(l, c.Kind+" "+c.Name)
+		}
+		return strings.Join(l, ", ")
+	}
+	if s, w := children(0), "field A, field B, field Buffer, method Len"; s != w {
+		t.Errorf("children of T are `%s`, expected `%s`", s, w)
+	}
+	if s, w := children(1), "method M"; s != w {
+		t.Errorf("children of I are `%s`, expected `%s`", s, w)
+	}
+	if it := items[0]; it.Row != 2 || it.Col != 5 || it.EndRow != 5 || it.EndCol != 1 {
+		t.Errorf("T is at %d:%d-%d:%d, expected 2:5-5:1", it.Row, it.Col, it.EndRow, it.EndCol)
+	}
+}
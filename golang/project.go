@@ -0,0 +1,70 @@
+package golang
+
+import (
+	"github.com/rogpeppe/go-internal/modfile"
+	"margo.sh/golang/gopkg"
+	"margo.sh/golang/goutil"
+	"margo.sh/mg"
+	"margo.sh/vfs"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// projectRoot returns the root directory of the project containing the package in dir.
+// In module mode, it's the directory containing go.mod, otherwise it's dir itself.
+func projectRoot(mx *mg.Ctx, dir string) string {
+	if nd := goutil.ModFileNd(mx, dir); nd != nil {
+		return filepath.Dir(nd.Path())
+	}
+	return dir
+}
+
+// projectImportPath returns the import path of the package in dir.
+// In module mode, it's derived from the module path declared in go.mod.
+func projectImportPath(mx *mg.Ctx, dir string) string {
+	if nd := goutil.ModFileNd(mx, dir); nd != nil {
+		src, _ := nd.ReadBlob().ReadFile()
+		modPath := modfile.ModulePath(src)
+		rel, err := filepath.Rel(filepath.Dir(nd.Path()), dir)
+		switch {
+		case modPath == "" || err != nil:
+		case rel == ".":
+			return modPath
+		default:
+			return path.Join(modPath, filepath.ToSlash(rel))
+		}
+	}
+	if p, _ := gopkg.ImportDir(mx, dir); p != nil {
+		return p.ImportPath
+	}
+	return ""
+}
+
+// projectPkgs returns the list of packages in the project rooted at root.
+// Packages in vendor directories and nested modules are ignored.
+func projectPkgs(mx *mg.Ctx, root string) []*gopkg.Pkg {
+	mu := sync.Mutex{}
+	pkgs := []*gopkg.Pkg{}
+	mx.VFS.Scan(root, vfs.ScanOptions{
+		Filter: func(de *vfs.Dirent) bool {
+			return de.Name() != "vendor" && gopkg.ScanFilter(de)
+		},
+		Dirs: func(nd *vfs.Node) {
+			dir := nd.Path()
+			if dir != root && projectRoot(mx, dir) != root {
+				return
+			}
+			p, err := gopkg.ImportDirNd(mx, nd)
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			pkgs = append(pkgs, p)
+			mu.Unlock()
+		},
+	})
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].Dir < pkgs[j].Dir })
+	return pkgs
+}
@@ -0,0 +1,534 @@
+package golang
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"margo.sh/golang/cursor"
+	"margo.sh/golang/gopkg"
+	"margo.sh/mg"
+	"margo.sh/mgutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+func init() {
+	mg.DefaultReducers.Before(&renameCmd{})
+}
+
+// renameCmd implements the `golang.rename` builtin command.
+//
+// It renames the identifier under the cursor and all its references in the package,
+// and for exported identifiers, its importers in the current project.
+// The new name is taken from the first prompt, or the first argument.
+// If the flag `-dry-run` is set, a diff of the changes is printed instead of applying them.
+type renameCmd struct{ mg.ReducerType }
+
+type renameFile struct {
+	Fn   string
+	Src  []byte
+	Dst  []byte
+	Refs int
+}
+
+func (rc *renameCmd) RCond(mx *mg.Ctx) bool {
+	return mx.LangIs(mg.Go)
+}
+
+func (rc *renameCmd) Reduce(mx *mg.Ctx) *mg.State {
+	switch mx.Action.(type) {
+	case mg.QueryUserCmds:
+		return mx.AddUserCmds(mg.UserCmd{
+			Title:   "Rename",
+			Name:    "golang.rename",
+			Desc:    "Rename the selected identifier and all its references",
+			Prompts: []string{"New name"},
+		})
+	case mg.RunCmd:
+		return mx.AddBuiltinCmds(mg.BuiltinCmd{
+			Name: "golang.rename",
+			Desc: "Rename the selected identifier and all its references. Usage: golang.rename [-dry-run] [new name]",
+			Run:  rc.run,
+		})
+	}
+	return mx.State
+}
+
+func (rc *renameCmd) run(cx *mg.CmdCtx) *mg.State {
+	go rc.rename(cx)
+	return cx.State
+}
+
+func (rc *renameCmd) rename(cx *mg.CmdCtx) {
+	defer cx.Output.Close()
+
+	fs := cx.Flags()
+	dryRun := fs.Bool("dry-run", false, "Print a diff of the changes instead of applying them")
+	if err := fs.Parse(); err != nil {
+		fmt.Fprintln(cx.Output, "golang.rename:", err)
+		return
+	}
+	name := fs.Arg(0)
+	if len(cx.Prompts) != 0 {
+		name = cx.Prompts[0]
+	}
+	name = strings.TrimSpace(name)
+
+	oldName, files, err := rc.edits(cx.Ctx, name)
+	if err != nil {
+		fmt.Fprintln(cx.Output, "golang.rename:", err)
+		return
+	}
+
+	nRefs := 0
+	for _, f := range files {
+		nRefs += f.Refs
+		if *dryRun {
+			fn := mgutil.ShortFn(f.Fn, cx.Env)
+			cx.Output.Write(mgutil.UnifiedDiff("a/"+fn, "b/"+fn, f.Src, f.Dst))
+		}
+	}
+	verb := "Would rename"
+	if !*dryRun {
+		verb = "Renamed"
+		if err := rc.apply(cx, files); err != nil {
+			fmt.Fprintln(cx.Output, "golang.rename:", err)
+			return
+		}
+	}
+	fmt.Fprintf(cx.Output, "golang.rename: %s %s to %s: %d references in %d files\n",
+		verb, oldName, name, nRefs, len(files))
+}
+
+// apply changes the active view and writes the other files.
+//
+// Nothing is changed unless none of the other files has unsaved changes in the editor,
+// and the files are only written after the active view's edit is accepted,
+// so the rename isn't half-applied if the view was changed in the meantime.
+func (rc *renameCmd) apply(cx *mg.CmdCtx, files []renameFile) error {
+	v := cx.View
+	var view *renameFile
+	for i, f := range files {
+		if f.Fn == v.Filename() {
+			view = &files[i]
+			continue
+		}
+		if cx.ViewIsDirty(f.Fn) {
+			return fmt.Errorf("%s has unsaved changes, save it first", mgutil.ShortFn(f.Fn, cx.Env))
+		}
+		if _, err := os.Stat(f.Fn); err != nil {
+			return err
+		}
+	}
+
+	if view != nil {
+		if err := rc.editView(cx, *view); err != nil {
+			return err
+		}
+		fmt.Fprintf(cx.Output, "golang.rename: %s: %d references (active view)\n", mgutil.ShortFn(view.Fn, cx.Env), view.Refs)
+	}
+	for _, f := range files {
+		if f.Fn == v.Filename() {
+			continue
+		}
+		if err := rc.writeFile(cx.Ctx, f); err != nil {
+			return fmt.Errorf("%s, the rename was only partially applied", err)
+		}
+		fmt.Fprintf(cx.Output, "golang.rename: %s: %d references\n", mgutil.ShortFn(f.Fn, cx.Env), f.Refs)
+	}
+	return nil
+}
+
+// editView replaces the src of the active view with f.Dst, and waits for the edit to be accepted
+func (rc *renameCmd) editView(cx *mg.CmdCtx, f renameFile) error {
+	v := cx.View
+	res := make(chan error, 1)
+	cx.Store.Dispatch(viewSrcEdit{
+		Title: "golang.rename",
+		Name:  v.Name,
+		Hash:  v.Hash,
+		Src:   f.Dst,
+		Res:   res,
+	})
+	select {
+	case err := <-res:
+		return err
+	case <-time.After(30 * time.Second):
+		return fmt.Errorf("timed out waiting for the active view to be updated")
+	}
+}
+
+func (rc *renameCmd) writeFile(mx *mg.Ctx, f renameFile) error {
+	defer mx.VFS.Invalidate(f.Fn)
+
+	fi, err := os.Stat(f.Fn)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(f.Fn, f.Dst, fi.Mode())
+}
+
+// edits returns the list of files changed by renaming the identifier under the cursor to name
+func (rc *renameCmd) edits(mx *mg.Ctx, name string) (oldName string, files []renameFile, err error) {
+	var id *ast.Ident
+	if !cursor.NewViewCurCtx(mx).Set(&id) {
+		return "", nil, fmt.Errorf("no identifier under the cursor")
+	}
+	switch {
+	case name == "":
+		return "", nil, fmt.Errorf("no new name specified")
+	case name == "_" || !token.IsIdentifier(name):
+		return "", nil, fmt.Errorf("`%s` is not a valid identifier", name)
+	}
+
+	ti, err := typChkR.info(mx)
+	if err != nil {
+		return "", nil, err
+	}
+	oldName = ti.Obj.Name()
+	if name == oldName {
+		return "", nil, fmt.Errorf("%s is already named %s", oldName, name)
+	}
+	if err := rc.checkPkg(mx, ti.Obj); err != nil {
+		return "", nil, err
+	}
+	refs, err := typChkR.findRefs(mx, ti)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := rc.checkDecl(mx, ti.Obj, refs); err != nil {
+		return "", nil, err
+	}
+	if err := rc.checkConflicts(ti, refs, name); err != nil {
+		return "", nil, err
+	}
+	if err := rc.checkImplements(ti.Obj, refs, name); err != nil {
+		return "", nil, err
+	}
+
+	offsets := map[string][]int{}
+	for _, r := range refs {
+		fn := r.Pos.Filename
+		offsets[fn] = append(offsets[fn], r.Pos.Offset)
+	}
+	fns := make([]string, 0, len(offsets))
+	for fn := range offsets {
+		fns = append(fns, fn)
+	}
+	sort.Strings(fns)
+
+	v := mx.View
+	for _, fn := range fns {
+		f := renameFile{Fn: fn}
+		if fn == v.Filename() {
+			f.Src, err = v.ReadAll()
+		} else {
+			f.Src, err = ioutil.ReadFile(fn)
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		f.Dst, f.Refs, err = rc.replace(f.Src, offsets[fn], oldName, name)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: %s", fn, err)
+		}
+		files = append(files, f)
+	}
+	return oldName, files, nil
+}
+
+// replace replaces the identifiers old at offsets in src with new
+func (rc *renameCmd) replace(src []byte, offsets []int, old, new string) ([]byte, int, error) {
+	sort.Ints(offsets)
+	buf := bytes.NewBuffer(make([]byte, 0, len(src)))
+	pos, n := 0, 0
+	for i, ofs := range offsets {
+		if i > 0 && ofs == offsets[i-1] {
+			continue
+		}
+		end := ofs + len(old)
+		if ofs < pos || end > len(src) || string(src[ofs:end]) != old {
+			return nil, 0, fmt.Errorf("the file was changed, please try again")
+		}
+		buf.Write(src[pos:ofs])
+		buf.WriteString(new)
+		pos = end
+		n++
+	}
+	buf.Write(src[pos:])
+	return buf.Bytes(), n, nil
+}
+
+// checkPkg returns an error if obj is declared in a package in GOROOT, the module cache or a vendor directory.
+// Such objects can't be renamed because only their references in the project would be changed.
+func (rc *renameCmd) checkPkg(mx *mg.Ctx, obj types.Object) error {
+	if obj.Pkg() == nil {
+		return fmt.Errorf("cannot rename %s: it's a builtin", obj.Name())
+	}
+	pp, err := gopkg.FindPkg(mx, obj.Pkg().Path(), mx.View.Dir())
+	switch {
+	case err != nil:
+		return nil
+	case pp.Goroot:
+		return fmt.Errorf("cannot rename %s: it's declared in GOROOT", obj.Name())
+	}
+	if where := rc.externalDir(mx, pp.Dir); where != "" {
+		return fmt.Errorf("cannot rename %s: it's declared in %s", obj.Name(), where)
+	}
+	return nil
+}
+
+// checkDecl returns an error if obj is not declared in the current project i.e. none of refs is its definition
+func (rc *renameCmd) checkDecl(mx *mg.Ctx, obj types.Object, refs []tcRef) error {
+	v := mx.View
+	dirs := map[string]bool{}
+	for _, p := range projectPkgs(mx, projectRoot(mx, v.Dir())) {
+		dirs[p.Dir] = true
+	}
+	for _, r := range refs {
+		if !r.Def {
+			continue
+		}
+		fn := r.Pos.Filename
+		dir := filepath.Dir(fn)
+		if where := rc.externalDir(mx, dir); where != "" {
+			return fmt.Errorf("cannot rename %s: it's declared in %s", obj.Name(), where)
+		}
+		if dirs[dir] || (v.Path == "" && fn == v.Filename()) {
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot rename %s: it's not declared in the current project", obj.Name())
+}
+
+// externalDir returns a description of where dir is if it's in GOROOT, the module cache or a vendor directory
+func (rc *renameCmd) externalDir(mx *mg.Ctx, dir string) string {
+	sep := string(filepath.Separator)
+	dir = filepath.Clean(dir) + sep
+	switch {
+	case strings.HasPrefix(dir, filepath.Clean(BuildContext(mx).GOROOT)+sep):
+		return "GOROOT"
+	case strings.Contains(dir, sep+"pkg"+sep+"mod"+sep):
+		return "the module cache"
+	case strings.Contains(dir, sep+"vendor"+sep):
+		return "a vendored package"
+	}
+	return ""
+}
+
+// checkConflicts reports whether renaming the references in refs to name would change the meaning of the program
+func (rc *renameCmd) checkConflicts(ti *tcInfo, refs []tcRef, name string) error {
+	obj := ti.Obj
+	if len(refs) == 0 {
+		return fmt.Errorf("no references to %s found", obj.Name())
+	}
+	if _, ok := obj.(*types.PkgName); ok {
+		hasDef := false
+		for _, r := range refs {
+			hasDef = hasDef || r.Def
+		}
+		if !hasDef {
+			return fmt.Errorf("cannot rename the implicitly named import %s", obj.Name())
+		}
+	}
+
+	conflict := func(r tcRef, x types.Object, why string) error {
+		xp := r.Pkg.Fset.Position(x.Pos())
+		if xp.IsValid() {
+			return fmt.Errorf("%s: renaming %s to %s would %s %s declared at %s",
+				r.Pos, obj.Name(), name, why, name, xp)
+		}
+		return fmt.Errorf("%s: renaming %s to %s would %s %s",
+			r.Pos, obj.Name(), name, why, x)
+	}
+
+	defPkgs := map[*types.Package]tcRef{}
+	for _, r := range refs {
+		pkg := r.Pkg.Package
+		if obj.Exported() && !ast.IsExported(name) && r.Pkg.Path() != obj.Pkg().Path() {
+			return fmt.Errorf("%s: %s is referenced from package %s so it must remain exported",
+				r.Pos, obj.Name(), r.Pkg.Path())
+		}
+
+		switch o := r.Obj.(type) {
+		case *types.Func:
+			sig, _ := o.Type().(*types.Signature)
+			if r.Def && sig != nil && sig.Recv() != nil {
+				if x, _, _ := types.LookupFieldOrMethod(sig.Recv().Type(), true, pkg, name); x != nil {
+					return conflict(r, x, "conflict with")
+				}
+				continue
+			}
+		case *types.Var:
+			if o.IsField() {
+				if r.Def {
+					if x := rc.fieldConflict(pkg, o, name); x != nil {
+						return conflict(r, x, "conflict with")
+					}
+				}
+				continue
+			}
+		}
+
+		par := r.Obj.Parent()
+		if par == nil || r.Obj.Pkg() != pkg {
+			continue
+		}
+		defPkgs[pkg] = r
+		if r.Def {
+			if x := par.Lookup(name); x != nil {
+				return conflict(r, x, "conflict with")
+			}
+			// package-level declarations also conflict with imports
+			if par == pkg.Scope() {
+				for i := 0; i < par.NumChildren(); i++ {
+					if x := par.Child(i).Lookup(name); x != nil {
+						return conflict(r, x, "conflict with")
+					}
+				}
+			}
+		}
+		s := pkg.Scope().Innermost(r.Id.Pos())
+		if s == nil {
+			continue
+		}
+		// is there a declaration named name between this reference and the declaration of obj
+		if xs, x := s.LookupParent(name, r.Id.Pos()); x != nil && scopeWithin(xs, par) {
+			return conflict(r, x, "be shadowed by")
+		}
+	}
+
+	// would uses of name, in the scope of obj, now refer to obj
+	for pkg, r := range defPkgs {
+		par := r.Obj.Parent()
+		for id, x := range r.Pkg.Info.Uses {
+			if id.Name != name || x.Parent() == nil {
+				continue
+			}
+			if par != pkg.Scope() && !par.Contains(id.Pos()) {
+				continue
+			}
+			if !scopeWithin(x.Parent(), par) {
+				xr := r
+				xr.Pos = r.Pkg.Fset.Position(id.Pos())
+				return conflict(xr, x, "shadow")
+			}
+		}
+	}
+	return nil
+}
+
+// checkImplements returns an error if obj is a method, and renaming it to name would stop a type implementing an interface.
+// Interfaces and types are looked up in the packages of refs, and the packages they import.
+func (rc *renameCmd) checkImplements(obj types.Object, refs []tcRef, name string) error {
+	fun, ok := obj.(*types.Func)
+	if !ok {
+		return nil
+	}
+	recv := fun.Type().(*types.Signature).Recv()
+	if recv == nil {
+		return nil
+	}
+
+	pkgs := map[*types.Package]bool{}
+	for _, r := range refs {
+		pkgs[r.Pkg.Package] = true
+		for _, p := range r.Pkg.Package.Imports() {
+			pkgs[p] = true
+		}
+	}
+	implements := func(t types.Type, iface *types.Interface) bool {
+		return types.Implements(t, iface) || types.Implements(types.NewPointer(t), iface)
+	}
+	qual := func(p *types.Package) string {
+		if p.Path() == obj.Pkg().Path() {
+			return ""
+		}
+		return p.Name()
+	}
+	fail := func(t, iface types.Type) error {
+		return fmt.Errorf("renaming %s to %s would stop %s implementing %s",
+			obj.Name(), name, types.TypeString(t, qual), types.TypeString(iface, qual))
+	}
+
+	rt := recv.Type()
+	if p, ok := rt.(*types.Pointer); ok {
+		rt = p.Elem()
+	}
+	recvIface, _ := rt.Underlying().(*types.Interface)
+	for pkg := range pkgs {
+		scope := pkg.Scope()
+		for _, nm := range scope.Names() {
+			tn, ok := scope.Lookup(nm).(*types.TypeName)
+			if !ok || tn.IsAlias() {
+				continue
+			}
+			nt, ok := tn.Type().(*types.Named)
+			if !ok || nt.TypeParams().Len() != 0 || types.Identical(nt, rt) {
+				continue
+			}
+			iface, isIface := nt.Underlying().(*types.Interface)
+			switch {
+			case recvIface != nil && !isIface:
+				// obj is an interface method, its implementations' methods wouldn't be renamed
+				if implements(nt, recvIface) {
+					return fail(nt, rt)
+				}
+			case recvIface == nil && isIface:
+				if rc.hasMethod(iface, obj.Name()) && implements(rt, iface) {
+					return fail(rt, nt)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// hasMethod returns true if iface has a method named name
+func (rc *renameCmd) hasMethod(iface *types.Interface, name string) bool {
+	for i := 0; i < iface.NumMethods(); i++ {
+		if iface.Method(i).Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldConflict returns the field or method that conflicts with renaming the field fld to name
+func (rc *renameCmd) fieldConflict(pkg *types.Package, fld *types.Var, name string) types.Object {
+	scope := pkg.Scope()
+	for _, nm := range scope.Names() {
+		tn, ok := scope.Lookup(nm).(*types.TypeName)
+		if !ok {
+			continue
+		}
+		st, ok := tn.Type().Underlying().(*types.Struct)
+		if !ok {
+			continue
+		}
+		for i := 0; i < st.NumFields(); i++ {
+			if st.Field(i) != fld {
+				continue
+			}
+			x, _, _ := types.LookupFieldOrMethod(tn.Type(), true, pkg, name)
+			return x
+		}
+	}
+	return nil
+}
+
+// scopeWithin returns true if s is anc or one of its descendants
+func scopeWithin(s, anc *types.Scope) bool {
+	for ; s != nil; s = s.Parent() {
+		if s == anc {
+			return true
+		}
+	}
+	return false
+}
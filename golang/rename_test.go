@@ -0,0 +1,166 @@
+package golang
+
+import (
+	"bytes"
+	"io/ioutil"
+	"margo.sh/mg"
+	"margo.sh/mgutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenameEdits(t *testing.T) {
+	mx, dir, cleanup := testModule(t, map[string]string{
+		"a/a.go": `package a
+
+import "fmt"
+
+func A() { fmt.Println(B()) }
+
+func B() int {
+	x := 1
+	{
+		y := 2
+		return x + y
+	}
+}
+`,
+		"a/x_test.go":                         "package a_test\n\nimport \"example.com/m/a\"\n\nfunc TestA() { a.A() }\n",
+		"i/i.go":                              "package i\n\ntype I interface{ M() }\n\ntype T struct{}\n\nfunc (T) M() {}\n\nvar _ I = T{}\n",
+		"vendor/example.com/v/v.go":           "package v\n\nfunc V() {}\n",
+		"pkg/mod/example.com/c@v1.0.0/go.mod": "module example.com/c\n",
+		"pkg/mod/example.com/c@v1.0.0/c.go":   "package c\n\nfunc C() {}\n",
+	})
+	defer cleanup()
+
+	tests := []struct {
+		nm   string
+		at   string
+		name string
+		err  string
+		dst  map[string]string
+	}{
+		{
+			nm:   "a/a.go",
+			at:   "func |A()",
+			name: "C",
+			dst: map[string]string{
+				"a/a.go":      "func C() { fmt.Println(B()) }",
+				"a/x_test.go": "func TestA() { a.C() }",
+			},
+		},
+		{
+			nm:   "a/a.go",
+			at:   "fmt.|Println",
+			name: "Print",
+			err:  "cannot rename Println: it's declared in GOROOT",
+		},
+		{
+			nm:   "vendor/example.com/v/v.go",
+			at:   "func |V",
+			name: "W",
+			err:  "cannot rename V: it's declared in a vendored package",
+		},
+		{
+			nm:   "pkg/mod/example.com/c@v1.0.0/c.go",
+			at:   "func |C",
+			name: "D",
+			err:  "cannot rename C: it's declared in the module cache",
+		},
+		{
+			nm:   "a/a.go",
+			at:   "func |A()",
+			name: "B",
+			err:  "would conflict with B",
+		},
+		{
+			nm:   "a/a.go",
+			at:   "|x := 1",
+			name: "y",
+			err:  "would be shadowed by y",
+		},
+		{
+			nm:   "a/a.go",
+			at:   "|y := 2",
+			name: "x",
+			err:  "would shadow x",
+		},
+		{
+			nm:   "i/i.go",
+			at:   "func (T) |M()",
+			name: "N",
+			err:  "renaming M to N would stop T implementing I",
+		},
+		{
+			nm:   "i/i.go",
+			at:   "interface{ |M() }",
+			name: "N",
+			err:  "renaming M to N would stop T implementing I",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.at+" "+tt.name, func(t *testing.T) {
+			mx := testView(t, mx, dir, tt.nm, tt.at)
+			_, files, err := (&renameCmd{}).edits(mx, tt.name)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("edits() returned error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("edits() failed: %s", err)
+			}
+			if len(files) != len(tt.dst) {
+				t.Fatalf("edits() changed %d files, want %d", len(files), len(tt.dst))
+			}
+			for nm, s := range tt.dst {
+				found := false
+				for _, f := range files {
+					if strings.HasSuffix(f.Fn, nm) {
+						found = true
+						if !strings.Contains(string(f.Dst), s) {
+							t.Errorf("%s was changed to:\n%s\nwant it to contain %q", nm, f.Dst, s)
+						}
+					}
+				}
+				if !found {
+					t.Errorf("%s was not changed", nm)
+				}
+			}
+		})
+	}
+}
+
+func TestRenameApplyDirty(t *testing.T) {
+	mx, dir, cleanup := testModule(t, map[string]string{
+		"a/a.go": "package a\n\nfunc A() {}\n",
+		"a/b.go": "package a\n\nfunc B() { A() }\n",
+	})
+	defer cleanup()
+	mx = testView(t, mx, dir, "a/a.go", "func |A()")
+	bFn := filepath.Join(dir, "a", "b.go")
+
+	rc := &renameCmd{}
+	_, files, err := rc.edits(mx, "C")
+	if err != nil {
+		t.Fatalf("edits() failed: %s", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("edits() changed %d files, want 2", len(files))
+	}
+
+	mx.Store.ObserveTestingView(&mg.View{Path: bFn, Name: "b.go", Dirty: true})
+	cx := &mg.CmdCtx{
+		Ctx:    mx,
+		RunCmd: mg.RunCmd{Name: "golang.rename"},
+		Output: &mgutil.IOWrapper{Writer: &bytes.Buffer{}},
+	}
+	if err := rc.apply(cx, files); err == nil || !strings.Contains(err.Error(), "unsaved changes") {
+		t.Errorf("apply() with b.go modified error = %v, want it to refuse to overwrite the unsaved changes", err)
+	}
+	if src, _ := ioutil.ReadFile(bFn); strings.Contains(string(src), "C()") {
+		t.Errorf("b.go was written while it had unsaved changes:\n%s", src)
+	}
+}
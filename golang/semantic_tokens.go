@@ -0,0 +1,223 @@
+package golang
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"margo.sh/mg"
+	"margo.sh/mgutil"
+)
+
+type semTokAct struct {
+	mg.ActionType
+	toks *mg.SemanticTokens
+}
+
+// SemanticTokens sets mg.State.SemanticTokens to the kinds of the identifiers in the current view
+// e.g. so that editors can highlight locals differently from package-level vars,
+// or mark unused and deprecated identifiers.
+//
+// The tokens are computed in the background when the view changes,
+// and synchronously for the action mg.QuerySemanticTokens.
+type SemanticTokens struct {
+	mg.ReducerType
+
+	q *mgutil.ChanQ
+}
+
+func (sem *SemanticTokens) RCond(mx *mg.Ctx) bool {
+	return mx.LangIs(mg.Go)
+}
+
+func (sem *SemanticTokens) RMount(mx *mg.Ctx) {
+	sem.q = mgutil.NewChanQLoop(1, func(v interface{}) {
+		mx := v.(*mg.Ctx)
+		if toks := viewSemanticTokens(mx); toks != nil {
+			mx.Store.Dispatch(semTokAct{toks: toks})
+		}
+	})
+}
+
+func (sem *SemanticTokens) RUnmount(mx *mg.Ctx) {
+	sem.q.Close()
+}
+
+func (sem *SemanticTokens) Reduce(mx *mg.Ctx) *mg.State {
+	switch act := mx.Action.(type) {
+	case mg.ViewActivated, mg.ViewModified, mg.ViewSaved:
+		sem.q.Put(mx)
+	case mg.QuerySemanticTokens:
+		return mx.State.SetSemanticTokens(viewSemanticTokens(mx))
+	case semTokAct:
+		return mx.State.SetSemanticTokens(act.toks)
+	}
+	return mx.State
+}
+
+// viewSemanticTokens returns the semantic tokens of the current view.
+//
+// The package is type-checked by kimporter,
+// falling back to checkPartialPkg if the package has errors e.g. while typing.
+func viewSemanticTokens(mx *mg.Ctx) *mg.SemanticTokens {
+	defer mx.Profile.Push("viewSemanticTokens").Pop()
+
+	v := mx.View
+	src, _ := v.ReadAll()
+	if len(src) == 0 {
+		return nil
+	}
+	sc := semTokChk{mx: mx, deprecated: map[string]map[string]bool{}}
+	if kp, _ := typChkR.importPkg(mx); kp != nil && kp.Info != nil && kp.Files[v.Basename()] != nil {
+		sc.pkg, sc.fset, sc.file, sc.info = kp.Package, kp.Fset, kp.Files[v.Basename()], kp.Info
+	} else if pp := checkPartialPkg(mx, src); pp != nil && pp.Pkg != nil {
+		sc.pkg, sc.fset, sc.file, sc.info = pp.Pkg, pp.Fset, pp.File, pp.Info
+	} else {
+		return nil
+	}
+	return mg.NewSemanticTokens(v, semanticTokens(sc.fset, sc.file, sc.info, sc.isDeprecated))
+}
+
+type semTokChk struct {
+	mx         *mg.Ctx
+	pkg        *types.Package
+	fset       *token.FileSet
+	file       *ast.File
+	info       *types.Info
+	deprecated map[string]map[string]bool
+}
+
+// isDeprecated reports whether the declaration of obj is deprecated.
+// Like the Gocode ranking, it only considers the name of the object within its package.
+func (sc *semTokChk) isDeprecated(obj types.Object) bool {
+	p := obj.Pkg()
+	if p == nil {
+		return false
+	}
+	m, ok := sc.deprecated[p.Path()]
+	if !ok {
+		dir := sc.mx.View.Dir()
+		if p != sc.pkg {
+			dir = ""
+			if pi, err := mctl.pkgInfo(sc.mx, p.Path(), sc.mx.View.Dir()); err == nil {
+				dir = pi.Dir
+			}
+		}
+		if dir != "" {
+			m = gcDeprecatedNames(sc.mx, dir)
+		}
+		sc.deprecated[p.Path()] = m
+	}
+	return m[obj.Name()]
+}
+
+// semanticTokens returns the semantic tokens of the identifiers in af, in source order.
+// isDeprecated, if set, reports whether an object is deprecated.
+func semanticTokens(fset *token.FileSet, af *ast.File, info *types.Info, isDeprecated func(types.Object) bool) []mg.SemanticToken {
+	params := map[types.Object]bool{}
+	addParams := func(l ...*ast.FieldList) {
+		for _, fl := range l {
+			if fl == nil {
+				continue
+			}
+			for _, f := range fl.List {
+				for _, id := range f.Names {
+					if obj := info.Defs[id]; obj != nil {
+						params[obj] = true
+					}
+				}
+			}
+		}
+	}
+	ast.Inspect(af, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.FuncDecl:
+			addParams(x.Recv)
+		case *ast.FuncType:
+			addParams(x.Params, x.Results)
+		}
+		return true
+	})
+
+	uses := map[types.Object]int{}
+	for _, obj := range info.Uses {
+		uses[obj]++
+	}
+
+	// objects are local if they're declared in a function
+	// i.e. not in the universe, package or file (imports) scope
+	isLocal := func(obj types.Object) bool {
+		p := obj.Parent()
+		if p == nil || obj.Pkg() == nil {
+			return false
+		}
+		pkgScope := obj.Pkg().Scope()
+		return p != pkgScope && p.Parent() != pkgScope
+	}
+
+	var toks []mg.SemanticToken
+	ast.Inspect(af, func(n ast.Node) bool {
+		id, ok := n.(*ast.Ident)
+		if !ok || id.Name == "_" {
+			return true
+		}
+		var mods mg.SemanticTokenMods
+		obj := info.Defs[id]
+		if obj != nil {
+			mods |= mg.DeclarationMod
+		} else if obj = info.Uses[id]; obj == nil {
+			return true
+		}
+
+		var kind mg.SemanticTokenKind
+		switch o := obj.(type) {
+		case *types.PkgName:
+			kind = mg.NamespaceToken
+		case *types.TypeName:
+			kind = mg.TypeToken
+		case *types.Func:
+			kind = mg.FunctionToken
+			if sig, ok := o.Type().(*types.Signature); ok && sig.Recv() != nil {
+				kind = mg.MethodToken
+			}
+		case *types.Builtin:
+			kind = mg.FunctionToken
+		case *types.Var:
+			switch {
+			case o.IsField():
+				kind = mg.FieldToken
+			case params[o]:
+				kind = mg.ParameterToken
+			default:
+				kind = mg.VariableToken
+				if mods.Is(mg.DeclarationMod) && isLocal(o) && uses[o] == 0 {
+					mods |= mg.UnusedMod
+				}
+			}
+		case *types.Const:
+			kind = mg.ConstantToken
+			mods |= mg.ReadonlyMod
+		case *types.Label:
+			kind = mg.LabelToken
+		default:
+			// e.g. nil
+			return true
+		}
+		if isLocal(obj) {
+			mods |= mg.LocalMod
+		}
+		if isDeprecated != nil && obj.Pkg() != nil && !isLocal(obj) && isDeprecated(obj) {
+			mods |= mg.DeprecatedMod
+		}
+
+		p := fset.Position(id.Pos())
+		toks = append(toks, mg.SemanticToken{
+			Row:  p.Line - 1,
+			Col:  p.Column - 1,
+			Len:  len(id.Name),
+			Kind: kind,
+			Mods: mods,
+		})
+		return true
+	})
+	return toks
+}
@@ -0,0 +1,78 @@
+package golang
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"margo.sh/mg"
+	"testing"
+)
+
+func TestSemanticTokens(t *testing.T) {
+	src := `package p
+
+const C = 1
+
+var V int
+
+type T struct{ F int }
+
+func (t T) M(a int) {
+	x := a
+	y := 0
+	_ = x + C + V + t.F
+}
+`
+	fset := token.NewFileSet()
+	af, err := parser.ParseFile(fset, "p.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &types.Info{
+		Defs: map[*ast.Ident]types.Object{},
+		Uses: map[*ast.Ident]types.Object{},
+	}
+	// the error for unused y is expected
+	(&types.Config{Error: func(error) {}}).Check("p", fset, []*ast.File{af}, info)
+	isDeprecated := func(obj types.Object) bool { return obj.Name() == "V" }
+
+	type tok struct {
+		name string
+		kind mg.SemanticTokenKind
+		mods mg.SemanticTokenMods
+	}
+	const decl, local = mg.DeclarationMod, mg.LocalMod
+	want := []tok{
+		{"C", mg.ConstantToken, decl | mg.ReadonlyMod},
+		{"V", mg.VariableToken, decl | mg.DeprecatedMod},
+		{"int", mg.TypeToken, 0},
+		{"T", mg.TypeToken, decl},
+		{"F", mg.FieldToken, decl},
+		{"int", mg.TypeToken, 0},
+		{"t", mg.ParameterToken, decl | local},
+		{"T", mg.TypeToken, 0},
+		{"M", mg.MethodToken, decl},
+		{"a", mg.ParameterToken, decl | local},
+		{"int", mg.TypeToken, 0},
+		{"x", mg.VariableToken, decl | local},
+		{"a", mg.ParameterToken, local},
+		{"y", mg.VariableToken, decl | local | mg.UnusedMod},
+		{"x", mg.VariableToken, local},
+		{"C", mg.ConstantToken, mg.ReadonlyMod},
+		{"V", mg.VariableToken, mg.DeprecatedMod},
+		{"t", mg.ParameterToken, local},
+		{"F", mg.FieldToken, 0},
+	}
+	toks := semanticTokens(fset, af, info, isDeprecated)
+	if len(toks) != len(want) {
+		t.Fatalf("expected %d tokens, got %d: %#v", len(want), len(toks), toks)
+	}
+	for i, w := range want {
+		tk := toks[i]
+		name := src[tcRowColOffset([]byte(src), tk.Row, tk.Col):][:tk.Len]
+		if got := (tok{name, tk.Kind, tk.Mods}); got != w {
+			t.Errorf("token %d is %v, expected %v", i, got, w)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package golang
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"margo.sh/golang/gopkg"
+	"margo.sh/mg"
+	"margo.sh/mgutil"
+	"path/filepath"
+	"strings"
+)
+
+type sigHelpAct struct {
+	mg.ActionType
+	view mg.ViewKey
+	sh   *mg.SignatureHelp
+}
+
+// SignatureHelp sets mg.State.SignatureHelp to the signature of the function being called at the cursor.
+//
+// It's updated in the background when the cursor moves, and synchronously for the action mg.QuerySignatureHelp.
+// Unlike GocodeCalltips, the signature is type-checked, so it's also available for method values,
+// func-typed variables and fields, etc.
+type SignatureHelp struct {
+	mg.ReducerType
+
+	q    *mgutil.ChanQ
+	view mg.ViewKey
+	sh   *mg.SignatureHelp
+}
+
+func (sh *SignatureHelp) RCond(mx *mg.Ctx) bool {
+	return mx.LangIs(mg.Go)
+}
+
+func (sh *SignatureHelp) RMount(mx *mg.Ctx) {
+	sh.q = mgutil.NewChanQLoop(1, func(v interface{}) {
+		mx := v.(*mg.Ctx)
+		src, pos := mx.View.SrcPos()
+		mx.Store.Dispatch(sigHelpAct{
+			view: mx.ViewKey(),
+			sh:   signatureHelpAt(mx, src, pos),
+		})
+	})
+}
+
+func (sh *SignatureHelp) RUnmount(mx *mg.Ctx) {
+	sh.q.Close()
+}
+
+func (sh *SignatureHelp) Reduce(mx *mg.Ctx) *mg.State {
+	switch act := mx.Action.(type) {
+	case mg.ViewPosChanged, mg.ViewActivated, mg.ViewModified:
+		sh.q.Put(mx)
+	case mg.QuerySignatureHelp:
+		src, pos := mx.View.SrcPos()
+		sh.view, sh.sh = mx.ViewKey(), signatureHelpAt(mx, src, pos)
+	case sigHelpAct:
+		sh.view, sh.sh = act.view, act.sh
+	}
+	if sh.sh == nil || sh.view != mx.ViewKey() {
+		return mx.State
+	}
+	return mx.State.SetSignatureHelp(sh.sh)
+}
+
+// signatureHelpAt returns the signature of the function being called at pos, or nil if there is none
+func signatureHelpAt(mx *mg.Ctx, src []byte, pos int) *mg.SignatureHelp {
+	defer mx.Profile.Push("signatureHelpAt").Pop()
+
+	if len(src) == 0 {
+		return nil
+	}
+	pos = mgutil.ClampPos(src, pos)
+	cx := NewCursorCtx(mx, src, pos)
+	tf := cx.TokenFile
+	tokPos := tf.Pos(pos)
+	call, _ := (&GocodeCalltips{}).findCallExpr(cx.Nodes, tokPos)
+	if call == nil || tokPos <= call.Lparen || (call.Rparen.IsValid() && tokPos > call.Rparen) {
+		return nil
+	}
+	funStart, funEnd := tf.Offset(call.Fun.Pos()), tf.Offset(call.Fun.End())
+	active := (&GocodeCalltips{}).selectedFieldExpr(tf.Offset, src, pos, call.Args)
+
+	pp := checkPartialPkg(mx, src)
+	if pp == nil {
+		return nil
+	}
+	for _, n := range pp.path(funStart, funEnd) {
+		fun, ok := n.(ast.Expr)
+		if !ok || pp.offset(fun.Pos()) != funStart || pp.offset(fun.End()) != funEnd {
+			continue
+		}
+		tv := pp.Info.Types[fun]
+		if tv.Type == nil || tv.IsType() {
+			// it's a conversion, or there's no type info
+			return nil
+		}
+		sig, ok := tv.Type.Underlying().(*types.Signature)
+		if !ok {
+			return nil
+		}
+		return pp.signatureHelp(mx, fun, sig, active)
+	}
+	return nil
+}
+
+func (pp *partialPkg) signatureHelp(mx *mg.Ctx, fun ast.Expr, sig *types.Signature, active int) *mg.SignatureHelp {
+	sh := &mg.SignatureHelp{
+		Params:      pp.sigParams(sig.Params(), sig.Variadic()),
+		Results:     pp.sigParams(sig.Results(), false),
+		Variadic:    sig.Variadic(),
+		ActiveParam: active,
+	}
+	switch n := len(sh.Params); {
+	case sh.Variadic && active >= n-1:
+		sh.ActiveParam = n - 1
+	case active >= n:
+		sh.ActiveParam = -1
+	}
+
+	for {
+		p, ok := fun.(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		fun = p.X
+	}
+	var id *ast.Ident
+	switch x := fun.(type) {
+	case *ast.Ident:
+		id = x
+	case *ast.SelectorExpr:
+		id = x.Sel
+	}
+	if id == nil {
+		return sh
+	}
+	sh.Name = id.Name
+	fn, _ := pp.Info.Uses[id].(*types.Func)
+	if fn == nil {
+		return sh
+	}
+	recv := ""
+	if r := fn.Type().(*types.Signature).Recv(); r != nil {
+		sh.Recv = pp.typeString(r.Type())
+		recv = sigRecvName(r.Type())
+	}
+	sh.Doc = pp.funcDoc(mx, fn, recv)
+	return sh
+}
+
+func (pp *partialPkg) sigParams(tup *types.Tuple, variadic bool) []mg.SignatureParam {
+	l := make([]mg.SignatureParam, tup.Len())
+	for i := range l {
+		v := tup.At(i)
+		typ := pp.typeString(v.Type())
+		if s, ok := v.Type().(*types.Slice); ok && variadic && i == len(l)-1 {
+			typ = "..." + pp.typeString(s.Elem())
+		}
+		l[i] = mg.SignatureParam{Name: v.Name(), Type: typ}
+	}
+	return l
+}
+
+// funcDoc returns the doc comment of the function fn.
+// recv is the name of the receiver's base type if fn is a method.
+func (pp *partialPkg) funcDoc(mx *mg.Ctx, fn *types.Func, recv string) string {
+	if fn.Pkg() == nil {
+		return ""
+	}
+	if fn.Pkg() == pp.Pkg {
+		// the view might not be saved, so check it first
+		for _, d := range pp.File.Decls {
+			if fd, ok := d.(*ast.FuncDecl); ok && fd.Name.Pos() == fn.Pos() {
+				return fd.Doc.Text()
+			}
+		}
+		return funcDocs(mx, mx.View.Dir())[sigDocKey(recv, fn.Name())]
+	}
+	p, err := gopkg.FindPkg(mx, fn.Pkg().Path(), mx.View.Dir())
+	if err != nil {
+		return ""
+	}
+	return funcDocs(mx, p.Dir)[sigDocKey(recv, fn.Name())]
+}
+
+// funcDocs returns the doc comments of the functions and methods declared in the package in dir
+func funcDocs(mx *mg.Ctx, dir string) map[string]string {
+	type K struct{}
+	m, _ := mx.VFS.ReadMemo(dir, K{}, func() interface{} {
+		m := map[string]string{}
+		fset := token.NewFileSet()
+		for _, nd := range mx.VFS.Poke(dir).Ls().Nodes() {
+			nm := nd.Name()
+			if !strings.HasSuffix(nm, ".go") || strings.HasSuffix(nm, "_test.go") {
+				continue
+			}
+			src, err := nd.ReadBlob().ReadFile()
+			if err != nil {
+				continue
+			}
+			af, _ := parser.ParseFile(fset, filepath.Join(dir, nm), src, parser.ParseComments)
+			if af == nil {
+				continue
+			}
+			for _, d := range af.Decls {
+				fd, ok := d.(*ast.FuncDecl)
+				if !ok || fd.Doc == nil {
+					continue
+				}
+				recv := ""
+				if fd.Recv != nil && len(fd.Recv.List) != 0 {
+					recv = sigRecvExprName(fd.Recv.List[0].Type)
+				}
+				m[sigDocKey(recv, fd.Name.Name)] = fd.Doc.Text()
+			}
+		}
+		return m
+	}).(map[string]string)
+	return m
+}
+
+func sigDocKey(recv, name string) string {
+	if recv == "" {
+		return name
+	}
+	return recv + "." + name
+}
+
+// sigRecvName returns the name of the receiver's base type e.g. `Buffer` for `*bytes.Buffer`
+func sigRecvName(t types.Type) string {
+	if p, ok := t.(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	if n, ok := t.(*types.Named); ok {
+		return n.Obj().Name()
+	}
+	return ""
+}
+
+// sigRecvExprName is the ast equivalent of sigRecvName
+func sigRecvExprName(x ast.Expr) string {
+	for {
+		switch t := x.(type) {
+		case *ast.StarExpr:
+			x = t.X
+		case *ast.IndexExpr:
+			x = t.X
+		case *ast.IndexListExpr:
+			x = t.X
+		case *ast.ParenExpr:
+			x = t.X
+		case *ast.Ident:
+			return t.Name
+		default:
+			return ""
+		}
+	}
+}
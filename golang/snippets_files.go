@@ -0,0 +1,246 @@
+package golang
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"margo.sh/golang/cursor"
+	"margo.sh/mg"
+	"margo.sh/mgutil"
+	"path/filepath"
+	"strings"
+)
+
+// SnippetFiles adds snippets defined in JSON files, so they can be shared e.g. in a repo, without rebuilding margo.
+//
+// Each `.json` file in Dirs contains a list of snippets e.g.
+//
+//	[
+//		{
+//			"query": "if err",
+//			"title": "err != nil { return }",
+//			"body": ["if ${1:err} != nil {", "\treturn $0", "}"],
+//			"scope": "BlockScope"
+//		}
+//	]
+//
+// body is a string, or a list of lines, in the editor's snippet syntax.
+// scope, if set, restricts the snippet to the listed cursor scopes e.g. `BlockScope|ExprScope`,
+// and notScope excludes scopes e.g. `StringScope|CommentScope`. See cursor.CurScope for the list of names.
+//
+// Files are reloaded when they're saved, or changed on disk if mg.VFSWatcher is enabled.
+// Errors are reported as issues in the file.
+type SnippetFiles struct {
+	mg.ReducerType
+
+	// Dirs is the list of directories containing snippet files.
+	// Relative paths are resolved against the project root i.e. the directory containing go.mod.
+	// The default is `.margo/snippets`.
+	Dirs []string
+}
+
+func (sf *SnippetFiles) Reduce(mx *mg.Ctx) *mg.State {
+	switch mx.Action.(type) {
+	case mg.QueryCompletions:
+		if mx.LangIs(mg.Go) {
+			return SnippetFuncs(sf.completions).Reduce(mx)
+		}
+	case mg.ViewActivated, mg.ViewSaved:
+		// load the file now so that errors are reported without waiting for a completion
+		if fn := mx.View.Path; fn != "" && sf.isSnippetFile(mx, fn) {
+			loadSnippetFile(mx, fn)
+		}
+	}
+	return mx.State
+}
+
+func (sf *SnippetFiles) completions(cx *CompletionCtx) []mg.Completion {
+	mx := cx.Ctx
+	if mx.View.Path == "" {
+		return nil
+	}
+	var cl []mg.Completion
+	for _, dir := range sf.dirs(mx, mx.View.Dir()) {
+		for _, nd := range mx.VFS.Poke(dir).Ls().Nodes() {
+			if !strings.HasSuffix(nd.Name(), ".json") {
+				continue
+			}
+			for _, sd := range loadSnippetFile(mx, nd.Path()) {
+				if sd.matches(cx.Scope) {
+					cl = append(cl, sd.completion())
+				}
+			}
+		}
+	}
+	return cl
+}
+
+// dirs returns the list of snippet directories for the package in dir
+func (sf *SnippetFiles) dirs(mx *mg.Ctx, dir string) []string {
+	l := sf.Dirs
+	if len(l) == 0 {
+		l = []string{filepath.Join(".margo", "snippets")}
+	}
+	root := projectRoot(mx, dir)
+	dirs := make([]string, len(l))
+	for i, s := range l {
+		if !filepath.IsAbs(s) {
+			s = filepath.Join(root, s)
+		}
+		dirs[i] = filepath.Clean(s)
+	}
+	return dirs
+}
+
+func (sf *SnippetFiles) isSnippetFile(mx *mg.Ctx, fn string) bool {
+	if !strings.HasSuffix(fn, ".json") {
+		return false
+	}
+	dir := filepath.Dir(fn)
+	for _, s := range sf.dirs(mx, dir) {
+		if s == dir {
+			return true
+		}
+	}
+	return false
+}
+
+type snippetDef struct {
+	Query    string
+	Title    string
+	Body     snippetBody
+	Scope    string
+	NotScope string
+
+	scope    cursor.CurScope
+	notScope cursor.CurScope
+}
+
+func (sd *snippetDef) matches(cs cursor.CurScope) bool {
+	if sd.scope != 0 && !cs.Is(sd.scope) {
+		return false
+	}
+	return !cs.Is(sd.notScope)
+}
+
+func (sd *snippetDef) completion() mg.Completion {
+	return mg.Completion{
+		Query: sd.Query,
+		Title: sd.Title,
+		Src:   string(sd.Body),
+	}
+}
+
+func (sd *snippetDef) init() error {
+	var err error
+	if sd.Query == "" {
+		return fmt.Errorf("snippet has no query")
+	}
+	if sd.Body == "" {
+		return fmt.Errorf("snippet `%s` has no body", sd.Query)
+	}
+	if sd.Scope != "" {
+		if sd.scope, err = cursor.ParseCurScope(sd.Scope); err != nil {
+			return fmt.Errorf("snippet `%s`: scope: %s", sd.Query, err)
+		}
+	}
+	if sd.NotScope != "" {
+		if sd.notScope, err = cursor.ParseCurScope(sd.NotScope); err != nil {
+			return fmt.Errorf("snippet `%s`: notScope: %s", sd.Query, err)
+		}
+	}
+	return nil
+}
+
+// snippetBody is a string, or a list of lines
+type snippetBody string
+
+func (sb *snippetBody) UnmarshalJSON(p []byte) error {
+	var s string
+	if err := json.Unmarshal(p, &s); err == nil {
+		*sb = snippetBody(s)
+		return nil
+	}
+	var l []string
+	if err := json.Unmarshal(p, &l); err != nil {
+		return fmt.Errorf("body must be a string, or a list of strings")
+	}
+	*sb = snippetBody(strings.Join(l, "\n"))
+	return nil
+}
+
+// loadSnippetFile returns the snippets defined in the file fn.
+// The result is cached in the VFS, and errors are reported as issues when it's (re)loaded.
+func loadSnippetFile(mx *mg.Ctx, fn string) []snippetDef {
+	type K struct{}
+	l, _ := mx.VFS.ReadMemo(fn, K{}, func() interface{} {
+		src, err := mx.VFS.ReadBlob(fn).ReadFile()
+		if err != nil {
+			return []snippetDef(nil)
+		}
+		l, issues := parseSnippetFile(fn, src)
+		mx.Store.Dispatch(mg.StoreIssues{
+			IssueKey: mg.IssueKey{Key: K{}, Path: fn},
+			Issues:   issues,
+		})
+		return l
+	}).([]snippetDef)
+	return l
+}
+
+// parseSnippetFile parses the snippet file fn.
+// Invalid snippets are skipped, so an error doesn't disable the whole file.
+func parseSnippetFile(fn string, src []byte) ([]snippetDef, mg.IssueSet) {
+	var l []snippetDef
+	var issues mg.IssueSet
+	report := func(ofs int64, err error) {
+		if se, ok := err.(*json.SyntaxError); ok {
+			ofs = se.Offset
+		}
+		row, col := snippetFilePos(src, int(ofs))
+		issues = append(issues, mg.Issue{
+			Path:    fn,
+			Row:     row,
+			Col:     col,
+			Message: err.Error(),
+			Tag:     mg.Error,
+			Label:   "Go/SnippetFiles",
+		})
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(src))
+	dec.DisallowUnknownFields()
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		if err == nil {
+			err = fmt.Errorf("expected a list of snippets")
+		}
+		report(dec.InputOffset(), err)
+		return nil, issues
+	}
+	for dec.More() {
+		// InputOffset is the end of the previous value, so skip the separator
+		ofs := dec.InputOffset()
+		ofs += int64(len(src[ofs:]) - len(bytes.TrimLeft(src[ofs:], ", \t\r\n")))
+		sd := snippetDef{}
+		if err := dec.Decode(&sd); err != nil {
+			report(ofs, err)
+			if _, ok := err.(*json.SyntaxError); ok {
+				return l, issues
+			}
+			continue
+		}
+		if err := sd.init(); err != nil {
+			report(ofs, err)
+			continue
+		}
+		l = append(l, sd)
+	}
+	return l, issues
+}
+
+func snippetFilePos(src []byte, ofs int) (row, col int) {
+	ofs = mgutil.Clamp(0, len(src), ofs)
+	row = bytes.Count(src[:ofs], []byte{'\n'})
+	col = ofs - (bytes.LastIndexByte(src[:ofs], '\n') + 1)
+	return row, col
+}
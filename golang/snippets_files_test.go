@@ -0,0 +1,49 @@
+package golang
+
+import (
+	"margo.sh/golang/cursor"
+	"testing"
+)
+
+func TestParseSnippetFile(t *testing.T) {
+	src := []byte(`[
+	{
+		"query": "if err",
+		"title": "err != nil { return }",
+		"body": ["if ${1:err} != nil {", "\treturn $0", "}"],
+		"scope": "BlockScope"
+	},
+	{
+		"query": "bad",
+		"body": "x",
+		"scope": "NoSuchScope"
+	},
+	{
+		"query": "todo",
+		"body": "// TODO: $0",
+		"notScope": "StringScope|CommentScope"
+	}
+]
+`)
+	l, issues := parseSnippetFile("s.json", src)
+	if len(l) != 2 {
+		t.Fatalf("expected 2 snippets, got %d: %#v", len(l), l)
+	}
+	if s := string(l[0].Body); s != "if ${1:err} != nil {\n\treturn $0\n}" {
+		t.Errorf("body lines were not joined: %q", s)
+	}
+	if !l[0].matches(cursor.BlockScope|cursor.ExprScope) || l[0].matches(cursor.FileScope) {
+		t.Errorf("snippet `%s` doesn't match its scope `%s`", l[0].Query, l[0].Scope)
+	}
+	if l[1].matches(cursor.StringScope) || !l[1].matches(cursor.FileScope) {
+		t.Errorf("snippet `%s` doesn't match its notScope `%s`", l[1].Query, l[1].NotScope)
+	}
+	if len(issues) != 1 || issues[0].Row != 7 {
+		t.Fatalf("expected 1 issue on row 7, got %#v", issues)
+	}
+
+	_, issues = parseSnippetFile("s.json", []byte("[\n\t{\"query\": \"x\",}\n]"))
+	if len(issues) != 1 || issues[0].Row != 1 {
+		t.Fatalf("expected a syntax error on row 1, got %#v", issues)
+	}
+}
@@ -0,0 +1,248 @@
+package golang
+
+import (
+	"go/ast"
+	"go/types"
+	"margo.sh/mg"
+	"margo.sh/mgutil"
+)
+
+// postfixCtx holds the expression that a postfix completion rewrites
+type postfixCtx struct {
+	// fn and src are the name and source of the view
+	fn  string
+	src []byte
+	// x is the source of the expression
+	x string
+	// start is the offset of the expression, pos is the offset of the cursor
+	start, pos int
+	typ        types.Type
+	call       bool
+	stmt       bool
+}
+
+// PostfixSnippet offers postfix templates when the cursor follows a selector dot on an expression.
+// The whole expression is rewritten e.g. `err.return` becomes `return err`, and `m.forkv` becomes `for k, v := range m {}`.
+//
+// Templates are only offered if they're valid for the type of the expression
+// e.g. `range` is only offered on slices, maps, etc. and `err` on error values.
+//
+// It's not included in Snippets; it can be enabled with `golang.SnippetFuncs(golang.PostfixSnippet)`.
+// Templates are only offered to editors that can replace the expression (see mg.EditorProps.ReplaceCompletions).
+func PostfixSnippet(cx *CompletionCtx) []mg.Completion {
+	if !cx.Ctx.Editor.ReplaceCompletions() {
+		return nil
+	}
+	if cx.BlockStmt == nil || cx.Scope.Is(StringScope, CommentScope, ImportScope) {
+		return nil
+	}
+
+	src, pos := cx.View.SrcPos()
+	pos = mgutil.ClampPos(src, pos)
+	word := mgutil.RepositionLeft(src, pos, IsLetter)
+	dot := word - 1
+	if dot < 1 || src[dot] != '.' {
+		return nil
+	}
+
+	// the source without the `.word`, so that the expression is complete
+	xsrc := make([]byte, 0, len(src))
+	xsrc = append(xsrc, src[:dot]...)
+	xsrc = append(xsrc, src[pos:]...)
+	start := postfixExprStart(cx, xsrc, dot)
+	if start < 0 {
+		return nil
+	}
+
+	pp := checkPartialFunc(cx.Ctx, xsrc, start)
+	if pp == nil {
+		return nil
+	}
+	path := pp.path(start, dot)
+	for i, n := range path {
+		x, ok := n.(ast.Expr)
+		if !ok || pp.offset(x.Pos()) != start || pp.offset(x.End()) != dot {
+			continue
+		}
+		tv, ok := pp.Info.Types[x]
+		if !ok || tv.Type == nil || tv.Type == types.Typ[types.Invalid] || tv.IsType() {
+			// there's no type info, or it's a type or package name; `fmt.` is not an expression
+			return nil
+		}
+		_, call := x.(*ast.CallExpr)
+		stmt := false
+		if i+1 < len(path) {
+			_, stmt = path[i+1].(*ast.ExprStmt)
+		}
+		px := &postfixCtx{
+			fn:    cx.View.Filename(),
+			src:   src,
+			x:     string(src[start:dot]),
+			start: start,
+			pos:   pos,
+			typ:   tv.Type,
+			call:  call,
+			stmt:  stmt,
+		}
+		return px.completions()
+	}
+	return nil
+}
+
+// postfixExprStart returns the offset of the expression that ends at the selector dot, or -1 if there is none.
+// xsrc is the view's source without the `.word`.
+func postfixExprStart(cx *CompletionCtx, xsrc []byte, dot int) int {
+	// `x.` and `x.if` are usually parsed as a selector on `x`
+	for i := len(cx.Nodes) - 1; i >= 0; i-- {
+		sel, ok := cx.Nodes[i].(*ast.SelectorExpr)
+		if ok && cx.TokenFile.Offset(sel.X.End()) == dot {
+			return cx.TokenFile.Offset(sel.X.Pos())
+		}
+	}
+
+	// but some keywords e.g. `x.range` break the parse,
+	// so we look for the outermost operand that ends at the dot in xsrc instead
+	xcx := NewCursorCtx(cx.Ctx, xsrc, dot-1)
+	start := -1
+	for i := len(xcx.Nodes) - 1; i >= 0; i-- {
+		x, ok := xcx.Nodes[i].(ast.Expr)
+		if ok && xcx.TokenFile.Offset(x.End()) != dot {
+			ok = false
+		}
+		switch x.(type) {
+		case *ast.BinaryExpr, *ast.UnaryExpr, *ast.StarExpr, *ast.KeyValueExpr:
+			// the selector binds more tightly than operators e.g. `a + b.if` is on `b`
+			ok = false
+		}
+		switch {
+		case ok:
+			start = xcx.TokenFile.Offset(x.Pos())
+		case start >= 0:
+			return start
+		}
+	}
+	return start
+}
+
+func (px *postfixCtx) completions() []mg.Completion {
+	cl := []mg.Completion{}
+	add := func(query, title, src string) {
+		cl = append(cl, mg.Completion{
+			Query:   query,
+			Title:   title,
+			Src:     src,
+			Replace: px.pos - px.start,
+		})
+	}
+
+	x, u := px.x, px.typ.Underlying()
+	tup, _ := u.(*types.Tuple)
+	if tup == nil {
+		add("print", "fmt.Println("+x+")", "fmt.Println("+x+")$0")
+		cl[len(cl)-1].Edits = px.importEdits("fmt")
+	}
+	if b, ok := u.(*types.Basic); ok && b.Info()&types.IsBoolean != 0 {
+		add("not", "!"+x, "!"+postfixParen(x)+"$0")
+	}
+	switch u.(type) {
+	case *types.Slice, *types.Array, *types.Map, *types.Chan:
+		add("len", "len("+x+")", "len("+x+")$0")
+	case *types.Basic:
+		if postfixIsString(u) {
+			add("len", "len("+x+")", "len("+x+")$0")
+		}
+	}
+
+	if !px.stmt {
+		return cl
+	}
+
+	add("return", "return "+x, "return "+x+"$0")
+	if px.call {
+		add("go", "go "+x, "go "+x+"$0")
+		add("defer", "defer "+x, "defer "+x+"$0")
+	}
+	if tup == nil {
+		add("var", "v := "+x, "${1:v} := "+x+"$0")
+	}
+
+	if b, ok := u.(*types.Basic); ok && b.Info()&types.IsBoolean != 0 {
+		add("if", "if "+x+" {}", "if "+x+" {\n\t$0\n}")
+	}
+
+	if postfixIsNillable(u) {
+		add("nil", "if "+x+" == nil {}", "if "+x+" == nil {\n\t$0\n}")
+		add("notnil", "if "+x+" != nil {}", "if "+x+" != nil {\n\t$0\n}")
+	}
+
+	switch {
+	case postfixIsError(px.typ) && px.call:
+		add("err", "if err := "+x+"; err != nil { return err }",
+			"if err := "+x+"; err != nil {\n\treturn ${1:err}\n}$0")
+	case postfixIsError(px.typ):
+		add("err", "if "+x+" != nil { return "+x+" }",
+			"if "+x+" != nil {\n\treturn ${1:"+x+"}\n}$0")
+	case tup != nil && tup.Len() == 2 && postfixIsError(tup.At(1).Type()):
+		add("err", "v, err := "+x+"; if err != nil { return err }",
+			"${1:v}, err := "+x+"\nif err != nil {\n\treturn ${2:err}\n}$0")
+	}
+
+	switch t := u.(type) {
+	case *types.Map:
+		add("range", "for k := range "+x+" {}", "for ${1:k} := range "+x+" {\n\t$0\n}")
+		add("forkv", "for k, v := range "+x+" {}", "for ${1:k}, ${2:v} := range "+x+" {\n\t$0\n}")
+	case *types.Slice, *types.Array:
+		add("range", "for i := range "+x+" {}", "for ${1:i} := range "+x+" {\n\t$0\n}")
+		add("forkv", "for i, v := range "+x+" {}", "for ${1:i}, ${2:v} := range "+x+" {\n\t$0\n}")
+	case *types.Chan:
+		if t.Dir() != types.SendOnly {
+			add("range", "for v := range "+x+" {}", "for ${1:v} := range "+x+" {\n\t$0\n}")
+		}
+	case *types.Basic:
+		if postfixIsString(t) {
+			add("range", "for i, c := range "+x+" {}", "for ${1:i}, ${2:c} := range "+x+" {\n\t$0\n}")
+		}
+	}
+
+	return cl
+}
+
+// importEdits returns the edits that add the import of ipath to the view, if it's not already imported
+func (px *postfixCtx) importEdits(ipath string) []mg.TextEdit {
+	dst, merged, err := impSpecList{{Path: ipath}}.mergeWithSrc(px.fn, px.src)
+	if err != nil || len(merged) == 0 {
+		return nil
+	}
+	return []mg.TextEdit{srcTextEdit(px.src, dst)}
+}
+
+func postfixIsNillable(u types.Type) bool {
+	switch u.(type) {
+	case *types.Pointer, *types.Interface, *types.Map, *types.Slice, *types.Chan, *types.Signature:
+		return true
+	}
+	return false
+}
+
+func postfixIsString(u types.Type) bool {
+	b, ok := u.(*types.Basic)
+	return ok && b.Info()&types.IsString != 0
+}
+
+func postfixIsError(t types.Type) bool {
+	errTyp := types.Universe.Lookup("error").Type()
+	if _, ok := t.Underlying().(*types.Interface); !ok {
+		return false
+	}
+	return types.Implements(t, errTyp.Underlying().(*types.Interface))
+}
+
+// postfixParen wraps x in parens unless it's a simple operand
+func postfixParen(x string) string {
+	for _, c := range x {
+		if !IsLetter(c) && !('0' <= c && c <= '9') && c != '.' {
+			return "(" + x + ")"
+		}
+	}
+	return x
+}
@@ -0,0 +1,50 @@
+package golang
+
+import (
+	"margo.sh/mg"
+	"testing"
+)
+
+func TestPostfixSnippet(t *testing.T) {
+	mx, dir, cleanup := testModule(t, map[string]string{
+		"a/a.go": "package a\n\nfunc f() error {\n\tvar err error\n\terr.\n\treturn nil\n}\n",
+	})
+	defer cleanup()
+
+	mx = testView(t, mx, dir, "a/a.go", "err.|")
+	query := func(protocol string) map[string]mg.Completion {
+		mx := mx.SetState(mx.State.Copy(func(st *mg.State) { st.Editor.Protocol = protocol }))
+		m := map[string]mg.Completion{}
+		for _, c := range PostfixSnippet(NewViewCursorCtx(mx)) {
+			m[c.Query] = c
+		}
+		return m
+	}
+
+	if cl := query("margo"); len(cl) != 0 {
+		t.Errorf("postfix completions were offered to an editor that doesn't support Completion.Replace: %v", cl)
+	}
+
+	cl := query(mg.LSPProtocol)
+	ret, ok := cl["return"]
+	if !ok {
+		t.Fatalf("`return` was not offered: %v", cl)
+	}
+	if ret.Src != "return err$0" || ret.Replace != len("err.") {
+		t.Errorf("`return` completion is (%q, Replace=%d), want (%q, Replace=%d)", ret.Src, ret.Replace, "return err$0", len("err."))
+	}
+	if _, ok := cl["range"]; ok {
+		t.Errorf("`range` was offered on an error value")
+	}
+
+	src, _ := mx.View.ReadAll()
+	pr := cl["print"]
+	got, err := mg.ApplyTextEdits(src, pr.Edits)
+	if err != nil {
+		t.Fatalf("cannot apply the edits of `print`: %s", err)
+	}
+	want := "package a\n\nimport (\n\t\"fmt\"\n)\n\nfunc f() error {\n\tvar err error\n\terr.\n\treturn nil\n}\n"
+	if string(got) != want {
+		t.Errorf("the edits of `print` changed the src to:\n%s\nwant:\n%s", got, want)
+	}
+}
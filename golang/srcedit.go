@@ -0,0 +1,68 @@
+package golang
+
+import (
+	"fmt"
+	"margo.sh/mg"
+)
+
+func init() {
+	mg.DefaultReducers.After(&viewSrcEditor{})
+}
+
+// viewSrcEdit is dispatched by commands that do their work in the background
+// to replace the src of the view named Name.
+//
+// It's ignored if the view was modified since Hash was computed.
+type viewSrcEdit struct {
+	mg.ActionType
+
+	// Title describes the edit e.g. `golang.rename`
+	Title string
+	Name  string
+	Hash  string
+	Src   []byte
+
+	// Res, if set, receives the result of the edit instead of it being reported as an error.
+	// It should be buffered, as the result is dropped if it can't be sent immediately.
+	Res chan<- error
+}
+
+func (act viewSrcEdit) result(err error) {
+	select {
+	case act.Res <- err:
+	default:
+	}
+}
+
+// viewSrcEditor applies viewSrcEdit actions
+type viewSrcEditor struct{ mg.ReducerType }
+
+func (vse *viewSrcEditor) Reduce(mx *mg.Ctx) *mg.State {
+	act, ok := mx.Action.(viewSrcEdit)
+	if !ok {
+		return mx.State
+	}
+	if v := mx.View; v.Name != act.Name || v.Hash != act.Hash {
+		err := fmt.Errorf("%s: the view was changed, please try again", act.Title)
+		if act.Res != nil {
+			act.result(err)
+			return mx.State
+		}
+		return mx.AddErrorf("%s", err)
+	}
+	act.result(nil)
+	return mx.SetViewSrc(act.Src)
+}
+
+// srcTextEdit returns the edit that changes src into dst
+func srcTextEdit(src, dst []byte) mg.TextEdit {
+	pfx := 0
+	for pfx < len(src) && pfx < len(dst) && src[pfx] == dst[pfx] {
+		pfx++
+	}
+	sfx := 0
+	for sfx < len(src)-pfx && sfx < len(dst)-pfx && src[len(src)-1-sfx] == dst[len(dst)-1-sfx] {
+		sfx++
+	}
+	return mg.NewTextEdit(src, pfx, len(src)-sfx, string(dst[pfx:len(dst)-sfx]))
+}
@@ -0,0 +1,413 @@
+package golang
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"margo.sh/mg"
+	"margo.sh/mgutil"
+	"margo.sh/vfs"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// maxSymbols is the maximum number of symbols listed by a query
+	maxSymbols = 100
+
+	// maxSymbolCmds is the maximum number of results of the last query listed as UserCmds
+	maxSymbolCmds = 30
+)
+
+func init() {
+	mg.DefaultReducers.Before(&symbolsCmd{})
+}
+
+// goSym is a top-level declaration in a Go file
+type goSym struct {
+	Name string
+	// Kind is one of func, method, type, var or const
+	Kind string
+	// Recv is the name of the receiver's type if Kind is method
+	Recv string
+	// PkgName is the name of the package as declared in the file
+	PkgName string
+	Pos     token.Position
+}
+
+// QualName returns the name of the symbol, qualified with the receiver name for methods
+func (s goSym) QualName() string {
+	if s.Recv != "" {
+		return s.Recv + "." + s.Name
+	}
+	return s.Name
+}
+
+// symbolsCmd implements the `golang.symbols` builtin command.
+//
+// It searches the top-level declarations of all packages in the current project,
+// or with the flag `-all`, all the packages known to the agent.
+// The results of the last query are listed as UserCmds that go to the declaration.
+type symbolsCmd struct {
+	mg.ReducerType
+
+	mu    sync.Mutex
+	query string
+	last  []goSym
+}
+
+func (sc *symbolsCmd) RCond(mx *mg.Ctx) bool {
+	return mx.LangIs(mg.Go)
+}
+
+func (sc *symbolsCmd) Reduce(mx *mg.Ctx) *mg.State {
+	switch mx.Action.(type) {
+	case mg.ViewSaved:
+		// the positions of the last results are probably stale now.
+		// the index itself is updated when the VFS invalidates the file's memo
+		sc.mu.Lock()
+		sc.query, sc.last = "", nil
+		sc.mu.Unlock()
+	case mg.QueryUserCmds:
+		return mx.AddUserCmds(sc.userCmds(mx)...)
+	case mg.RunCmd:
+		return mx.AddBuiltinCmds(mg.BuiltinCmd{
+			Name: "golang.symbols",
+			Desc: "Search for top-level declarations by name. Usage: golang.symbols [-all] [-goto=path:line:col] [query]",
+			Run:  sc.run,
+		})
+	}
+	return mx.State
+}
+
+func (sc *symbolsCmd) userCmds(mx *mg.Ctx) []mg.UserCmd {
+	cmds := []mg.UserCmd{{
+		Title:   "Go to Symbol",
+		Name:    "golang.symbols",
+		Desc:    "Search for top-level declarations in the current project",
+		Prompts: []string{"Symbol"},
+	}}
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	for i, s := range sc.last {
+		if i >= maxSymbolCmds {
+			break
+		}
+		p := s.Pos
+		cmds = append(cmds, mg.UserCmd{
+			Title: fmt.Sprintf("%s: %s %s", sc.query, s.Kind, s.QualName()),
+			Name:  "golang.symbols",
+			Desc:  fmt.Sprintf("%s:%d", mgutil.ShortFn(p.Filename, mx.Env), p.Line),
+			Args:  []string{fmt.Sprintf("-goto=%s:%d:%d", p.Filename, p.Line, p.Column)},
+		})
+	}
+	return cmds
+}
+
+func (sc *symbolsCmd) run(cx *mg.CmdCtx) *mg.State {
+	go sc.search(cx)
+	return cx.State
+}
+
+func (sc *symbolsCmd) search(cx *mg.CmdCtx) {
+	defer cx.Output.Close()
+
+	fs := cx.Flags()
+	all := fs.Bool("all", false, "Search all packages known to the agent, not just the current project")
+	gotoPos := fs.String("goto", "", "Go to the location path:line:col instead of searching")
+	if err := fs.Parse(); err != nil {
+		fmt.Fprintln(cx.Output, "golang.symbols:", err)
+		return
+	}
+
+	if *gotoPos != "" {
+		act, err := sc.activate(*gotoPos)
+		if err != nil {
+			fmt.Fprintln(cx.Output, "golang.symbols:", err)
+			return
+		}
+		cx.Store.Dispatch(act)
+		return
+	}
+
+	query := strings.TrimSpace(strings.Join(fs.Args(), " "))
+	if len(cx.Prompts) != 0 {
+		query = strings.TrimSpace(cx.Prompts[0])
+	}
+	if query == "" {
+		fmt.Fprintln(cx.Output, "golang.symbols: no query specified")
+		return
+	}
+
+	defer cx.Begin(mg.Task{Title: "golang.symbols: " + query}).Done()
+
+	syms := symbolsSearch(symbolsIndex(cx.Ctx, *all), query)
+	for i, s := range syms {
+		if i >= maxSymbols {
+			fmt.Fprintf(cx.Output, "... %d more\n", len(syms)-i)
+			break
+		}
+		p := s.Pos
+		fmt.Fprintf(cx.Output, "%s:%d:%d: %s %s (%s)\n",
+			mgutil.ShortFn(p.Filename, cx.Env), p.Line, p.Column, s.Kind, s.QualName(), s.PkgName)
+	}
+	fmt.Fprintf(cx.Output, "golang.symbols: %d symbols matching `%s`\n", len(syms), query)
+
+	if len(syms) > maxSymbols {
+		syms = syms[:maxSymbols]
+	}
+	sc.mu.Lock()
+	sc.query, sc.last = query, syms
+	sc.mu.Unlock()
+}
+
+// activate parses the location pos in the form path:line:col
+func (sc *symbolsCmd) activate(pos string) (mg.Activate, error) {
+	act := mg.Activate{}
+	l := strings.Split(pos, ":")
+	if len(l) < 3 {
+		return act, fmt.Errorf("invalid location `%s`, expected path:line:col", pos)
+	}
+	line, err1 := strconv.Atoi(l[len(l)-2])
+	col, err2 := strconv.Atoi(l[len(l)-1])
+	if err1 != nil || err2 != nil || line < 1 || col < 1 {
+		return act, fmt.Errorf("invalid location `%s`, expected path:line:col", pos)
+	}
+	act.Path = strings.Join(l[:len(l)-2], ":")
+	act.Row = line - 1
+	act.Col = col - 1
+	return act, nil
+}
+
+// symbolsIndex returns the symbols declared in the packages of the current project.
+// If all is true, the packages known to the agent (see pkglst) are included as well.
+//
+// The symbols of each file and directory are stored in its VFS memo,
+// so only files that changed since the last call are parsed again.
+func symbolsIndex(mx *mg.Ctx, all bool) []goSym {
+	pkgs := projectPkgs(mx, projectRoot(mx, mx.View.Dir()))
+	if all {
+		pkgs = append(pkgs, mctl.plst.View().List...)
+	}
+
+	seen := map[string]bool{}
+	syms := []goSym{}
+	for _, p := range pkgs {
+		if seen[p.Dir] {
+			continue
+		}
+		seen[p.Dir] = true
+		syms = append(syms, symbolsDir(mx.VFS.Poke(p.Dir))...)
+	}
+	return syms
+}
+
+func symbolsDir(dirNd *vfs.Node) []goSym {
+	type K struct{}
+	return dirNd.ReadMemo(K{}, func() interface{} {
+		syms := []goSym{}
+		for _, nd := range dirNd.Ls().Filter(symbolsNdFilter).Sorted().Nodes() {
+			syms = append(syms, symbolsFile(nd)...)
+		}
+		return syms
+	}).([]goSym)
+}
+
+func symbolsNdFilter(nd *vfs.Node) bool {
+	nm := nd.Name()
+	return nm[0] != '.' && nm[0] != '_' && strings.HasSuffix(nm, ".go")
+}
+
+func symbolsFile(nd *vfs.Node) []goSym {
+	type K struct{}
+	return nd.ReadMemo(K{}, func() interface{} {
+		fn := nd.Path()
+		src, err := nd.ReadBlob().ReadFile()
+		if err != nil {
+			return []goSym(nil)
+		}
+		fset := token.NewFileSet()
+		af, _ := parser.ParseFile(fset, fn, src, 0)
+		if af == nil {
+			return []goSym(nil)
+		}
+		return symbolsDecls(fset, af)
+	}).([]goSym)
+}
+
+// symbolsDecls returns the list of top-level declarations in af
+func symbolsDecls(fset *token.FileSet, af *ast.File) []goSym {
+	syms := []goSym{}
+	add := func(id *ast.Ident, kind, recv string) {
+		if id == nil || id.Name == "_" {
+			return
+		}
+		syms = append(syms, goSym{
+			Name:    id.Name,
+			Kind:    kind,
+			Recv:    recv,
+			PkgName: af.Name.Name,
+			Pos:     fset.Position(id.Pos()),
+		})
+	}
+	for _, d := range af.Decls {
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			if d.Recv == nil || len(d.Recv.List) == 0 {
+				add(d.Name, "func", "")
+			} else {
+				add(d.Name, "method", symbolsRecvName(d.Recv.List[0].Type))
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					add(spec.Name, "type", "")
+				case *ast.ValueSpec:
+					kind := "var"
+					if d.Tok == token.CONST {
+						kind = "const"
+					}
+					for _, id := range spec.Names {
+						add(id, kind, "")
+					}
+				}
+			}
+		}
+	}
+	return syms
+}
+
+// symbolsRecvName returns the name of the receiver type x e.g. `T` for `*T`
+func symbolsRecvName(x ast.Expr) string {
+	for {
+		switch t := x.(type) {
+		case *ast.StarExpr:
+			x = t.X
+		case *ast.ParenExpr:
+			x = t.X
+		case *ast.IndexExpr:
+			x = t.X
+		case *ast.Ident:
+			return t.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// symbolsSearch returns the symbols in syms that match query, best matches first.
+// If query contains a `.`, it's matched against the symbol name qualified with its receiver.
+func symbolsSearch(syms []goSym, query string) []goSym {
+	type match struct {
+		goSym
+		score int
+	}
+	qual := strings.Contains(query, ".")
+	l := []match{}
+	for _, s := range syms {
+		nm := s.Name
+		if qual {
+			nm = s.QualName()
+		}
+		if score, ok := fuzzyMatch(query, nm); ok {
+			l = append(l, match{goSym: s, score: score})
+		}
+	}
+	sort.SliceStable(l, func(i, j int) bool {
+		a, b := l[i], l[j]
+		switch {
+		case a.score != b.score:
+			return a.score > b.score
+		case len(a.Name) != len(b.Name):
+			return len(a.Name) < len(b.Name)
+		case a.Name != b.Name:
+			return a.Name < b.Name
+		case a.Pos.Filename != b.Pos.Filename:
+			return a.Pos.Filename < b.Pos.Filename
+		default:
+			return a.Pos.Offset < b.Pos.Offset
+		}
+	})
+	res := make([]goSym, len(l))
+	for i, m := range l {
+		res[i] = m.goSym
+	}
+	return res
+}
+
+// fuzzyMatch reports whether all the chars of query appear in name, in order, ignoring case.
+//
+// The score is higher for exact and prefix matches, chars that match at the start
+// of a word (e.g. `rq` in `ReadQuery`) and consecutive chars.
+func fuzzyMatch(query, name string) (score int, ok bool) {
+	switch {
+	case query == "":
+		return 0, false
+	case query == name:
+		return 1000, true
+	case strings.EqualFold(query, name):
+		return 900, true
+	}
+
+	ni := 0
+	prevMatch := -2
+	for qi, qc := range query {
+		qc = unicode.ToLower(qc)
+		found := false
+		for ni < len(name) {
+			nc, n := utf8.DecodeRuneInString(name[ni:])
+			i := ni
+			ni += n
+			if unicode.ToLower(nc) != qc {
+				continue
+			}
+			found = true
+			switch {
+			case i == 0:
+				score += 30
+				if qi == 0 {
+					score += 30
+				}
+			case isWordStart(name, i):
+				score += 20
+			case i == prevMatch+1:
+				score += 10
+			default:
+				score += 1
+			}
+			if qc == nc && unicode.IsUpper(nc) {
+				score += 2
+			}
+			prevMatch = i
+			break
+		}
+		if !found {
+			return 0, false
+		}
+	}
+	return score, true
+}
+
+// isWordStart reports whether the char at index i in s begins a word
+// e.g. the `Q` in `ReadQuery` or the `q` in `read_query`
+func isWordStart(s string, i int) bool {
+	p, _ := utf8.DecodeLastRuneInString(s[:i])
+	c, _ := utf8.DecodeRuneInString(s[i:])
+	switch {
+	case p == '_' || p == '.':
+		return true
+	case unicode.IsUpper(c) && !unicode.IsUpper(p):
+		return true
+	case unicode.IsDigit(c) && !unicode.IsDigit(p):
+		return true
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package golang
+
+import (
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+func TestSymbolsSearch(t *testing.T) {
+	src := `package p
+
+type Reader struct{}
+
+func (r *Reader) ReadQuery() {}
+
+func NewReader() *Reader { return nil }
+
+func readq() {}
+
+var (
+	_        = 0
+	MaxRead = 1
+)
+
+const Query = ""
+`
+	fset := token.NewFileSet()
+	af, err := parser.ParseFile(fset, "p.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	syms := symbolsDecls(fset, af)
+	if len(syms) != 6 {
+		t.Fatalf("expected 6 symbols, got %d: %v", len(syms), syms)
+	}
+
+	cases := []struct {
+		query string
+		names []string
+	}{
+		{"Reader", []string{"Reader", "Reader.ReadQuery", "NewReader"}},
+		{"rq", []string{"Reader.ReadQuery", "readq"}},
+		{"Reader.Query", []string{"Reader.ReadQuery"}},
+		{"query", []string{"Query", "Reader.ReadQuery"}},
+		{"xyz", nil},
+	}
+	for _, c := range cases {
+		res := symbolsSearch(syms, c.query)
+		names := []string{}
+		for _, s := range res {
+			names = append(names, s.QualName())
+		}
+		if len(names) != len(c.names) {
+			t.Errorf("symbolsSearch(%q): expected %q, got %q", c.query, c.names, names)
+			continue
+		}
+		for i, nm := range c.names {
+			if names[i] != nm {
+				t.Errorf("symbolsSearch(%q): expected %q, got %q", c.query, c.names, names)
+				break
+			}
+		}
+	}
+}
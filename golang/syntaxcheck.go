@@ -4,6 +4,7 @@ import (
 	"go/scanner"
 	"margo.sh/mg"
 	"margo.sh/mgutil"
+	"strings"
 )
 
 type SyntaxCheck struct {
@@ -45,11 +46,11 @@ func (sc *SyntaxCheck) check(mx *mg.Ctx) {
 	type iKey struct{}
 	mx.Store.Dispatch(mg.StoreIssues{
 		IssueKey: mg.IssueKey{Key: iKey{}},
-		Issues:   sc.errsToIssues(mx.View, pf.ErrorList),
+		Issues:   sc.errsToIssues(mx.View, src, pf.ErrorList),
 	})
 }
 
-func (sc *SyntaxCheck) errsToIssues(v *mg.View, el scanner.ErrorList) mg.IssueSet {
+func (sc *SyntaxCheck) errsToIssues(v *mg.View, src []byte, el scanner.ErrorList) mg.IssueSet {
 	issues := make(mg.IssueSet, len(el))
 	for i, e := range el {
 		issues[i] = mg.Issue{
@@ -60,7 +61,25 @@ func (sc *SyntaxCheck) errsToIssues(v *mg.View, el scanner.ErrorList) mg.IssueSe
 			Message: e.Msg,
 			Tag:     mg.Error,
 			Label:   "Go/SyntaxCheck",
+			Fixes:   sc.fixes(src, e),
 		}
 	}
 	return issues
 }
+
+// fixes returns the list of fixes for the syntax error e
+func (sc *SyntaxCheck) fixes(src []byte, e *scanner.Error) []mg.IssueFix {
+	ofs := e.Pos.Offset
+	if ofs < 0 || ofs > len(src) {
+		return nil
+	}
+	// e.g. `missing ',' before newline in composite literal`
+	if strings.HasPrefix(e.Msg, "missing ',' before newline") {
+		return []mg.IssueFix{{
+			Title: "Add missing ','",
+			Edits: []mg.TextEdit{mg.NewTextEdit(src, ofs, ofs, ",")},
+			Hash:  mg.SrcHash(src),
+		}}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package golang
+
+import (
+	"io/ioutil"
+	"margo.sh/golang/goutil"
+	"margo.sh/mg"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testModule creates the module example.com/m in a temporary directory.
+// files maps the paths of the module's files, relative to its root, to their content.
+// go.mod is created if it's not in files.
+func testModule(t *testing.T, files map[string]string) (mx *mg.Ctx, dir string, cleanup func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "margo-golang-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the temp dir might be a symlink e.g. on macOS
+	if s, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = s
+	}
+	if _, ok := files["go.mod"]; !ok {
+		files["go.mod"] = "module example.com/m\n"
+	}
+	for nm, src := range files {
+		fn := filepath.Join(dir, filepath.FromSlash(nm))
+		if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fn, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mx = mg.NewTestingCtx(nil)
+	mx = mx.SetState(mx.State.SetEnv(mx.Env.Set(goutil.ModEnvVar, "on")))
+	return mx, dir, func() { os.RemoveAll(dir) }
+}
+
+// testView returns mx with its view set to the file nm in dir.
+// The cursor is placed at the '|' in at, which is matched against the file's content without the '|'.
+func testView(t *testing.T, mx *mg.Ctx, dir, nm, at string) *mg.Ctx {
+	t.Helper()
+	fn := filepath.Join(dir, filepath.FromSlash(nm))
+	src, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pos := 0
+	if at != "" {
+		i := strings.Index(string(src), strings.Replace(at, "|", "", 1))
+		if i < 0 {
+			t.Fatalf("%q not found in %s", at, nm)
+		}
+		pos = i + strings.Index(at, "|")
+	}
+	return mx.SetView(&mg.View{
+		Path: fn,
+		Wd:   filepath.Dir(fn),
+		Name: filepath.Base(fn),
+		Src:  src,
+		Pos:  pos,
+		Ext:  filepath.Ext(fn),
+		Lang: mg.Go,
+	})
+}
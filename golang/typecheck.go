@@ -21,9 +21,11 @@ import (
 var (
 	typChkR = &typChk{
 		cfg: TypeCheck{
-			NoIssues:  true,
-			NoInfo:    true,
-			NoGotoDef: true,
+			NoIssues:     true,
+			NoInfo:       true,
+			NoGotoDef:    true,
+			NoReferences: true,
+			NoTooltips:   true,
 		},
 	}
 )
@@ -40,9 +42,11 @@ type tcInfo struct {
 
 type TypeCheck struct {
 	mg.ReducerType
-	NoIssues  bool
-	NoInfo    bool
-	NoGotoDef bool
+	NoIssues     bool
+	NoInfo       bool
+	NoGotoDef    bool
+	NoReferences bool
+	NoTooltips   bool
 }
 
 func (tc *TypeCheck) RInit(mx *mg.Ctx) {
@@ -60,9 +64,11 @@ type typChk struct {
 
 	infQ *mgutil.ChanQ
 
-	mu    sync.Mutex
-	cfg   TypeCheck
-	infEl htm.Element
+	mu      sync.Mutex
+	cfg     TypeCheck
+	infEl   htm.Element
+	refsHdr htm.IElement
+	refsEls []htm.Element
 }
 
 func (tc *typChk) configure(c TypeCheck) {
@@ -109,6 +115,10 @@ func (tc *typChk) Reduce(mx *mg.Ctx) *mg.State {
 		tc.infQ.Put(mx)
 	case mg.ViewModified, mg.ViewSaved:
 		tc.isuQ.Put(mx)
+		// the reference positions are probably stale now
+		tc.mu.Lock()
+		tc.refsHdr, tc.refsEls = nil, nil
+		tc.mu.Unlock()
 	case mg.ViewPosChanged:
 		tc.infQ.Put(mx)
 	case mg.QueryUserCmds:
@@ -118,21 +128,44 @@ func (tc *typChk) Reduce(mx *mg.Ctx) *mg.State {
 				Name:  "typecheck.definition",
 				Desc:  "Go to the declaration of selected identifier",
 			},
+			mg.UserCmd{
+				Title: "Find References",
+				Name:  "typecheck.references",
+				Desc:  "List the references to the selected identifier",
+			},
 		)
 	case mg.RunCmd:
 		st = tc.handleRunCmd(mx, st, act)
+	case mg.QueryTooltips:
+		if !tc.config().NoTooltips {
+			st = st.AddTooltips(tc.tooltips(mx, act)...)
+		}
 	}
 
 	tc.mu.Lock()
 	if tc.infEl != nil {
 		st = st.AddHUD(htm.Text("TypeInfo"), tc.infEl)
 	}
+	if tc.refsHdr != nil {
+		st = st.AddHUD(tc.refsHdr, tc.refsEls...)
+	}
 	tc.mu.Unlock()
 
 	return st
 }
 
 func (tc *typChk) handleRunCmd(mx *mg.Ctx, st *mg.State, rc mg.RunCmd) *mg.State {
+	if rc.Name == "typecheck.references" && !tc.config().NoReferences {
+		return st.AddBuiltinCmds(mg.BuiltinCmd{
+			Name: rc.Name,
+			Desc: "List the references to the selected identifier",
+			Run: func(cx *mg.CmdCtx) *mg.State {
+				go tc.findRefsCmd(cx)
+				return cx.State
+			}},
+		)
+	}
+
 	ok := !tc.config().NoGotoDef && (rc.Name == "goto.definition" ||
 		rc.Name == "typecheck.definition" ||
 		(rc.Name == mg.RcActuate && rc.StringFlag("button", "left") == "left"))
@@ -163,6 +196,7 @@ func (tc *typChk) gotoDef(cx *mg.CmdCtx) {
 		return
 	}
 	fmt.Fprintf(cx.Output, "TypeCheck: Identifier: %s, Definition: %s", ti.Id, tp)
+	act.Cookie = cx.Cookie
 	cx.Store.Dispatch(act)
 }
 
@@ -181,6 +215,8 @@ func (tc *typChk) isuProc(mx *mg.Ctx) {
 	v := mx.View
 	_, err := tc.importPkg(mx)
 	issues := tc.errToIssues(mx, v, err)
+	src, _ := v.ReadAll()
+	vpf := goutil.ParseFile(mx, v.Filename(), src)
 	for i, isu := range issues {
 		if isu.Path == "" {
 			isu.Path = v.Path
@@ -188,6 +224,9 @@ func (tc *typChk) isuProc(mx *mg.Ctx) {
 		}
 		isu.Label = "Go/typeCheck"
 		isu.Tag = mg.Error
+		if isu.InView(v) {
+			isu.Fixes = tc.fixes(mx, vpf, src, isu)
+		}
 		issues[i] = isu
 	}
 
@@ -267,16 +306,21 @@ func (tc *typChk) infProc(mx *mg.Ctx) {
 }
 
 func (tc *typChk) info(mx *mg.Ctx) (*tcInfo, error) {
+	return tc.infoAt(mx, mx.View.Pos)
+}
+
+// infoAt returns info about the identifier at offset off in the view
+func (tc *typChk) infoAt(mx *mg.Ctx, off int) (*tcInfo, error) {
 	// TODO: caching?
 	// kimporter's caching should be fast enough to allow us to do this on every ViewPosChanged
 	v := mx.View
 	src, _ := v.ReadAll()
 	pf := goutil.ParseFile(mx, v.Filename(), src)
-	switch pos := pf.TokenFile.Pos(v.Pos); {
+	switch pos := pf.TokenFile.Pos(off); {
 	case !pos.IsValid():
-		return nil, fmt.Errorf("Invalid cursor position %d", v.Pos)
+		return nil, fmt.Errorf("Invalid cursor position %d", off)
 	case goutil.IdentAt(pf.AstFile, pos) == nil:
-		return nil, fmt.Errorf("No identifier at cursor position %d", v.Pos)
+		return nil, fmt.Errorf("No identifier at cursor position %d", off)
 	}
 
 	ti := &tcInfo{}
@@ -302,13 +346,13 @@ func (tc *typChk) info(mx *mg.Ctx) (*tcInfo, error) {
 	if tf == nil {
 		return nil, fmt.Errorf("Cannot find token file: %s", v.Basename())
 	}
-	pos := tf.Pos(v.Pos)
+	pos := tf.Pos(off)
 	if !pos.IsValid() {
-		return nil, fmt.Errorf("Invalid cursor position: %d", v.Pos)
+		return nil, fmt.Errorf("Invalid cursor position: %d", off)
 	}
 	ti.Id = goutil.IdentAt(af, pos)
 	if ti.Id == nil {
-		return nil, fmt.Errorf("No identifer at position: %d", v.Pos)
+		return nil, fmt.Errorf("No identifer at position: %d", off)
 	}
 	ti.Obj = ti.Pkg.Info.ObjectOf(ti.Id)
 	if ti.Obj == nil {
@@ -0,0 +1,217 @@
+package golang
+
+import (
+	"bytes"
+	"go/ast"
+	"go/token"
+	"golang.org/x/tools/go/ast/astutil"
+	"margo.sh/golang/gopkg"
+	"margo.sh/golang/goutil"
+	"margo.sh/mg"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxImportFixes is the maximum number of packages suggested for an undefined package name
+	maxImportFixes = 5
+)
+
+var (
+	tcUnusedImportPat = regexp.MustCompile(`^"([^"]+)" imported (?:as \w+ )?and not used`)
+	tcUnusedVarPat    = regexp.MustCompile(`^(?:declared and not used: (\w+)|(\w+) declared (?:but|and) not used)$`)
+	tcUndefinedPat    = regexp.MustCompile(`^(?:undefined|undeclared name): (\w+)$`)
+)
+
+// fixes returns the list of fixes for the type-check issue isu in the view's file
+func (tc *typChk) fixes(mx *mg.Ctx, pf *goutil.ParsedFile, src []byte, isu mg.Issue) []mg.IssueFix {
+	tf := pf.TokenFile
+	if isu.Row < 0 || isu.Row >= tf.LineCount() {
+		return nil
+	}
+	pos := tf.LineStart(isu.Row+1) + token.Pos(isu.Col)
+	if !pos.IsValid() || tf.Offset(pos) > len(src) {
+		return nil
+	}
+
+	if m := tcUnusedImportPat.FindStringSubmatch(isu.Message); m != nil {
+		return tc.unusedImportFixes(pf, src, pos, m[1])
+	}
+	if m := tcUnusedVarPat.FindStringSubmatch(isu.Message); m != nil {
+		return tc.unusedVarFixes(pf, src, pos, m[1]+m[2])
+	}
+	if m := tcUndefinedPat.FindStringSubmatch(isu.Message); m != nil {
+		return tc.importFixes(mx, pf, src, pos, m[1])
+	}
+	return nil
+}
+
+// unusedImportFixes returns a fix that deletes the import of ipath at pos
+func (tc *typChk) unusedImportFixes(pf *goutil.ParsedFile, src []byte, pos token.Pos, ipath string) []mg.IssueFix {
+	tf := pf.TokenFile
+	for _, d := range pf.AstFile.Decls {
+		gd, ok := d.(*ast.GenDecl)
+		if !ok || gd.Tok != token.IMPORT || pos < gd.Pos() || pos > gd.End() {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			is := spec.(*ast.ImportSpec)
+			if s, _ := strconv.Unquote(is.Path.Value); s != ipath {
+				continue
+			}
+			start, end := is.Pos(), is.End()
+			if len(gd.Specs) == 1 {
+				// delete the whole declaration
+				start, end = gd.Pos(), gd.End()
+				if gd.Doc != nil {
+					start = gd.Doc.Pos()
+				}
+			} else if tf.Line(gd.Lparen) == tf.Line(start) || tf.Line(gd.Rparen) == tf.Line(end) {
+				// it's not alone on its line so we can't delete the line
+				return nil
+			} else if is.Doc != nil {
+				start = is.Doc.Pos()
+			}
+			so, eo := tc.lineBounds(src, tf.Offset(start), tf.Offset(end))
+			return []mg.IssueFix{{
+				Title: "Remove import " + is.Path.Value,
+				Edits: []mg.TextEdit{mg.NewTextEdit(src, so, eo, "")},
+				Hash:  mg.SrcHash(src),
+			}}
+		}
+	}
+	return nil
+}
+
+// lineBounds expands the range [start, end) to include the whole lines, and the trailing newline
+func (tc *typChk) lineBounds(src []byte, start, end int) (int, int) {
+	start = bytes.LastIndexByte(src[:start], '\n') + 1
+	if i := bytes.IndexByte(src[end:], '\n'); i >= 0 {
+		end += i + 1
+	} else {
+		end = len(src)
+	}
+	return start, end
+}
+
+// unusedVarFixes returns a fix that uses the variable name declared at pos by assigning it to `_`
+func (tc *typChk) unusedVarFixes(pf *goutil.ParsedFile, src []byte, pos token.Pos, name string) []mg.IssueFix {
+	tf := pf.TokenFile
+	path, _ := astutil.PathEnclosingInterval(pf.AstFile, pos, pos)
+	if len(path) == 0 {
+		return nil
+	}
+	if id, ok := path[0].(*ast.Ident); !ok || id.Name != name {
+		return nil
+	}
+
+	indent := func(n ast.Node) string {
+		ofs := tf.Offset(n.Pos())
+		ln := src[bytes.LastIndexByte(src[:ofs], '\n')+1 : ofs]
+		return string(ln[:len(ln)-len(bytes.TrimLeft(ln, " \t"))])
+	}
+	fix := func(ofs int, text string) []mg.IssueFix {
+		return []mg.IssueFix{{
+			Title: "Use " + name + " with `_ = " + name + "`",
+			Edits: []mg.TextEdit{mg.NewTextEdit(src, ofs, ofs, text)},
+			Hash:  mg.SrcHash(src),
+		}}
+	}
+	for i, n := range path[1:] {
+		child := path[i]
+		var body *ast.BlockStmt
+		switch n := n.(type) {
+		case *ast.TypeSwitchStmt:
+			// the variable can't be used before the first case
+			return nil
+		case *ast.RangeStmt:
+			if child != n.Body {
+				body = n.Body
+			}
+		case *ast.ForStmt:
+			if child == n.Init {
+				body = n.Body
+			}
+		case *ast.IfStmt:
+			if child == n.Init {
+				body = n.Body
+			}
+		case *ast.SwitchStmt:
+			if child == n.Init {
+				return nil
+			}
+		case *ast.BlockStmt, *ast.CaseClause, *ast.CommClause:
+			stmt, ok := child.(ast.Stmt)
+			if !ok {
+				return nil
+			}
+			return fix(tf.Offset(stmt.End()), "\n"+indent(stmt)+"_ = "+name)
+		case *ast.FuncDecl, *ast.FuncLit:
+			return nil
+		}
+		if body != nil {
+			return fix(tf.Offset(body.Lbrace)+1, "\n"+indent(n)+"\t_ = "+name)
+		}
+	}
+	return nil
+}
+
+// importFixes returns fixes that import packages named name,
+// if name is used as a package name at pos
+func (tc *typChk) importFixes(mx *mg.Ctx, pf *goutil.ParsedFile, src []byte, pos token.Pos, name string) []mg.IssueFix {
+	path, _ := astutil.PathEnclosingInterval(pf.AstFile, pos, pos)
+	if len(path) < 2 {
+		return nil
+	}
+	id, ok := path[0].(*ast.Ident)
+	if !ok || id.Name != name {
+		return nil
+	}
+	if sel, ok := path[1].(*ast.SelectorExpr); !ok || sel.X != id {
+		return nil
+	}
+
+	dir := mx.View.Dir()
+	pkgs := []*gopkg.Pkg{}
+	for _, p := range mctl.plst.View().ByName[name] {
+		if p.Importable(dir) {
+			pkgs = append(pkgs, p)
+		}
+	}
+	// prefer the package margocode would import, std packages, then the shortest import paths
+	pref := mctl.importPathByName(name, dir)
+	isStd := func(p *gopkg.Pkg) bool {
+		return !strings.Contains(strings.SplitN(p.ImportPath, "/", 2)[0], ".")
+	}
+	sort.SliceStable(pkgs, func(i, j int) bool {
+		p, q := pkgs[i], pkgs[j]
+		switch {
+		case (p.ImportPath == pref) != (q.ImportPath == pref):
+			return p.ImportPath == pref
+		case isStd(p) != isStd(q):
+			return isStd(p)
+		case len(p.ImportPath) != len(q.ImportPath):
+			return len(p.ImportPath) < len(q.ImportPath)
+		}
+		return p.ImportPath < q.ImportPath
+	})
+	if len(pkgs) > maxImportFixes {
+		pkgs = pkgs[:maxImportFixes]
+	}
+
+	fixes := []mg.IssueFix{}
+	for _, p := range pkgs {
+		dst, _, err := impSpecList{{Path: p.ImportPath}}.mergeWithSrc(mx.View.Filename(), src)
+		if err != nil || bytes.Equal(src, dst) {
+			continue
+		}
+		fixes = append(fixes, mg.IssueFix{
+			Title: "Import " + strconv.Quote(p.ImportPath),
+			Edits: []mg.TextEdit{srcTextEdit(src, dst)},
+			Hash:  mg.SrcHash(src),
+		})
+	}
+	return fixes
+}
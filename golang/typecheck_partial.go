@@ -0,0 +1,142 @@
+package golang
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"golang.org/x/tools/go/ast/astutil"
+	kim "margo.sh/kimporter"
+	"margo.sh/mg"
+	"path/filepath"
+	"strings"
+)
+
+// partialPkg holds type info about the current view's package while it's being edited
+type partialPkg struct {
+	Pkg  *types.Package
+	Fset *token.FileSet
+	File *ast.File
+	Info *types.Info
+}
+
+// checkPartialPkg type-checks the current view's package, using src as the content of the view.
+//
+// Unlike kimporter, type errors are ignored so type info is available for incomplete code e.g. while typing.
+// The view's file is parsed with comments.
+// The other files in the package are checked without function bodies, and imports are loaded by kimporter.
+// It returns nil if src cannot be parsed.
+func checkPartialPkg(mx *mg.Ctx, src []byte) *partialPkg {
+	defer mx.Profile.Push("checkPartialPkg").Pop()
+
+	return checkPartial(mx, src, -1)
+}
+
+// checkPartialFunc is like checkPartialPkg, but only the body of the function enclosing the byte offset pos is checked.
+// It's cheaper when only the types of expressions near pos are needed.
+func checkPartialFunc(mx *mg.Ctx, src []byte, pos int) *partialPkg {
+	defer mx.Profile.Push("checkPartialFunc").Pop()
+
+	return checkPartial(mx, src, pos)
+}
+
+// checkPartial implements checkPartialPkg and checkPartialFunc.
+// If pos is negative, all function bodies in the view's file are checked.
+func checkPartial(mx *mg.Ctx, src []byte, pos int) *partialPkg {
+	v := mx.View
+	fset := token.NewFileSet()
+	af, _ := parser.ParseFile(fset, v.Filename(), src, parser.ParseComments)
+	if af == nil || af.Name == nil {
+		return nil
+	}
+	if tf := fset.File(af.Pos()); pos >= 0 && tf != nil && pos <= tf.Size() {
+		p := tf.Pos(pos)
+		for _, d := range af.Decls {
+			if fd, ok := d.(*ast.FuncDecl); ok && fd.Body != nil && (p < fd.Body.Pos() || p > fd.Body.End()) {
+				fd.Body = nil
+			}
+		}
+	}
+	pp := &partialPkg{
+		Fset: fset,
+		File: af,
+		Info: &types.Info{
+			Types: map[ast.Expr]types.TypeAndValue{},
+			Defs:  map[*ast.Ident]types.Object{},
+			Uses:  map[*ast.Ident]types.Object{},
+		},
+	}
+	tc := types.Config{
+		FakeImportC: true,
+		Importer:    kim.New(mx, nil),
+		Error:       func(error) {},
+	}
+	files := append([]*ast.File{af}, partialPkgFiles(mx, fset, af.Name.Name)...)
+	pp.Pkg, _ = tc.Check("", fset, files, pp.Info)
+	return pp
+}
+
+// partialPkgFiles parses the other files in the view's package.
+// Function bodies are removed because we're only interested in the declarations.
+func partialPkgFiles(mx *mg.Ctx, fset *token.FileSet, pkgName string) []*ast.File {
+	v := mx.View
+	if v.Path == "" {
+		return nil
+	}
+	dir := v.Dir()
+	bctx := BuildContext(mx)
+	tests := strings.HasSuffix(v.Filename(), "_test.go")
+	l := []*ast.File{}
+	for _, nd := range mx.VFS.Poke(dir).Ls().Nodes() {
+		nm := nd.Name()
+		switch {
+		case nm == v.Basename(), !strings.HasSuffix(nm, ".go"):
+			continue
+		case !tests && strings.HasSuffix(nm, "_test.go"):
+			continue
+		}
+		if ok, _ := bctx.MatchFile(dir, nm); !ok {
+			continue
+		}
+		src, err := nd.ReadBlob().ReadFile()
+		if err != nil {
+			continue
+		}
+		af, _ := parser.ParseFile(fset, filepath.Join(dir, nm), src, 0)
+		if af == nil || af.Name == nil || af.Name.Name != pkgName {
+			continue
+		}
+		for _, d := range af.Decls {
+			if fd, ok := d.(*ast.FuncDecl); ok {
+				fd.Body = nil
+			}
+		}
+		l = append(l, af)
+	}
+	return l
+}
+
+// path returns the path to the nodes enclosing the byte offsets [start, end) in the view's file
+func (pp *partialPkg) path(start, end int) []ast.Node {
+	tf := pp.Fset.File(pp.File.Pos())
+	if tf == nil || start < 0 || end > tf.Size() || start > end {
+		return nil
+	}
+	path, _ := astutil.PathEnclosingInterval(pp.File, tf.Pos(start), tf.Pos(end))
+	return path
+}
+
+// offset returns the byte offset of p in the view's file
+func (pp *partialPkg) offset(p token.Pos) int {
+	return pp.Fset.File(pp.File.Pos()).Offset(p)
+}
+
+// typeString returns the string representation of t, qualified in the same way as Gocode candidates
+func (pp *partialPkg) typeString(t types.Type) string {
+	return types.TypeString(t, func(p *types.Package) string {
+		if p == pp.Pkg {
+			return ""
+		}
+		return p.Name()
+	})
+}
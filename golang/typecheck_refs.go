@@ -0,0 +1,338 @@
+package golang
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"margo.sh/golang/goutil"
+	"margo.sh/htm"
+	kim "margo.sh/kimporter"
+	"margo.sh/mg"
+	"margo.sh/mgutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// maxRefsHUD is the maximum number of references listed in the HUD
+	maxRefsHUD = 50
+)
+
+// tcRef is a reference to, or the definition of, an object
+type tcRef struct {
+	Pos token.Position
+	Def bool
+	Id  *ast.Ident
+	Obj types.Object
+	Pkg *kim.Package
+}
+
+// tcObjKey identifies an object across separately type-checked packages.
+// Objects imported from export data only have line info,
+// so the packages searched by findRefs are type-checked without the disk cache.
+type tcObjKey struct {
+	Filename string
+	Line     int
+	Column   int
+	Name     string
+}
+
+func (tc *typChk) findRefsCmd(cx *mg.CmdCtx) {
+	defer cx.Output.Close()
+
+	ti, err := tc.info(cx.Ctx)
+	if err != nil {
+		fmt.Fprintf(cx.Output, "TypeCheck: %s\n", err)
+		return
+	}
+	refs, err := tc.findRefs(cx.Ctx, ti)
+	if err != nil {
+		fmt.Fprintf(cx.Output, "TypeCheck: %s\n", err)
+		return
+	}
+
+	lines := newSrcLines(cx.Ctx)
+	els := make([]htm.Element, 0, len(refs))
+	for _, r := range refs {
+		fn := mgutil.ShortFn(r.Pos.Filename, cx.Env)
+		s := strings.TrimSpace(lines.Line(r.Pos.Filename, r.Pos.Line))
+		fmt.Fprintf(cx.Output, "%s:%d:%d: %s\n", fn, r.Pos.Line, r.Pos.Column, s)
+		act := mg.Activate{Path: r.Pos.Filename, Row: r.Pos.Line - 1, Col: r.Pos.Column - 1}
+		if len(els) < maxRefsHUD {
+			els = append(els, htm.A(&htm.AAttrs{Action: act}, htm.Textf("%s:%d: %s", fn, r.Pos.Line, s)))
+		}
+	}
+	fmt.Fprintf(cx.Output, "TypeCheck: %d references to %s\n", len(refs), ti.Obj.Name())
+
+	tc.mu.Lock()
+	tc.refsHdr = htm.Textf("References: %s ( %d )", ti.Obj.Name(), len(refs))
+	tc.refsEls = els
+	tc.mu.Unlock()
+	cx.Store.Dispatch(mg.Render)
+}
+
+// findRefs returns the list of references to, and definitions of, the object ti.Obj.
+//
+// Exported objects are searched for in all packages of the current project (see projectPkgs),
+// including external test packages, otherwise only the current package is searched.
+func (tc *typChk) findRefs(mx *mg.Ctx, ti *tcInfo) ([]tcRef, error) {
+	obj := ti.Obj
+	if obj.Pkg() == nil {
+		return nil, fmt.Errorf("%s is a builtin", obj.Name())
+	}
+
+	v := mx.View
+	src, _ := v.ReadAll()
+	newConfig := func(dir string) *kim.Config {
+		kc := &kim.Config{
+			CheckFuncs:  true,
+			Tests:       true,
+			SrcMap:      map[string][]byte{v.Filename(): src},
+			TypesInfo:   kim.TypesInfoDefs | kim.TypesInfoUses,
+			NoDiskCache: true,
+		}
+		if v.Path == "" && dir == v.Dir() {
+			kc.PackageSrc = map[string][]byte{v.Basename(): src}
+		}
+		return kc
+	}
+
+	// ti.Pkg's dependencies might have been loaded from export data without columns,
+	// so the target is looked up again in a package type-checked from src
+	viewCfg := newConfig(v.Dir())
+	viewPkg, _ := kim.New(mx, viewCfg).ImportPackage(".", v.Dir())
+	viewXPkg := tcXTestPkg(mx, viewCfg, v.Dir())
+	target := tcObjKey{}
+	for _, pkg := range []*kim.Package{viewPkg, viewXPkg} {
+		if o := tcObjAt(pkg, ti.Pkg.Fset.Position(ti.Id.Pos())); o != nil {
+			target = tcObjKeyOf(tcPkgFsets(pkg)[o.Pkg()], o)
+			break
+		}
+	}
+	if target.Filename == "" {
+		return nil, fmt.Errorf("cannot find the declaration of %s", obj.Name())
+	}
+
+	dirs := []string{v.Dir()}
+	if obj.Exported() {
+		dirs = tc.refsDirs(mx, obj.Pkg().Path())
+	}
+
+	refs := []tcRef{}
+	add := func(pkg *kim.Package) {
+		if pkg == nil || pkg.Info == nil {
+			return
+		}
+		fsets := tcPkgFsets(pkg)
+		add := func(m map[*ast.Ident]types.Object, def bool) {
+			for id, o := range m {
+				if o == nil || o.Name() != target.Name {
+					continue
+				}
+				if tcObjKeyOf(fsets[o.Pkg()], o) != target {
+					continue
+				}
+				refs = append(refs, tcRef{
+					Pos: pkg.Fset.Position(id.Pos()),
+					Def: def,
+					Id:  id,
+					Obj: o,
+					Pkg: pkg,
+				})
+			}
+		}
+		add(pkg.Info.Defs, true)
+		add(pkg.Info.Uses, false)
+	}
+	for _, dir := range dirs {
+		if dir == v.Dir() {
+			add(viewPkg)
+			add(viewXPkg)
+			continue
+		}
+		kc := newConfig(dir)
+		pkg, _ := kim.New(mx, kc).ImportPackage(".", dir)
+		add(pkg)
+		add(tcXTestPkg(mx, kc, dir))
+	}
+
+	sort.Slice(refs, func(i, j int) bool {
+		p, q := refs[i].Pos, refs[j].Pos
+		if p.Filename != q.Filename {
+			return p.Filename < q.Filename
+		}
+		return p.Offset < q.Offset
+	})
+	return refs, nil
+}
+
+// tcObjAt returns the object defined or used by the identifier at position tp in pkg
+func tcObjAt(pkg *kim.Package, tp token.Position) types.Object {
+	if pkg == nil || pkg.Info == nil || pkg.Fset == nil {
+		return nil
+	}
+	for _, af := range pkg.Files {
+		tf := pkg.Fset.File(af.Pos())
+		if tf == nil || tf.Name() != tp.Filename || tp.Offset > tf.Size() {
+			continue
+		}
+		id := goutil.IdentAt(af, tf.Pos(tp.Offset))
+		if id == nil {
+			return nil
+		}
+		if o := pkg.Info.Defs[id]; o != nil {
+			return o
+		}
+		return pkg.Info.Uses[id]
+	}
+	return nil
+}
+
+// tcXTestPkg type-checks the external test package (package foo_test) in dir, if there is one.
+// It's not imported with kimporter because it has the same import path and dir as the package under test.
+// The packages it imports are imported using the config kc.
+func tcXTestPkg(mx *mg.Ctx, kc *kim.Config, dir string) *kim.Package {
+	bp, err := BuildContext(mx).ImportDir(dir, 0)
+	if err != nil || len(bp.XTestGoFiles) == 0 {
+		return nil
+	}
+
+	fset := token.NewFileSet()
+	files := map[string]*ast.File{}
+	list := make([]*ast.File, 0, len(bp.XTestGoFiles))
+	for _, nm := range bp.XTestGoFiles {
+		fn := filepath.Join(dir, nm)
+		src, ok := kc.SrcMap[fn]
+		if !ok {
+			src, _ = mx.VFS.ReadBlob(fn).ReadFile()
+		}
+		af, _ := parser.ParseFile(fset, fn, src, parser.ParseComments)
+		if af == nil {
+			continue
+		}
+		files[nm] = af
+		list = append(list, af)
+	}
+
+	imp := &tcImporter{kp: kim.New(mx, kc), imports: map[string]*kim.Package{}}
+	tcfg := types.Config{
+		FakeImportC: true,
+		Importer:    imp,
+		Error:       func(error) {},
+	}
+	inf := &types.Info{
+		Defs: map[*ast.Ident]types.Object{},
+		Uses: map[*ast.Ident]types.Object{},
+	}
+	pkg, _ := tcfg.Check(bp.ImportPath+"_test", fset, list, inf)
+	if pkg == nil {
+		return nil
+	}
+	return kim.NewPackage(pkg, fset, files, inf, imp.imports)
+}
+
+// tcImporter is a types.ImporterFrom that records the packages it imports
+type tcImporter struct {
+	kp      *kim.Importer
+	imports map[string]*kim.Package
+}
+
+func (ti *tcImporter) Import(path string) (*types.Package, error) {
+	return ti.ImportFrom(path, ".", 0)
+}
+
+func (ti *tcImporter) ImportFrom(path, srcDir string, mode types.ImportMode) (*types.Package, error) {
+	p, err := ti.kp.ImportPackage(path, srcDir)
+	if err != nil {
+		return nil, err
+	}
+	ti.imports[path] = p
+	return p.Package, nil
+}
+
+// refsDirs returns the list of package directories that might reference objects in the package ipath
+func (tc *typChk) refsDirs(mx *mg.Ctx, ipath string) []string {
+	v := mx.View
+	bctx := BuildContext(mx)
+	dirs := []string{v.Dir()}
+	for _, p := range projectPkgs(mx, projectRoot(mx, v.Dir())) {
+		if p.Dir == v.Dir() {
+			continue
+		}
+		bp, err := bctx.ImportDir(p.Dir, build.ImportComment)
+		if err != nil {
+			continue
+		}
+		imps := mgutil.StrSet(bp.Imports).Add(bp.TestImports...).Add(bp.XTestImports...)
+		if p.ImportPath == ipath || imps.Has(ipath) || imps.Has(tcUnvendorPath(ipath)) {
+			dirs = append(dirs, p.Dir)
+		}
+	}
+	return dirs
+}
+
+func tcUnvendorPath(ipath string) string {
+	if i := strings.LastIndex(ipath, "/vendor/"); i >= 0 {
+		return ipath[i+len("/vendor/"):]
+	}
+	return ipath
+}
+
+// tcPkgFsets returns a map of all packages (transitively) imported by pkg to the FileSet they were parsed with
+func tcPkgFsets(pkg *kim.Package) map[*types.Package]*token.FileSet {
+	m := map[*types.Package]*token.FileSet{}
+	var add func(p *kim.Package)
+	add = func(p *kim.Package) {
+		if p == nil || m[p.Package] != nil || p.Fset == nil {
+			return
+		}
+		m[p.Package] = p.Fset
+		for _, q := range p.Imports {
+			add(q)
+		}
+	}
+	add(pkg)
+	return m
+}
+
+func tcObjKeyOf(fset *token.FileSet, obj types.Object) tcObjKey {
+	if fset == nil || !obj.Pos().IsValid() {
+		return tcObjKey{Name: obj.Name()}
+	}
+	tp := fset.Position(obj.Pos())
+	return tcObjKey{Filename: tp.Filename, Line: tp.Line, Column: tp.Column, Name: obj.Name()}
+}
+
+// srcLines reads and caches lines from the view or files on disk
+type srcLines struct {
+	mx    *mg.Ctx
+	lines map[string][][]byte
+}
+
+func newSrcLines(mx *mg.Ctx) *srcLines {
+	return &srcLines{mx: mx, lines: map[string][][]byte{}}
+}
+
+// Line returns the content of line (1-based) in the file fn
+func (sl *srcLines) Line(fn string, line int) string {
+	l, ok := sl.lines[fn]
+	if !ok {
+		var src []byte
+		if v := sl.mx.View; v.Filename() == fn {
+			src, _ = v.ReadAll()
+		} else {
+			src, _ = sl.mx.VFS.ReadBlob(fn).ReadFile()
+		}
+		l = bytes.Split(src, []byte{'\n'})
+		sl.lines[fn] = l
+	}
+	if line < 1 || line > len(l) {
+		return ""
+	}
+	return string(l[line-1])
+}
@@ -0,0 +1,63 @@
+package golang
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindRefs(t *testing.T) {
+	mx, dir, cleanup := testModule(t, map[string]string{
+		"a/a.go":      "package a\n\nfunc Shadow() int { x := 1; if x := x + 1; x > 0 { return x }; return x }\n\nfunc F() {}\n",
+		"a/x_test.go": "package a_test\n\nimport \"example.com/m/a\"\n\nfunc TestF() { a.F() }\n",
+		"b/b.go":      "package b\n\nimport \"example.com/m/a\"\n\nfunc G() { a.F() }\n",
+	})
+	defer cleanup()
+
+	tests := []struct {
+		nm   string
+		at   string
+		want []string
+	}{
+		{
+			nm:   "a/a.go",
+			at:   "{ |x := 1",
+			want: []string{"a/a.go:3:21 def", "a/a.go:3:37", "a/a.go:3:71"},
+		},
+		{
+			nm:   "a/a.go",
+			at:   "if |x := x",
+			want: []string{"a/a.go:3:32 def", "a/a.go:3:44", "a/a.go:3:59"},
+		},
+		{
+			nm:   "b/b.go",
+			at:   "a.|F()",
+			want: []string{"a/a.go:5:6 def", "a/x_test.go:5:18", "b/b.go:5:14"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.at, func(t *testing.T) {
+			mx := testView(t, mx, dir, tt.nm, tt.at)
+			tc := &typChk{}
+			ti, err := tc.info(mx)
+			if err != nil {
+				t.Fatalf("info failed: %s", err)
+			}
+			refs, err := tc.findRefs(mx, ti)
+			if err != nil {
+				t.Fatalf("findRefs failed: %s", err)
+			}
+			got := make([]string, len(refs))
+			for i, r := range refs {
+				fn, _ := filepath.Rel(dir, r.Pos.Filename)
+				got[i] = fmt.Sprintf("%s:%d:%d", filepath.ToSlash(fn), r.Pos.Line, r.Pos.Column)
+				if r.Def {
+					got[i] += " def"
+				}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("findRefs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
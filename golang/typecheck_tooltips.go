@@ -0,0 +1,213 @@
+package golang
+
+import (
+	"bytes"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"golang.org/x/tools/go/ast/astutil"
+	"margo.sh/golang/goutil"
+	"margo.sh/htm"
+	"margo.sh/mg"
+	"strconv"
+	"strings"
+)
+
+// tcDecl describes the declaration of an object, for tooltips
+type tcDecl struct {
+	// Sig is the declaration's signature e.g. `func (b *Buffer) Write(p []byte) (n int, err error)`
+	Sig string
+	// PkgPath is the import path of the declaring package
+	PkgPath string
+	// Recv is the receiver type of methods, or the struct type of fields
+	Recv string
+	// Field is true if the object is a struct field
+	Field bool
+	// Doc is the declaration's doc comment
+	Doc string
+}
+
+// tooltips returns the tooltips for the identifier at the hover position qt, which may not be the cursor position
+func (tc *typChk) tooltips(mx *mg.Ctx, qt mg.QueryTooltips) []mg.Tooltip {
+	src, _ := mx.View.ReadAll()
+	off := tcRowColOffset(src, qt.Row, qt.Col)
+	if off < 0 {
+		return nil
+	}
+	ti, err := tc.infoAt(mx, off)
+	if err != nil {
+		return nil
+	}
+	d := tc.decl(mx, ti)
+	return []mg.Tooltip{{
+		Content: d.markdown(),
+		HTML:    d.html(),
+	}}
+}
+
+func (tc *typChk) decl(mx *mg.Ctx, ti *tcInfo) tcDecl {
+	obj := ti.Obj
+	d := tcDecl{}
+	qual := types.RelativeTo(obj.Pkg())
+	switch p := obj.Pkg(); {
+	case p == nil:
+	case obj.Parent() != nil && obj.Parent() != p.Scope():
+		// it's a local variable, etc.
+	case p.Path() == ".":
+		// the view's package is imported as `.`
+		d.PkgPath = projectImportPath(mx, mx.View.Dir())
+	default:
+		d.PkgPath = p.Path()
+	}
+
+	switch o := obj.(type) {
+	case *types.Func:
+		sig := o.Type().(*types.Signature)
+		buf := &bytes.Buffer{}
+		buf.WriteString("func ")
+		if r := sig.Recv(); r != nil {
+			d.Recv = types.TypeString(r.Type(), qual)
+			buf.WriteString("(")
+			if r.Name() != "" {
+				buf.WriteString(r.Name() + " ")
+			}
+			buf.WriteString(d.Recv + ") ")
+		}
+		buf.WriteString(o.Name())
+		types.WriteSignature(buf, sig, qual)
+		d.Sig = buf.String()
+	case *types.PkgName:
+		d.Sig = "import " + strconv.Quote(o.Imported().Path())
+		d.PkgPath = ""
+	default:
+		d.Sig = types.ObjectString(obj, qual)
+	}
+
+	if tp := ti.Pkg.Fset.Position(obj.Pos()); tp.IsValid() {
+		tc.declDoc(mx, &d, obj, tp)
+	}
+	return d
+}
+
+// declDoc sets d.Doc, and d.Recv for struct fields, by parsing the file in which obj is declared
+func (tc *typChk) declDoc(mx *mg.Ctx, d *tcDecl, obj types.Object, tp token.Position) {
+	var src []byte
+	if v := mx.View; v.Path == tp.Filename {
+		src, _ = v.ReadAll()
+	} else {
+		src, _ = mx.VFS.ReadBlob(tp.Filename).ReadFile()
+	}
+	// objects imported from export data only have line info
+	off := tcRowColOffset(src, tp.Line-1, 0)
+	if tp.Column > 0 {
+		off += tp.Column - 1
+	}
+	pf := goutil.ParseFile(mx, tp.Filename, src)
+	if pf.AstFile == nil || off < 0 || off >= pf.TokenFile.Size() {
+		return
+	}
+	p := pf.TokenFile.Pos(off)
+	path, _ := astutil.PathEnclosingInterval(pf.AstFile, p, p)
+	for i, n := range path {
+		switch x := n.(type) {
+		case *ast.Field:
+			d.Doc = tcCommentText(x.Doc, x.Comment)
+			if v, ok := obj.(*types.Var); ok && v.IsField() {
+				d.Recv, d.Field = tcFieldOwner(path[i:]), true
+			}
+			return
+		case *ast.FuncDecl:
+			d.Doc = x.Doc.Text()
+			return
+		case *ast.TypeSpec:
+			d.Doc = tcCommentText(x.Doc, x.Comment)
+		case *ast.ValueSpec:
+			d.Doc = tcCommentText(x.Doc, x.Comment)
+		case *ast.GenDecl:
+			// the doc of a single spec is usually attached to the GenDecl
+			if d.Doc == "" {
+				d.Doc = x.Doc.Text()
+			}
+			return
+		}
+	}
+}
+
+// tcFieldOwner returns the name of the struct type that declares the field at path[0]
+func tcFieldOwner(path []ast.Node) string {
+	for _, n := range path {
+		if ts, ok := n.(*ast.TypeSpec); ok {
+			return ts.Name.Name
+		}
+	}
+	return ""
+}
+
+func tcCommentText(l ...*ast.CommentGroup) string {
+	for _, cg := range l {
+		if s := cg.Text(); s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+func (d tcDecl) markdown() string {
+	buf := &strings.Builder{}
+	buf.WriteString("```go\n" + d.Sig + "\n```\n")
+	if s := d.info(); s != "" {
+		buf.WriteString("\n" + s + "\n")
+	}
+	if d.Doc != "" {
+		buf.WriteString("\n" + d.Doc)
+	}
+	return buf.String()
+}
+
+func (d tcDecl) html() string {
+	els := []htm.Element{
+		htm.P(nil, htm.StrongText(d.Sig)),
+	}
+	if s := d.info(); s != "" {
+		els = append(els, htm.P(nil, htm.EmText(s)))
+	}
+	for _, s := range strings.Split(strings.TrimSpace(d.Doc), "\n\n") {
+		if s != "" {
+			els = append(els, htm.P(nil, htm.Text(s)))
+		}
+	}
+	buf := &bytes.Buffer{}
+	htm.Div(nil, els...).FPrintHTML(buf)
+	return buf.String()
+}
+
+// info returns the package path and receiver e.g. `package bytes, method of *Buffer`
+func (d tcDecl) info() string {
+	l := []string{}
+	if d.PkgPath != "" {
+		l = append(l, "package "+d.PkgPath)
+	}
+	switch {
+	case d.Recv != "" && d.Field:
+		l = append(l, "field of "+d.Recv)
+	case d.Recv != "":
+		l = append(l, "method of "+d.Recv)
+	}
+	return strings.Join(l, ", ")
+}
+
+// tcRowColOffset converts the 0-based row and byte column into an offset in src, or -1 if it's out of range
+func tcRowColOffset(src []byte, row, col int) int {
+	off := 0
+	for ; row > 0; row-- {
+		i := bytes.IndexByte(src[off:], '\n')
+		if i < 0 {
+			return -1
+		}
+		off += i + 1
+	}
+	if off+col > len(src) {
+		return -1
+	}
+	return off + col
+}
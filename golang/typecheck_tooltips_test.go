@@ -0,0 +1,96 @@
+package golang
+
+import (
+	"margo.sh/mg"
+	"strings"
+	"testing"
+)
+
+func TestTypChkDecl(t *testing.T) {
+	src := `package a
+
+import (
+	str "strings"
+)
+
+// T is a thing.
+type T struct {
+	// N counts things.
+	N int
+}
+
+// M does nothing.
+func (t *T) M() int { return t.N }
+
+const (
+	// A is the first.
+	A = 1
+	B = 2 // B is the second.
+)
+
+func f() {
+	var t T
+	_ = t.M()
+	_ = str.ToUpper("")
+	_ = A + B
+	t.N++
+}
+`
+	mx, dir, cleanup := testModule(t, map[string]string{"a/a.go": src})
+	defer cleanup()
+	// the cursor is at the start of the file, so every lookup is at a different position
+	mx = testView(t, mx, dir, "a/a.go", "")
+
+	tests := []struct {
+		at   string
+		want tcDecl
+		info string
+	}{
+		{
+			at:   "_ = t.|M()",
+			want: tcDecl{Sig: "func (t *T) M() int", PkgPath: "example.com/m/a", Recv: "*T", Doc: "M does nothing.\n"},
+			info: "package example.com/m/a, method of *T",
+		},
+		{
+			at:   "t.|N++",
+			want: tcDecl{Sig: "field N int", PkgPath: "example.com/m/a", Recv: "T", Field: true, Doc: "N counts things.\n"},
+			info: "package example.com/m/a, field of T",
+		},
+		{
+			at:   "_ = |A + B",
+			want: tcDecl{Sig: "const A untyped int", PkgPath: "example.com/m/a", Doc: "A is the first.\n"},
+			info: "package example.com/m/a",
+		},
+		{
+			at:   "_ = A + |B",
+			want: tcDecl{Sig: "const B untyped int", PkgPath: "example.com/m/a", Doc: "B is the second.\n"},
+			info: "package example.com/m/a",
+		},
+		{
+			at:   "_ = |str.ToUpper",
+			want: tcDecl{Sig: `import "strings"`},
+		},
+	}
+	for _, tt := range tests {
+		off := strings.Index(src, strings.Replace(tt.at, "|", "", 1)) + strings.Index(tt.at, "|")
+		ti, err := typChkR.infoAt(mx, off)
+		if err != nil {
+			t.Errorf("infoAt(%q) failed: %s", tt.at, err)
+			continue
+		}
+		d := typChkR.decl(mx, ti)
+		if d != tt.want {
+			t.Errorf("decl(%q) = %+v, want %+v", tt.at, d, tt.want)
+		}
+		if s := d.info(); s != tt.info {
+			t.Errorf("decl(%q).info() = %q, want %q", tt.at, s, tt.info)
+		}
+	}
+
+	// tooltips are looked up at the hover position, not the cursor
+	row := strings.Count(src[:strings.Index(src, "t.N++")], "\n")
+	tips := typChkR.tooltips(mx, mg.QueryTooltips{Row: row, Col: len("\tt.")})
+	if len(tips) != 1 || !strings.Contains(tips[0].Content, "field N int") {
+		t.Errorf("tooltips() = %+v, want the tooltip for field N", tips)
+	}
+}
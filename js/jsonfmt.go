@@ -12,11 +12,11 @@ type JsonFmt struct {
 	Indent string
 }
 
-func (j JsonFmt) ReCond(mx *mg.Ctx) bool {
+func (j *JsonFmt) RCond(mx *mg.Ctx) bool {
 	return mx.ActionIs(mg.ViewFmt{}) && mx.LangIs(mg.JSON)
 }
 
-func (j JsonFmt) Reduce(mx *mg.Ctx) *mg.State {
+func (j *JsonFmt) Reduce(mx *mg.Ctx) *mg.State {
 	fn := mx.View.Filename()
 	r, err := mx.View.Open()
 	if err != nil {
@@ -0,0 +1,131 @@
+package kimporter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"go/token"
+	"go/types"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/tools/go/gcexportdata"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	// diskCacheVersion is changed whenever the format of the cache files changes
+	diskCacheVersion = "kimporter.diskcache.v1"
+)
+
+// DiskCacheDir returns the directory in which export data for type-checked dependencies is cached.
+//
+// The cache lives in $MARGO_DATA_DIR/kimporter.cache and is disabled if $MARGO_DATA_DIR is not set.
+// Each package has a single cache file that is replaced whenever the content of the package,
+// the content of any of its dependencies or the build context changes.
+func DiskCacheDir() string {
+	dir := os.Getenv("MARGO_DATA_DIR")
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "kimporter.cache")
+}
+
+// makeDiskKey returns a key identifying the package ks whose files hash to srcKey
+// and whose dependencies are imports
+func makeDiskKey(ks *state, srcKey string, imports map[string]*Package) string {
+	b2, _ := blake2b.New256(nil)
+	fmt.Fprintf(b2, "%s\n%#v\n%s\n", diskCacheVersion, ks.stateKey, srcKey)
+	paths := make([]string, 0, len(imports))
+	for path, _ := range imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		fmt.Fprintf(b2, "%s=%s\n", path, imports[path].diskKey)
+	}
+	return hex.EncodeToString(b2.Sum(nil))
+}
+
+// diskCacheFn returns the name of the cache file for the package ks
+func diskCacheFn(ks *state) string {
+	k := ks.stateKey
+	k.CheckImports = false
+	b2, _ := blake2b.New256(nil)
+	fmt.Fprintf(b2, "%#v", k)
+	return filepath.Join(DiskCacheDir(), hex.EncodeToString(b2.Sum(nil))+".a")
+}
+
+func (kp *Importer) loadDiskCache(ks *state, diskKey string, fset *token.FileSet, imports map[string]*Package) (pkg *types.Package) {
+	defer kp.mx.Profile.Push(`Kim-Porter: loadDiskCache(` + ks.ImportPath + `)`).Pop()
+
+	src, err := ioutil.ReadFile(diskCacheFn(ks))
+	if err != nil {
+		return nil
+	}
+	hdr := []byte(diskKey + "\n")
+	if !bytes.HasPrefix(src, hdr) {
+		return nil
+	}
+
+	m := map[string]*types.Package{}
+	var addImports func(map[string]*Package)
+	addImports = func(imports map[string]*Package) {
+		for _, p := range imports {
+			if _, seen := m[p.Path()]; seen {
+				continue
+			}
+			m[p.Path()] = p.Package
+			addImports(p.Imports)
+		}
+	}
+	addImports(imports)
+
+	defer func() {
+		if e := recover(); e != nil {
+			kp.mx.Log.Printf("Kim-Porter: cannot read export data for %s: %v\n", ks.ImportPath, e)
+			pkg = nil
+		}
+	}()
+	pkg, err = gcexportdata.Read(bytes.NewReader(src[len(hdr):]), fset, m, ks.ImportPath)
+	if err != nil {
+		kp.mx.Log.Printf("Kim-Porter: cannot read export data for %s: %s\n", ks.ImportPath, err)
+		return nil
+	}
+	return pkg
+}
+
+func (kp *Importer) storeDiskCache(ks *state, diskKey string, fset *token.FileSet, pkg *types.Package) {
+	defer kp.mx.Profile.Push(`Kim-Porter: storeDiskCache(` + ks.ImportPath + `)`).Pop()
+
+	// the export data writer predates some language features so
+	// some packages can't be exported. they'll simply be type-checked each time
+	defer func() { recover() }()
+
+	fn := diskCacheFn(ks)
+	dir := filepath.Dir(fn)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+	f, err := ioutil.TempFile(dir, filepath.Base(fn)+".tmp~")
+	if err != nil {
+		return
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	w.WriteString(diskKey + "\n")
+	if err := gcexportdata.Write(w, fset, pkg); err != nil {
+		return
+	}
+	if err := w.Flush(); err != nil {
+		return
+	}
+	if err := f.Close(); err != nil {
+		return
+	}
+	os.Rename(f.Name(), fn)
+}
@@ -0,0 +1,126 @@
+package kimporter
+
+import (
+	"go/build"
+	"go/token"
+	"io/ioutil"
+	"margo.sh/golang/gopkg"
+	"margo.sh/mg"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSrcKeyFields(t *testing.T) {
+	a := srcKeyOf([]*kpFile{{Nm: "a.go", Src: []byte("bc")}})
+	b := srcKeyOf([]*kpFile{{Nm: "a.gob", Src: []byte("c")}})
+	if a == b {
+		t.Errorf("the files (a.go, bc) and (a.gob, c) have the same key %s", a)
+	}
+	c := srcKeyOf([]*kpFile{{Nm: "a.go", Src: []byte("x")}, {Nm: "b.go", Src: []byte("y")}})
+	d := srcKeyOf([]*kpFile{{Nm: "a.go", Src: []byte("xb.go")}, {Nm: "y", Src: nil}})
+	if c == d {
+		t.Errorf("shifting the boundary between two files doesn't change the key %s", c)
+	}
+}
+
+func TestDiskKeyInvalidation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kimporter-diskcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(nm, src string) {
+		t.Helper()
+		if err := ioutil.WriteFile(filepath.Join(dir, nm), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.go", "package a\n\nconst A = 1\n")
+	write("tag.go", "// +build foo\n\npackage a\n\nconst Tag = 1\n")
+	write("a_windows.go", "package a\n\nconst OS = 1\n")
+
+	mx := mg.NewTestingCtx(nil)
+	pp := &gopkg.PkgPath{Dir: dir, ImportPath: "a"}
+	depKey := "dep.v1"
+	diskKey := func(goos string, tags ...string) string {
+		t.Helper()
+		bcx := build.Default
+		bcx.GOOS = goos
+		bcx.BuildTags = tags
+		// the file contents may be cached by the VFS so they're passed explicitly
+		src := map[string][]byte{}
+		for _, nm := range []string{"a.go", "tag.go", "a_windows.go"} {
+			s, _ := ioutil.ReadFile(filepath.Join(dir, nm))
+			src[filepath.Join(dir, nm)] = s
+		}
+		ks := &state{stateKey: stateKey{ImportPath: "a", Dir: dir, GOOS: goos, GOARCH: bcx.GOARCH}}
+		_, _, srcKey, err := readDir(mx, &bcx, token.NewFileSet(), pp, src, ks, nil)
+		if err != nil {
+			t.Fatalf("readDir failed: %s", err)
+		}
+		imports := map[string]*Package{"dep": {diskKey: depKey}}
+		return makeDiskKey(ks, srcKey, imports)
+	}
+
+	base := diskKey("linux")
+	if k := diskKey("linux"); k != base {
+		t.Fatalf("the key isn't stable: %s != %s", k, base)
+	}
+	if k := diskKey("linux", "foo"); k == base {
+		t.Errorf("enabling a build tag that adds a file doesn't change the key")
+	}
+	if k := diskKey("windows"); k == base {
+		t.Errorf("changing GOOS doesn't change the key")
+	}
+
+	depKey = "dep.v2"
+	if k := diskKey("linux"); k == base {
+		t.Errorf("changing a dependency doesn't change the key")
+	}
+	depKey = "dep.v1"
+
+	write("a.go", "package a\n\nconst A = 2\n")
+	if k := diskKey("linux"); k == base {
+		t.Errorf("changing the package src doesn't change the key")
+	}
+}
+
+func TestDiskCacheHitSkipsParse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kimporter-diskcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv("MARGO_DATA_DIR", os.Getenv("MARGO_DATA_DIR"))
+	os.Setenv("MARGO_DATA_DIR", filepath.Join(dir, "data"))
+	pkgDir := filepath.Join(dir, "a")
+	if err := os.Mkdir(pkgDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(pkgDir, "a.go"), []byte("package a\n\nconst A = 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mx := mg.NewTestingCtx(nil)
+	kp := New(mx, nil)
+	pp := &gopkg.PkgPath{Dir: pkgDir, ImportPath: "a"}
+	ks := &state{stateKey: stateKey{ImportPath: "a", Dir: pkgDir, DiskCache: true}}
+	pkg, err := kp.check(ks, pp, nil)
+	if err != nil {
+		t.Fatalf("check failed: %s", err)
+	}
+	if pkg.Files["a.go"] == nil {
+		t.Fatalf("a.go wasn't parsed when the package was type-checked")
+	}
+	pkg, err = kp.check(ks, pp, nil)
+	if err != nil {
+		t.Fatalf("check failed when loading from the disk cache: %s", err)
+	}
+	if pkg.Scope().Lookup("A") == nil {
+		t.Errorf("the package loaded from the disk cache doesn't declare A")
+	}
+	if len(pkg.Files) != 0 {
+		t.Errorf("the files were parsed even though the package was loaded from the disk cache")
+	}
+}
@@ -125,6 +125,9 @@ type Package struct {
 
 	// Files maps the package file tbasenames to their parsed ast files
 	Files map[string]*ast.File
+
+	// diskKey identifies the content of the package and its dependencies
+	diskKey string
 }
 
 // NewPackage is equivalent to &Package{Package: pkg, Fset: fset, Types: info, Imports: imports}
@@ -156,6 +159,7 @@ type stateKey struct {
 	GOPATH       string
 	NoHash       bool
 	TypesInfo    TypesInfo
+	DiskCache    bool
 }
 
 func globalState(mx *mg.Ctx, k stateKey) *state {
@@ -242,6 +246,10 @@ type Config struct {
 
 	// ImportsTypesInfo speifies whether or not to also load type info for imported packages
 	ImportsTypesInfo bool
+
+	// NoDiskCache disables the on-disk cache of dependencies' export data.
+	// See DiskCacheDir.
+	NoDiskCache bool
 }
 
 type Importer struct {
@@ -311,6 +319,9 @@ func (kp *Importer) stateKey(pp *gopkg.PkgPath) stateKey {
 		GOPATH:       strings.Join(mgutil.PathList(kp.bld.GOPATH), string(filepath.ListSeparator)),
 		NoHash:       kp.hash == "",
 		TypesInfo:    cfg.TypesInfo,
+		// only dependencies are cached because the export data only contains exported objects
+		DiskCache: kp.ks != nil && !cfg.NoDiskCache && cfg.TypesInfo == 0 &&
+			len(cfg.PackageSrc) == 0 && DiskCacheDir() != "",
 	}
 }
 
@@ -366,24 +377,43 @@ func (kp *Importer) importPkg(pp *gopkg.PkgPath) (pkg *Package, err error) {
 
 func (kp *Importer) check(ks *state, pp *gopkg.PkgPath, pkgSrc map[string][]byte) (*Package, error) {
 	fset := token.NewFileSet()
-	bp, filesMap, filesList, err := parseDir(kp.mx, kp.bld, fset, pp, kp.cfg.SrcMap, ks, pkgSrc)
+	bp, kpFiles, srcKey, err := readDir(kp.mx, kp.bld, fset, pp, kp.cfg.SrcMap, ks, pkgSrc)
 	if err != nil {
 		return nil, err
 	}
 
-	imports, err := kp.importDeps(ks, bp, fset, filesList)
+	imports, err := kp.importDeps(ks, bp, kpFiles)
 	if err != nil {
 		return nil, err
 	}
 
+	diskKey := makeDiskKey(ks, srcKey, imports)
+	// filesMap is only populated if the package is type-checked:
+	// the files aren't parsed when the package is loaded from the disk cache
+	var filesMap map[string]*ast.File
+	newPackage := func(pkg *types.Package, inf *types.Info) *Package {
+		p := NewPackage(pkg, fset, filesMap, inf, imports)
+		p.diskKey = diskKey
+		return p
+	}
+
 	if len(bp.CgoFiles) != 0 {
 		// TODO: fill in the type info. maybe we can just merge this into the pure-go check.
 		pkg, err := kp.importCgoPkg(pp, imports)
 		if err == nil {
-			return NewPackage(pkg, fset, filesMap, nil, imports), err
+			return newPackage(pkg, nil), err
+		}
+	} else if ks.DiskCache {
+		if pkg := kp.loadDiskCache(ks, diskKey, fset, imports); pkg != nil {
+			return newPackage(pkg, nil), nil
 		}
 	}
 
+	filesMap, filesList, err := parseFiles(kp.mx, pp, kpFiles)
+	if err != nil {
+		return nil, err
+	}
+
 	defer kp.mx.Profile.Push(`Kim-Porter: typecheck(` + ks.ImportPath + `)`).Pop()
 	var hardErr error
 	tc := types.Config{
@@ -406,13 +436,16 @@ func (kp *Importer) check(ks *state, pp *gopkg.PkgPath, pkgSrc map[string][]byte
 	if err == nil && hardErr != nil {
 		err = hardErr
 	}
+	if err == nil && ks.DiskCache && len(bp.CgoFiles) == 0 {
+		kp.storeDiskCache(ks, diskKey, fset, pkg)
+	}
 	switch {
 	case pkg == nil:
 		return nil, err
 	case ks.TypesInfo != 0:
-		return NewPackage(pkg, fset, filesMap, inf, imports), err
+		return newPackage(pkg, inf), err
 	default:
-		return NewPackage(pkg, fset, filesMap, nil, imports), err
+		return newPackage(pkg, nil), err
 	}
 }
 
@@ -463,7 +496,7 @@ func (kp *Importer) importFakePkg(ipath string) *Package {
 	return nil
 }
 
-func (kp *Importer) importDeps(ks *state, bp *build.Package, fset *token.FileSet, astFiles []*ast.File) (map[string]*Package, error) {
+func (kp *Importer) importDeps(ks *state, bp *build.Package, kpFiles []*kpFile) (map[string]*Package, error) {
 	defer kp.mx.Profile.Push(`Kim-Porter: importDeps(` + ks.ImportPath + `)`).Pop()
 
 	paths := mgutil.StrSet(bp.Imports)
@@ -480,22 +513,21 @@ func (kp *Importer) importDeps(ks *state, bp *build.Package, fset *token.FileSet
 			mu.Unlock()
 			return nil
 		}
-		for _, af := range astFiles {
-			for _, spec := range af.Imports {
-				if spec.Path == nil {
-					continue
-				}
-				s, _ := strconv.Unquote(spec.Path.Value)
-				if ipath != s {
-					continue
-				}
-				tp := fset.Position(spec.Pos())
-				return mg.Issue{
-					Path:    tp.Filename,
-					Row:     tp.Line - 1,
-					Col:     tp.Column - 1,
-					Message: err.Error(),
-				}
+		fset, specs := importSpecs(kpFiles)
+		for _, spec := range specs {
+			if spec.Path == nil {
+				continue
+			}
+			s, _ := strconv.Unquote(spec.Path.Value)
+			if ipath != s {
+				continue
+			}
+			tp := fset.Position(spec.Pos())
+			return mg.Issue{
+				Path:    tp.Filename,
+				Row:     tp.Line - 1,
+				Col:     tp.Column - 1,
+				Message: err.Error(),
 			}
 		}
 		return err
@@ -1,10 +1,13 @@
 package kimporter
 
 import (
+	"encoding/binary"
+	"encoding/hex"
 	"go/ast"
 	"go/build"
 	"go/parser"
 	"go/token"
+	"golang.org/x/crypto/blake2b"
 	"margo.sh/golang/gopkg"
 	"margo.sh/mg"
 	"margo.sh/vfs"
@@ -25,13 +28,14 @@ type kpFile struct {
 	*ast.File
 }
 
-func (kf *kpFile) init() {
+// read reads the file's src, unless it was already supplied
+func (kf *kpFile) read() {
 	if len(kf.Src) == 0 {
 		kf.Src, kf.Err = kf.Mx.VFS.ReadBlob(kf.Fn).ReadFile()
-		if kf.Err != nil {
-			return
-		}
 	}
+}
+
+func (kf *kpFile) parse() {
 	kf.File, kf.Err = parser.ParseFile(kf.Fset, kf.Fn, kf.Src, 0)
 	if kf.File == nil {
 		return
@@ -94,19 +98,22 @@ func bldImportDir(bcx *build.Context, pp *gopkg.PkgPath, pkgSrc map[string][]byt
 	return bp, nil
 }
 
-func parseDir(mx *mg.Ctx, bcx *build.Context, fset *token.FileSet, pp *gopkg.PkgPath, srcMap map[string][]byte, ks *state, pkgSrc map[string][]byte) (*build.Package, map[string]*ast.File, []*ast.File, error) {
-	defer mx.Profile.Push(`Kim-Porter: parseDir(` + pp.Dir + `)`).Pop()
+// readDir reads the files in the package pp.
+// In addition to the files, it returns srcKey, a hash of the names and content of all files.
+// The files are not parsed, see parseFiles.
+func readDir(mx *mg.Ctx, bcx *build.Context, fset *token.FileSet, pp *gopkg.PkgPath, srcMap map[string][]byte, ks *state, pkgSrc map[string][]byte) (bp *build.Package, kpFiles []*kpFile, srcKey string, err error) {
+	defer mx.Profile.Push(`Kim-Porter: readDir(` + pp.Dir + `)`).Pop()
 
-	bp, err := bldImportDir(bcx, pp, pkgSrc)
+	bp, err = bldImportDir(bcx, pp, pkgSrc)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, "", err
 	}
 	if !ks.Tests {
 		bp.TestGoFiles = nil
 	}
-	kpFiles := make([]*kpFile, 0, len(bp.GoFiles)+len(bp.CgoFiles)+len(bp.TestGoFiles))
+	kpFiles = make([]*kpFile, 0, len(bp.GoFiles)+len(bp.CgoFiles)+len(bp.TestGoFiles))
 	if cap(kpFiles) == 0 {
-		return nil, nil, nil, &build.NoGoError{Dir: pp.Dir}
+		return nil, nil, "", &build.NoGoError{Dir: pp.Dir}
 	}
 	wg := sync.WaitGroup{}
 	for _, l := range [][]string{bp.GoFiles, bp.CgoFiles, bp.TestGoFiles} {
@@ -132,14 +139,38 @@ func parseDir(mx *mg.Ctx, bcx *build.Context, fset *token.FileSet, pp *gopkg.Pkg
 			go func() {
 				defer wg.Done()
 
-				kf.init()
+				kf.read()
 			}()
 		}
 	}
 	wg.Wait()
 
-	filesList := make([]*ast.File, 0, len(kpFiles))
-	filesMap := make(map[string]*ast.File, len(kpFiles))
+	for _, kf := range kpFiles {
+		if kf.Err != nil {
+			return nil, nil, "", kf.Err
+		}
+	}
+	return bp, kpFiles, srcKeyOf(kpFiles), err
+}
+
+// parseFiles parses kpFiles concurrently
+func parseFiles(mx *mg.Ctx, pp *gopkg.PkgPath, kpFiles []*kpFile) (filesMap map[string]*ast.File, filesList []*ast.File, err error) {
+	defer mx.Profile.Push(`Kim-Porter: parseFiles(` + pp.Dir + `)`).Pop()
+
+	wg := sync.WaitGroup{}
+	for _, kf := range kpFiles {
+		kf := kf
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			kf.parse()
+		}()
+	}
+	wg.Wait()
+
+	filesList = make([]*ast.File, 0, len(kpFiles))
+	filesMap = make(map[string]*ast.File, len(kpFiles))
 	for _, kf := range kpFiles {
 		if kf.File != nil {
 			filesList = append(filesList, kf.File)
@@ -149,5 +180,36 @@ func parseDir(mx *mg.Ctx, bcx *build.Context, fset *token.FileSet, pp *gopkg.Pkg
 			err = kf.Err
 		}
 	}
-	return bp, filesMap, filesList, err
+	return filesMap, filesList, err
+}
+
+// importSpecs parses the import declarations of kpFiles.
+// It's used to find the position of an import that failed without parsing the whole package.
+func importSpecs(kpFiles []*kpFile) (*token.FileSet, []*ast.ImportSpec) {
+	fset := token.NewFileSet()
+	l := []*ast.ImportSpec{}
+	for _, kf := range kpFiles {
+		af, _ := parser.ParseFile(fset, kf.Fn, kf.Src, parser.ImportsOnly)
+		if af != nil {
+			l = append(l, af.Imports...)
+		}
+	}
+	return fset, l
+}
+
+// srcKeyOf returns a hash of the names and content of files.
+// Each field is prefixed with its length, so the boundaries between names and content can't be shifted
+// e.g. the files ("a.go", "bc") and ("a.gob", "c") have different keys.
+func srcKeyOf(files []*kpFile) string {
+	b2, _ := blake2b.New256(nil)
+	buf := make([]byte, binary.MaxVarintLen64)
+	field := func(s []byte) {
+		b2.Write(buf[:binary.PutUvarint(buf, uint64(len(s)))])
+		b2.Write(s)
+	}
+	for _, kf := range files {
+		field([]byte(kf.Nm))
+		field(kf.Src)
+	}
+	return hex.EncodeToString(b2.Sum(nil))
 }
@@ -3,6 +3,7 @@ package memo
 import (
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 var (
@@ -24,7 +25,8 @@ func InvAt() int64 {
 type memo struct {
 	k K
 	sync.Mutex
-	v V
+	v    V
+	used int64
 }
 
 func (m *memo) value() V {
@@ -37,6 +39,19 @@ func (m *memo) value() V {
 	return m.v
 }
 
+func (m *memo) touch() {
+	atomic.StoreInt64(&m.used, time.Now().UnixNano())
+}
+
+// Entry is a memoized value, see M.Entries
+type Entry struct {
+	K K
+	V V
+
+	// Used is the time, in unix nanoseconds, at which the value was last read
+	Used int64
+}
+
 type M struct {
 	mu sync.Mutex
 	ml []*memo
@@ -72,6 +87,9 @@ func (m *M) Peek(k K) V {
 	_, p := m.index(k)
 	m.mu.Unlock()
 
+	if p != nil {
+		p.touch()
+	}
 	return p.value()
 }
 
@@ -81,6 +99,7 @@ func (m *M) Read(k K, new func() V) V {
 	}
 
 	p := m.memo(k)
+	p.touch()
 	p.Lock()
 	defer p.Unlock()
 
@@ -162,3 +181,58 @@ func (m *M) Range(f func(k K, v V)) {
 		}
 	}
 }
+
+// Len returns the number of values in m
+func (m *M) Len() int {
+	if m == nil {
+		return 0
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.ml)
+}
+
+// Entries returns the list of values in m
+func (m *M) Entries() []Entry {
+	if m == nil {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l := make([]Entry, 0, len(m.ml))
+	for _, p := range m.ml {
+		if v := p.value(); v != nil {
+			l = append(l, Entry{K: p.k, V: v, Used: atomic.LoadInt64(&p.used)})
+		}
+	}
+	return l
+}
+
+// Evict deletes the value of k if it was last read before the time usedBefore, in unix nanoseconds.
+// Sticky values are never evicted.
+//
+// It returns true if the value was deleted.
+func (m *M) Evict(k K, usedBefore int64) bool {
+	if m == nil {
+		return false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i, p := m.index(k)
+	if i < 0 || atomic.LoadInt64(&p.used) >= usedBefore {
+		return false
+	}
+	if _, ok := p.value().(Sticky); ok {
+		return false
+	}
+	m.ml[i] = m.ml[len(m.ml)-1]
+	m.ml[len(m.ml)-1] = nil
+	m.ml = m.ml[:len(m.ml)-1]
+	return true
+}
@@ -24,7 +24,11 @@ var (
 		Register("QueryUserCmds", QueryUserCmds{}).
 		Register("QueryTestCmds", QueryTestCmds{}).
 		Register("RunCmd", RunCmd{}).
-		Register("QueryTooltips", QueryTooltips{})
+		Register("QueryTooltips", QueryTooltips{}).
+		Register("QuerySignatureHelp", QuerySignatureHelp{}).
+		Register("QueryOutline", QueryOutline{}).
+		Register("QuerySemanticTokens", QuerySemanticTokens{}).
+		Register("ApplyIssueFix", ApplyIssueFix{})
 )
 
 // initAction is dispatched to indicate the start of IPC communication.
@@ -48,6 +52,10 @@ type Activate struct {
 	Name string
 	Row  int
 	Col  int
+
+	// Cookie is the cookie of the request that caused the activation e.g. a goto.definition command.
+	// It's not sent to the client.
+	Cookie string `codec:"-"`
 }
 
 func (a Activate) ClientAction() actions.ClientData {
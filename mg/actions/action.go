@@ -29,7 +29,7 @@ type ActionData struct {
 	Data codec.Raw
 
 	// Handle is the handle to use for decoding Data
-	Handle codec.Handle
+	Handle codec.Handle `codec:"-"`
 }
 
 // Decode decodes the encoded data into the action pointer p.
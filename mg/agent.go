@@ -62,6 +62,12 @@ type AgentConfig struct {
 	// Default: json
 	Codec string
 
+	// Protocol is the name of the IPC protocol
+	// Valid values are margo (the native protocol) or lsp (the Language Server Protocol)
+	// When set to lsp, Codec is ignored and JSON is used.
+	// Default: margo
+	Protocol string
+
 	// Stdin is the stream through which the client sends encoded request data
 	// It's closed when Agent.Run() returns
 	Stdin io.ReadCloser
@@ -74,6 +80,15 @@ type AgentConfig struct {
 	// Clients are encouraged to leave it open until the process exits
 	// to allow for logging to keep working during process shutdown
 	Stderr io.Writer
+
+	// Record is the name of a file in which to record the session for `margo.sh replay`
+	// i.e. every request received and every response sent
+	//
+	// The recording includes the src of the views, and the environment sent by the editor.
+	// The values of environment variables that might hold credentials are redacted (see recordEnv),
+	// but the recording should be reviewed before it's shared.
+	// It's ignored when Protocol is lsp, or when the agent is run as a daemon by Agent.Serve
+	Record string
 }
 
 type agentReq struct {
@@ -81,7 +96,7 @@ type agentReq struct {
 	Actions []actions.ActionData
 	Props   clientProps
 	Sent    string
-	Profile *mgpf.Profile
+	Profile *mgpf.Profile `codec:"-"`
 }
 
 func newAgentReq(kvs KVStore) *agentReq {
@@ -177,8 +192,13 @@ type Agent struct {
 	enc    *codec.Encoder
 	encWr  *bufio.Writer
 	dec    *codec.Decoder
+	lsp    *lspServer     `mg.Nillable:"true"`
+	rec    *agentRecorder `mg.Nillable:"true"`
 	wg     sync.WaitGroup
 
+	// daemon is the agent serving this agent's client, if it's a daemon client
+	daemon *Agent `mg.Nillable:"true"`
+
 	sd struct {
 		mu     sync.Mutex
 		done   chan<- struct{}
@@ -198,7 +218,13 @@ func (ag *Agent) communicate() error {
 	unsub := sto.Subscribe(ag.sub)
 	defer unsub()
 
-	sto.mount()
+	if ag.daemon == nil {
+		sto.mount()
+	}
+
+	if ag.lsp != nil {
+		return ag.lsp.serve()
+	}
 
 	for {
 		rq := newAgentReq(sto)
@@ -209,6 +235,7 @@ func (ag *Agent) communicate() error {
 			return fmt.Errorf("ipc.decode: %s", err)
 		}
 
+		ag.rec.recordReq(rq)
 		rq.finalize(ag)
 		ag.handleReq(rq)
 	}
@@ -233,6 +260,11 @@ func (ag *Agent) createAction(d actions.ActionData) (Action, error) {
 }
 
 func (ag *Agent) sub(mx *Ctx) {
+	if ag.lsp != nil {
+		ag.lsp.sub(mx)
+		return
+	}
+
 	err := ag.send(agentRes{
 		State:  mx.State,
 		Cookie: mx.Cookie,
@@ -248,7 +280,9 @@ func (ag *Agent) send(res agentRes) error {
 	defer ag.mu.Unlock()
 
 	defer ag.encWr.Flush()
-	return ag.enc.Encode(res.finalize())
+	out := res.finalize()
+	ag.rec.recordRes(out)
+	return ag.enc.Encode(out)
 }
 
 // shutdown sequence:
@@ -269,8 +303,12 @@ func (ag *Agent) shutdown() {
 
 	// defers because we want *some* guarantee that all these steps will be taken
 	defer close(sd.done)
+	defer ag.rec.close()
 	defer ag.stdout.Close()
-	defer ag.Store.unmount()
+	if ag.daemon == nil {
+		// the reducers are shared with the daemon's other clients
+		defer ag.Store.unmount()
+	}
 	defer ag.wg.Wait()
 	defer ag.stdin.Close()
 }
@@ -337,11 +375,35 @@ func NewAgent(cfg AgentConfig) (*Agent, error) {
 		err = fmt.Errorf("Invalid codec '%s'. Expected %s", cfg.Codec, CodecNamesStr)
 		ag.handle = codecHandles[DefaultCodec]
 	}
+	switch cfg.Protocol {
+	case "", "margo":
+		if cfg.Record != "" {
+			codecName := cfg.Codec
+			if codecName == "" || codecHandles[codecName] == nil {
+				codecName = DefaultCodec
+			}
+			rec, e := newAgentRecorder(ag.Log, cfg.Record, codecName, ag.handle)
+			if e != nil && err == nil {
+				err = fmt.Errorf("Cannot record session: %s", e)
+			}
+			ag.rec = rec
+		}
+	case LSPProtocol:
+		ag.handle = codecHandles["json"]
+		ag.lsp = newLSPServer(ag)
+	default:
+		err = fmt.Errorf("Invalid protocol '%s'. Expected margo or %s", cfg.Protocol, LSPProtocol)
+	}
+	ag.initIPC()
+
+	return ag, err
+}
+
+// initIPC initialises the encoder and decoder used to communicate with the client
+func (ag *Agent) initIPC() {
 	ag.encWr = bufio.NewWriter(ag.stdout)
 	ag.enc = codec.NewEncoder(ag.encWr, ag.handle)
 	ag.dec = codec.NewDecoder(bufio.NewReader(ag.stdin), ag.handle)
-
-	return ag, err
 }
 
 // Args returns a new copy of agent's Args.
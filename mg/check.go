@@ -0,0 +1,128 @@
+package mg
+
+import (
+	"io"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// CheckConfig is the configuration for Check
+type CheckConfig struct {
+	// Files is the list of files to check
+	Files []string
+
+	// Margo, if set, is called to add reducers to the agent, in addition to DefaultReducers
+	// e.g. the user's margo extension
+	Margo MargoFunc
+
+	// Env is the environment of the views
+	// Default: the process' environment
+	Env EnvMap
+
+	// Stderr is used by the agent for logging
+	// Default: the logs are discarded
+	Stderr io.Writer
+
+	// Settle is how long the agent must be idle i.e. with no running tasks or reductions,
+	// before the issues of a file are collected
+	// Default: 500ms
+	Settle time.Duration
+
+	// Timeout is the maximum time to wait for the agent to settle after a file is opened
+	// Default: 1 minute
+	Timeout time.Duration
+}
+
+// Check runs the agent's reducers on files without an editor, and returns the issues they report.
+//
+// Each file is opened in turn, as if the user opened and saved it, by dispatching
+// ViewActivated, ViewLoaded and ViewSaved.
+// Its issues are collected with QueryIssues once the work started in the background
+// e.g. type-checking or linting, has settled.
+func Check(cfg CheckConfig) (IssueSet, error) {
+	if cfg.Settle <= 0 {
+		cfg.Settle = 500 * time.Millisecond
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = time.Minute
+	}
+
+	ha, err := newHeadlessAgent(cfg.Margo, cfg.Env, cfg.Stderr, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer ha.close()
+
+	ck := &checker{ha: ha, cfg: cfg}
+	var issues IssueSet
+	for _, fn := range cfg.Files {
+		l, err := ck.check(fn)
+		if err != nil {
+			return issues, err
+		}
+		issues = issues.Add(l...)
+	}
+	sort.SliceStable(issues, func(i, j int) bool {
+		p, q := issues[i], issues[j]
+		if p.Path != q.Path {
+			return p.Path < q.Path
+		}
+		if p.Row != q.Row {
+			return p.Row < q.Row
+		}
+		return p.Col < q.Col
+	})
+	return issues, nil
+}
+
+type checker struct {
+	ha  *headlessAgent
+	cfg CheckConfig
+}
+
+// check opens the file fn and returns its issues
+func (ck *checker) check(fn string) (IssueSet, error) {
+	fn, err := filepath.Abs(fn)
+	if err != nil {
+		return nil, err
+	}
+	view := func(v *View) {
+		v.Path = fn
+		v.Wd = filepath.Dir(fn)
+		v.Name = fn
+		v.Lang = fileLang(fn)
+	}
+
+	// issues can be reported directly in the reduction of an action
+	// or stored, in the background, and reported in all later reductions
+	var issues IssueSet
+	add := func(act string) error {
+		mx, err := ck.ha.request(view, act)
+		if err != nil {
+			return err
+		}
+		issues = issues.Add(mx.State.Issues...)
+		return nil
+	}
+	for _, act := range []string{"ViewActivated", "ViewLoaded", "ViewSaved"} {
+		if err := add(act); err != nil {
+			return nil, err
+		}
+	}
+	ck.ha.settle(ck.cfg.Settle)
+	if err := add("QueryIssues"); err != nil {
+		return nil, err
+	}
+
+	for i, isu := range issues {
+		if isu.Path == "" && (isu.Name == "" || isu.Name == fn) {
+			isu.Path = fn
+		}
+		if isu.Tag == "" {
+			isu.Tag = Error
+		}
+		issues[i] = isu
+	}
+	return issues, nil
+}
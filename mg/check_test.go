@@ -0,0 +1,75 @@
+package mg
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type checkTestIssueKey struct{}
+
+func TestCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "margo-check")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	a := filepath.Join(dir, "a.go")
+	b := filepath.Join(dir, "b.go")
+	for _, fn := range []string{a, b} {
+		if err := ioutil.WriteFile(fn, []byte("package a\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a reducer that reports an issue in the view when it's loaded,
+	// and another one, in the background, when it's saved
+	margo := func(ma Args) {
+		ma.Store.Use(NewReducer(func(mx *Ctx) *State {
+			switch mx.Action.(type) {
+			case ViewLoaded:
+				return mx.AddIssues(Issue{Name: mx.View.Name, Row: 1, Message: "loaded", Tag: Warning})
+			case ViewSaved:
+				v := mx.View
+				go func() {
+					defer mx.Begin(Task{Title: "check test"}).Done()
+					time.Sleep(100 * time.Millisecond)
+					mx.Store.Dispatch(StoreIssues{
+						IssueKey: IssueKey{Key: checkTestIssueKey{}, Path: v.Path},
+						Issues:   IssueSet{{Path: v.Path, Message: "saved"}},
+					})
+				}()
+			}
+			return mx.State
+		}))
+	}
+
+	issues, err := Check(CheckConfig{
+		Files:  []string{b, a},
+		Margo:  margo,
+		Settle: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Check failed: %s", err)
+	}
+	want := []struct {
+		path, msg string
+		tag       IssueTag
+	}{
+		{a, "saved", Error},
+		{a, "loaded", Warning},
+		{b, "saved", Error},
+		{b, "loaded", Warning},
+	}
+	if len(issues) != len(want) {
+		t.Fatalf("Check() returned %d issues, want %d: %v", len(issues), len(want), issues)
+	}
+	for i, w := range want {
+		isu := issues[i]
+		if isu.Path != w.path || isu.Message != w.msg || isu.Tag != w.tag {
+			t.Errorf("issue %d is %s %s %s, want %s %s %s", i, isu.Path, isu.Message, isu.Tag, w.path, w.msg, w.tag)
+		}
+	}
+}
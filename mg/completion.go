@@ -17,4 +17,15 @@ type Completion struct {
 	Title string
 	Src   string
 	Tag   CompletionTag
+
+	// Replace is the number of bytes before the cursor that Src replaces.
+	// It's used by completions that rewrite the text before the current word
+	// e.g. postfix completions, where `err.return` becomes `return err`.
+	// It's only honoured by editors for which EditorProps.ReplaceCompletions returns true.
+	Replace int
+
+	// Edits are additional changes to the view's src that are applied along with the completion
+	// e.g. to add the imports that Src depends on.
+	// Like Replace, it's only honoured by editors for which EditorProps.ReplaceCompletions returns true.
+	Edits []TextEdit
 }
@@ -0,0 +1,223 @@
+package mg
+
+import (
+	"fmt"
+	"io/ioutil"
+	"margo.sh/mgutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Serve runs the agent as a daemon: it accepts client connections from each listener in ls
+// and serves each of them as if it was the agent's stdin and stdout.
+//
+// Each client has its own state e.g. its view, editor and env,
+// and the responses for its requests, and for the actions dispatched during its reductions,
+// are only sent to it.
+// The clients share the agent's reducers (and so their caches), VFS and the packages cached by kimporter.
+// View names are only unique per-client, so reducers should key per-view state by Ctx.ViewKey.
+//
+// Serve returns when one of the listeners fails e.g. because it was closed,
+// after closing the others and disconnecting all clients.
+func (ag *Agent) Serve(ls ...net.Listener) error {
+	if len(ls) == 0 {
+		return fmt.Errorf("agent.serve: no listeners")
+	}
+
+	defer ag.shutdown()
+	ag.Store.mount()
+
+	dm := &agentDaemon{ag: ag, clients: map[*Agent]struct{}{}}
+	errs := make(chan error, len(ls))
+	for _, ln := range ls {
+		go func(ln net.Listener) { errs <- dm.accept(ln) }(ln)
+	}
+	err := <-errs
+	for _, ln := range ls {
+		ln.Close()
+	}
+	for i := 1; i < len(ls); i++ {
+		<-errs
+	}
+	dm.close()
+	return err
+}
+
+// newClient returns a new agent that serves the daemon client conn
+func (ag *Agent) newClient(conn net.Conn) *Agent {
+	done := make(chan struct{})
+	cag := &Agent{
+		Name: ag.Name,
+		Done: done,
+		Log:  ag.Log,
+		// stdin isn't locked, so the client can be disconnected while it's waiting for a request
+		stdin: &mgutil.IOWrapper{
+			Reader: conn,
+			Closer: conn,
+		},
+		stdout: &mgutil.IOWrapper{
+			Locker: &sync.Mutex{},
+			Writer: conn,
+			Closer: conn,
+		},
+		stderr: ag.stderr,
+		handle: ag.handle,
+		daemon: ag,
+	}
+	cag.sd.done = done
+	cag.Store = ag.Store.newClientStore(cag)
+	if ag.lsp != nil {
+		cag.lsp = newLSPServer(cag)
+	}
+	cag.initIPC()
+	return cag
+}
+
+type agentDaemon struct {
+	ag      *Agent
+	mu      sync.Mutex
+	clients map[*Agent]struct{}
+	wg      sync.WaitGroup
+	n       int
+}
+
+func (dm *agentDaemon) accept(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if ne, ok := err.(net.Error); ok && ne.Temporary() {
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("agent.serve: %s", err)
+		}
+		dm.serve(conn)
+	}
+}
+
+func (dm *agentDaemon) serve(conn net.Conn) {
+	cag := dm.ag.newClient(conn)
+	dm.mu.Lock()
+	dm.clients[cag] = struct{}{}
+	dm.n++
+	name := fmt.Sprintf("client #%d (%s)", dm.n, conn.LocalAddr())
+	dm.mu.Unlock()
+
+	dm.wg.Add(1)
+	go func() {
+		defer dm.wg.Done()
+		defer func() {
+			dm.mu.Lock()
+			delete(dm.clients, cag)
+			dm.mu.Unlock()
+		}()
+
+		dm.ag.Log.Println(name, "connected")
+		if err := cag.Run(); err != nil {
+			dm.ag.Log.Println(name, "disconnected:", err)
+		} else {
+			dm.ag.Log.Println(name, "disconnected")
+		}
+	}()
+}
+
+// close disconnects all clients and waits for their pending requests to complete
+func (dm *agentDaemon) close() {
+	dm.mu.Lock()
+	clients := make([]*Agent, 0, len(dm.clients))
+	for cag := range dm.clients {
+		clients = append(clients, cag)
+	}
+	dm.mu.Unlock()
+
+	for _, cag := range clients {
+		cag.shutdown()
+	}
+	dm.wg.Wait()
+}
+
+// Listen returns a listener, for Agent.Serve, on the daemon address addr.
+//
+// addr is in the form `unix:path` for a Unix domain socket.
+// Clients are not authenticated, and can run commands as the daemon's user,
+// so the socket is only accessible by the current user i.e. it has the permissions 0600.
+// A stale socket file e.g. left behind by a daemon that crashed, is removed.
+func Listen(addr string) (net.Listener, error) {
+	network, address, err := splitDaemonAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	if fi, err := os.Lstat(address); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists, and it's not a socket", addr)
+		}
+		if conn, err := net.Dial(network, address); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is already in use", addr)
+		}
+		os.Remove(address)
+	}
+	return listenUnix(address)
+}
+
+// listenUnix listens on the Unix domain socket fn, with the permissions 0600.
+// The socket is created in a private directory, and moved to fn after its permissions are set,
+// so other users can never connect to it.
+func listenUnix(fn string) (net.Listener, error) {
+	dir, err := ioutil.TempDir(filepath.Dir(fn), ".margo")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	tmp := filepath.Join(dir, "s")
+	ln, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	ul := ln.(*net.UnixListener)
+	ul.SetUnlinkOnClose(false)
+	if err = os.Chmod(tmp, 0600); err == nil {
+		err = os.Rename(tmp, fn)
+	}
+	if err != nil {
+		ul.Close()
+		return nil, err
+	}
+	return &daemonListener{UnixListener: ul, fn: fn}, nil
+}
+
+// daemonListener removes its socket file when it's closed
+type daemonListener struct {
+	*net.UnixListener
+	fn   string
+	once sync.Once
+}
+
+func (dl *daemonListener) Close() error {
+	err := dl.UnixListener.Close()
+	dl.once.Do(func() { os.Remove(dl.fn) })
+	return err
+}
+
+// Dial connects to the daemon listening on the address addr.
+// See Listen for the format of addr.
+func Dial(addr string) (net.Conn, error) {
+	network, address, err := splitDaemonAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	return net.Dial(network, address)
+}
+
+func splitDaemonAddr(addr string) (network, address string, err error) {
+	l := strings.SplitN(addr, ":", 2)
+	if len(l) != 2 || l[0] != "unix" || l[1] == "" {
+		return "", "", fmt.Errorf("Invalid daemon address '%s'. Expected unix:path", addr)
+	}
+	return l[0], l[1], nil
+}
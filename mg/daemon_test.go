@@ -0,0 +1,232 @@
+package mg
+
+import (
+	"fmt"
+	"github.com/ugorji/go/codec"
+	"io/ioutil"
+	"margo.sh/mgutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type daemonTestAct struct{ ActionType }
+
+// daemonTestClient is a client connected to the agent started by startTestDaemon
+type daemonTestClient struct {
+	t    *testing.T
+	dir  string
+	conn net.Conn
+	dec  *codec.Decoder
+}
+
+// send sends a request with the action QueryUserCmds, in the view named view, if it's not empty
+func (c *daemonTestClient) send(cookie, view string) {
+	c.t.Helper()
+	props := ""
+	if view != "" {
+		props = fmt.Sprintf(`, "Props": {"View": {"Name": %q, "Path": %q}}`, view, filepath.Join(c.dir, view))
+	}
+	fmt.Fprintf(c.conn, `{"Cookie": %q, "Actions": [{"Name": "QueryUserCmds"}]%s}`+"\n", cookie, props)
+}
+
+// recv returns the cookie, status and issue messages of the next response
+func (c *daemonTestClient) recv() (cookie, status, issues string) {
+	c.t.Helper()
+	var res struct {
+		Cookie string
+		State  struct {
+			Status []string
+			Issues []struct{ Message string }
+		}
+	}
+	if err := c.dec.Decode(&res); err != nil {
+		c.t.Fatal(err)
+	}
+	msgs := make([]string, len(res.State.Issues))
+	for i, isu := range res.State.Issues {
+		msgs[i] = isu.Message
+	}
+	return res.Cookie, strings.Join(res.State.Status, "|"), strings.Join(msgs, "|")
+}
+
+// startTestDaemon starts serving an agent, with the reducer r, in a temporary directory.
+// The returned function stops the agent, and returns the error returned by Agent.Serve.
+func startTestDaemon(t *testing.T, r Reducer) (dial func() *daemonTestClient, stop func() error) {
+	dir, err := ioutil.TempDir("", "margo-daemon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := "unix:" + filepath.Join(dir, "margo.sock")
+
+	ag, _ := NewAgent(AgentConfig{
+		Stdin:  &mgutil.IOWrapper{},
+		Stdout: &mgutil.IOWrapper{},
+		Stderr: &mgutil.IOWrapper{},
+	})
+	ag.Store.Use(r)
+
+	ln, err := Listen(addr)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- ag.Serve(ln) }()
+
+	var clients []*daemonTestClient
+	dial = func() *daemonTestClient {
+		t.Helper()
+		conn, err := Dial(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := &daemonTestClient{t: t, dir: dir, conn: conn, dec: codec.NewDecoder(conn, codecHandles["json"])}
+		clients = append(clients, c)
+		return c
+	}
+	stop = func() error {
+		defer os.RemoveAll(dir)
+		for _, c := range clients {
+			c.conn.Close()
+		}
+		ln.Close()
+		return <-served
+	}
+	return dial, stop
+}
+
+func TestDaemonClients(t *testing.T) {
+	dial, stop := startTestDaemon(t, NewReducer(func(mx *Ctx) *State {
+		st := mx.AddStatus("view: " + mx.View.Name)
+		switch mx.Action.(type) {
+		case QueryUserCmds:
+			go mx.Store.Dispatch(daemonTestAct{})
+		case daemonTestAct:
+			st = st.AddStatus("dispatched")
+		}
+		return st
+	}))
+
+	a := dial()
+	b := dial()
+
+	a.send("a1", "a.go")
+	if cookie, status, _ := a.recv(); cookie != "a1" || !strings.Contains(status, "view: a.go") {
+		t.Fatalf("client a: got response %q with status %q, want a1 with `view: a.go`", cookie, status)
+	}
+	if cookie, status, _ := a.recv(); cookie != "" || !strings.Contains(status, "dispatched") || !strings.Contains(status, "view: a.go") {
+		t.Fatalf("client a: got response %q with status %q, want the dispatched action in the client's view", cookie, status)
+	}
+
+	// b has its own view and doesn't see the action dispatched for a
+	b.send("b1", "")
+	if cookie, status, _ := b.recv(); cookie != "b1" || strings.Contains(status, "a.go") {
+		t.Fatalf("client b: got response %q with status %q, want b1 without a's view", cookie, status)
+	}
+	if cookie, _, _ := b.recv(); cookie != "" {
+		t.Fatalf("client b: got response %q, want its dispatched action", cookie)
+	}
+
+	if err := stop(); err == nil {
+		t.Fatal("Serve() = nil, want the error of the closed listener")
+	}
+}
+
+func TestDaemonViewNames(t *testing.T) {
+	// each client stores an issue for its view, keyed by the view's name
+	dial, stop := startTestDaemon(t, NewReducer(func(mx *Ctx) *State {
+		if mx.ActionIs(QueryUserCmds{}) {
+			go mx.Store.Dispatch(StoreIssues{
+				IssueKey: IssueKey{Name: mx.View.Name},
+				Issues:   IssueSet{{Name: mx.View.Name, Message: "issue of " + mx.Cookie}},
+			})
+		}
+		return mx.State
+	}))
+	defer stop()
+
+	a := dial()
+	b := dial()
+
+	a.send("a1", "view.go")
+	a.recv()
+	if _, _, issues := a.recv(); issues != "issue of a1" {
+		t.Fatalf("client a: got issues %q, want its own issue", issues)
+	}
+
+	// b's view has the same name as a's
+	b.send("b1", "view.go")
+	if cookie, _, issues := b.recv(); cookie != "b1" || issues != "" {
+		t.Fatalf("client b: got response %q with issues %q, want b1 without a's issue", cookie, issues)
+	}
+	if _, _, issues := b.recv(); issues != "issue of b1" {
+		t.Fatalf("client b: got issues %q, want only its own issue", issues)
+	}
+
+	a.send("a2", "view.go")
+	if _, _, issues := a.recv(); issues != "issue of a1" {
+		t.Fatalf("client a: got issues %q, want only its own issue", issues)
+	}
+}
+
+func TestSplitDaemonAddr(t *testing.T) {
+	cases := []struct {
+		addr    string
+		network string
+		ok      bool
+	}{
+		{"unix:/tmp/margo.sock", "unix", true},
+		// TCP connections can't be restricted to the current user
+		{"tcp:localhost:5000", "", false},
+		{"tcp:127.0.0.1:5000", "", false},
+		{"tcp:example.com:5000", "", false},
+		{"udp:localhost:5000", "", false},
+		{"unix:", "", false},
+		{"/tmp/margo.sock", "", false},
+	}
+	for _, c := range cases {
+		network, _, err := splitDaemonAddr(c.addr)
+		if (err == nil) != c.ok || network != c.network {
+			t.Errorf("splitDaemonAddr(%q) = (%q, %v), want network %q and ok=%v", c.addr, network, err, c.network, c.ok)
+		}
+	}
+}
+
+func TestListenPerm(t *testing.T) {
+	dir, err := ioutil.TempDir("", "margo-daemon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "margo.sock")
+
+	ln, err := Listen("unix:" + fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := fi.Mode().Perm(); perm != 0600 {
+		t.Errorf("the socket has permissions %o, want 0600", perm)
+	}
+	if l, _ := ioutil.ReadDir(dir); len(l) != 1 {
+		t.Errorf("Listen left files other than the socket in %s: %v", dir, l)
+	}
+
+	ln.Close()
+	if _, err := os.Stat(fn); !os.IsNotExist(err) {
+		t.Errorf("the socket wasn't removed when the listener was closed: %v", err)
+	}
+
+	if err := ioutil.WriteFile(fn, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Listen("unix:" + fn); err == nil {
+		t.Errorf("Listen replaced %s, which is not a socket", fn)
+	}
+}
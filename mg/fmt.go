@@ -0,0 +1,125 @@
+package mg
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FmtConfig is the configuration for Fmt
+type FmtConfig struct {
+	// Margo, if set, is called to add reducers to the agent, in addition to DefaultReducers
+	// e.g. the user's margo extension
+	Margo MargoFunc
+
+	// Env is the environment of the views
+	// Default: the process' environment
+	Env EnvMap
+
+	// Stderr is used by the agent for logging
+	// Default: the logs are discarded
+	Stderr io.Writer
+
+	// Timeout is the maximum time to wait for a file to be formatted
+	// Default: 1 minute
+	Timeout time.Duration
+}
+
+// FmtFile is a file to be formatted by Fmt
+type FmtFile struct {
+	// Path is the path of the file.
+	// It's used to select the fmt reducers that run, based on its language,
+	// so it doesn't need to exist if Src is set.
+	Path string
+
+	// Src is the content of the file
+	// If it's nil, the file at Path is read
+	Src []byte
+}
+
+// FmtResult is the result of formatting a FmtFile
+type FmtResult struct {
+	FmtFile
+
+	// Fmt is the formatted src
+	Fmt []byte
+
+	// Error is the error reported by the fmt reducers, if any
+	Error error
+}
+
+// Changed returns true if the formatted src is different from the original src
+func (fr FmtResult) Changed() bool {
+	return fr.Error == nil && !bytes.Equal(fr.Src, fr.Fmt)
+}
+
+// Fmt runs the agent's fmt reducers on files without an editor, and returns the formatted files.
+//
+// Each file is formatted by dispatching ViewFmt, as if the user formatted it in the editor,
+// so the same reducers e.g. golang.GoFmt or web.Prettier, run for the same languages.
+//
+// The returned error is only set if the agent failed e.g. it didn't respond before the timeout.
+// Errors formatting a file are returned in its FmtResult.
+func Fmt(cfg FmtConfig, files ...FmtFile) ([]FmtResult, error) {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = time.Minute
+	}
+
+	ha, err := newHeadlessAgent(cfg.Margo, cfg.Env, cfg.Stderr, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer ha.close()
+
+	results := make([]FmtResult, 0, len(files))
+	for _, f := range files {
+		res, err := fmtFile(ha, f)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+func fmtFile(ha *headlessAgent, f FmtFile) (FmtResult, error) {
+	res := FmtResult{FmtFile: f}
+	if res.Src == nil {
+		src, err := ioutil.ReadFile(f.Path)
+		if err != nil {
+			res.Error = err
+			return res, nil
+		}
+		res.Src = src
+	}
+
+	fn, err := filepath.Abs(f.Path)
+	if err != nil {
+		res.Error = err
+		return res, nil
+	}
+	mx, err := ha.request(func(v *View) {
+		v.Path = fn
+		v.Wd = filepath.Dir(fn)
+		v.Name = fn
+		v.Lang = fileLang(fn)
+		v.Src = res.Src
+	}, "ViewFmt")
+	if err != nil {
+		return res, err
+	}
+
+	if len(mx.State.Errors) != 0 {
+		res.Error = errors.New(strings.TrimSpace(strings.Join(mx.State.Errors, "\n")))
+		return res, nil
+	}
+	res.Fmt = mx.State.View.Src
+	if res.Fmt == nil {
+		res.Fmt = res.Src
+	}
+	return res, nil
+}
@@ -0,0 +1,65 @@
+package mg
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFmt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "margo-fmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	a := filepath.Join(dir, "a.txt")
+	if err := ioutil.WriteFile(a, []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// a reducer that fmt's txt files to upper-case, and fails on empty lines
+	margo := func(ma Args) {
+		ma.Store.Use(NewReducer(func(mx *Ctx) *State {
+			if !mx.ActionIs(ViewFmt{}) || !mx.LangIs("txt") {
+				return mx.State
+			}
+			src, _ := mx.View.ReadAll()
+			if bytes.Contains(src, []byte("\n\n")) {
+				return mx.AddErrorf("empty line in %s", mx.View.Filename())
+			}
+			return mx.SetViewSrc(bytes.ToUpper(src))
+		}))
+	}
+
+	results, err := Fmt(FmtConfig{Margo: margo},
+		FmtFile{Path: a},
+		FmtFile{Path: "b.txt", Src: []byte("WORLD\n")},
+		FmtFile{Path: "c.txt", Src: []byte("x\n\ny\n")},
+		FmtFile{Path: "d.go", Src: []byte("package d\n")},
+	)
+	if err != nil {
+		t.Fatalf("Fmt failed: %s", err)
+	}
+	want := []struct {
+		fmt     string
+		changed bool
+		err     bool
+	}{
+		{"HELLO\n", true, false},
+		{"WORLD\n", false, false},
+		{"", false, true},
+		{"package d\n", false, false},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("Fmt() returned %d results, want %d", len(results), len(want))
+	}
+	for i, w := range want {
+		res := results[i]
+		if string(res.Fmt) != w.fmt || res.Changed() != w.changed || (res.Error != nil) != w.err {
+			t.Errorf("result %d (%s) is (%q, changed=%v, error=%v), want (%q, changed=%v, error=%v)",
+				i, res.Path, res.Fmt, res.Changed(), res.Error, w.fmt, w.changed, w.err)
+		}
+	}
+}
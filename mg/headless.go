@@ -0,0 +1,167 @@
+package mg
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"margo.sh/mg/actions"
+	"margo.sh/mgutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// fileLangs maps the file extensions whose language isn't the extension itself, to their language
+	fileLangs = map[string]Lang{
+		".bash": ShellScript,
+		".bat":  DosBatch,
+		".cc":   CPP,
+		".cpp":  CPP,
+		".h":    C,
+		".hs":   Haskell,
+		".htm":  HTML,
+		".jsx":  JSX,
+		".py":   Python,
+		".rb":   Ruby,
+		".rs":   Rust,
+		".sh":   ShellScript,
+		".yml":  Yaml,
+	}
+)
+
+// fileLang returns the language of the file fn, as guessed from its name
+func fileLang(fn string) Lang {
+	switch filepath.Base(fn) {
+	case "go.mod":
+		return GoMod
+	case "go.sum":
+		return GoSum
+	}
+	ext := strings.ToLower(filepath.Ext(fn))
+	if lang, ok := fileLangs[ext]; ok {
+		return lang
+	}
+	return Lang(strings.TrimPrefix(ext, "."))
+}
+
+// headlessAgent is an agent that's driven without an editor e.g. by Check and Fmt
+type headlessAgent struct {
+	ag        *Agent
+	env       EnvMap
+	timeout   time.Duration
+	responses chan *Ctx
+	done      chan struct{}
+	unsub     func()
+	n         int
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+// newHeadlessAgent returns a new mounted agent with the reducers added by margo.
+//
+// If env is nil, the process' environment is used.
+// If stderr is nil, the agent's logs are discarded.
+// timeout is the maximum time to wait for the response to each request.
+func newHeadlessAgent(margo MargoFunc, env EnvMap, stderr io.Writer, timeout time.Duration) (*headlessAgent, error) {
+	if env == nil {
+		env = EnvMap{}
+		for _, s := range os.Environ() {
+			if i := strings.IndexByte(s, '='); i > 0 {
+				env[s[:i]] = s[i+1:]
+			}
+		}
+	}
+	if stderr == nil {
+		stderr = ioutil.Discard
+	}
+
+	ag, err := NewAgent(AgentConfig{
+		Stdin:  &mgutil.IOWrapper{},
+		Stdout: &mgutil.IOWrapper{},
+		Stderr: stderr,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if margo != nil {
+		margo(ag.Args())
+	}
+
+	ha := &headlessAgent{
+		ag:        ag,
+		env:       env,
+		timeout:   timeout,
+		responses: make(chan *Ctx, 1),
+		done:      make(chan struct{}),
+	}
+	ha.unsub = ag.Store.Subscribe(ha.sub)
+	ag.Store.mount()
+	return ha, nil
+}
+
+// close shuts down the agent
+func (ha *headlessAgent) close() {
+	close(ha.done)
+	ha.ag.shutdown()
+	ha.unsub()
+}
+
+func (ha *headlessAgent) sub(mx *Ctx) {
+	ha.mu.Lock()
+	ha.last = time.Now()
+	ha.mu.Unlock()
+
+	if mx.Cookie == "" {
+		return
+	}
+	select {
+	case ha.responses <- mx:
+	case <-ha.done:
+	}
+}
+
+// request sends a request for the action named act, in the view updated by view, and returns its reduction
+func (ha *headlessAgent) request(view func(*View), act string) (*Ctx, error) {
+	ha.n++
+	rq := newAgentReq(ha.ag.Store)
+	rq.Cookie = fmt.Sprintf("headless.%d", ha.n)
+	rq.Props.Env = ha.env
+	view(rq.Props.View)
+	rq.Actions = []actions.ActionData{{Name: act}}
+	rq.finalize(ha.ag)
+	ha.ag.handleReq(rq)
+
+	tmr := time.NewTimer(ha.timeout)
+	defer tmr.Stop()
+	for {
+		select {
+		case mx := <-ha.responses:
+			if mx.Cookie == rq.Cookie {
+				return mx, nil
+			}
+		case <-tmr.C:
+			return nil, fmt.Errorf("no response to %s after %s", act, ha.timeout)
+		}
+	}
+}
+
+// settle waits until the agent has been idle for d, or the timeout elapses
+func (ha *headlessAgent) settle(d time.Duration) {
+	sto := ha.ag.Store
+	deadline := time.Now().Add(ha.timeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(d / 10)
+
+		ha.mu.Lock()
+		idle := time.Since(ha.last)
+		ha.mu.Unlock()
+
+		if idle >= d && sto.tasks.active() == 0 && len(sto.dsp.lo) == 0 && len(sto.dsp.hi) == 0 {
+			return
+		}
+	}
+}
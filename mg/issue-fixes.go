@@ -0,0 +1,152 @@
+package mg
+
+import (
+	"bytes"
+	"fmt"
+	"margo.sh/mgutil"
+	"sort"
+)
+
+// TextEdit replaces the text between the positions Row:Col and EndRow:EndCol with Text.
+//
+// Rows and columns are zero-based, and columns are byte offsets into the line.
+type TextEdit struct {
+	Row    int
+	Col    int
+	EndRow int
+	EndCol int
+	Text   string
+}
+
+// NewTextEdit returns a TextEdit that replaces src[start:end] with text
+func NewTextEdit(src []byte, start, end int, text string) TextEdit {
+	te := TextEdit{Text: text}
+	te.Row, te.Col = textEditPos(src, start)
+	te.EndRow, te.EndCol = textEditPos(src, end)
+	return te
+}
+
+func textEditPos(src []byte, ofs int) (row, col int) {
+	ofs = mgutil.Clamp(0, len(src), ofs)
+	row = bytes.Count(src[:ofs], []byte{'\n'})
+	col = ofs - (bytes.LastIndexByte(src[:ofs], '\n') + 1)
+	return row, col
+}
+
+// IssueFix is a suggested fix for an Issue.
+// Its Edits apply to the file in which the issue was reported.
+type IssueFix struct {
+	Title string
+	Edits []TextEdit
+
+	// Hash is the hash (see SrcHash) of the src that Edits were computed for.
+	// The fix is refused if the view's src has changed since i.e. its View.Hash is different.
+	Hash string
+}
+
+// ApplyIssueFix is dispatched by the client to apply one of an issue's Fixes to the view.
+//
+// The issue is identified by its Path or Name, Row and Message, as reported to the client,
+// and the fix by its Title.
+type ApplyIssueFix struct {
+	ActionType
+
+	Path    string
+	Name    string
+	Row     int
+	Message string
+	Title   string
+}
+
+// lookup returns the fix in issues identified by the action
+func (a ApplyIssueFix) lookup(v *View, issues IssueSet) (IssueFix, bool) {
+	p := Issue{Path: a.Path, Name: a.Name, Row: a.Row, Message: a.Message}
+	for _, isu := range issues {
+		if !p.Equal(isu) && !p.Equal(isu.finalize(v)) {
+			continue
+		}
+		for _, fix := range isu.Fixes {
+			if fix.Title == a.Title {
+				return fix, true
+			}
+		}
+	}
+	return IssueFix{}, false
+}
+
+// ApplyTextEdits returns a copy of src with the list of edits applied.
+//
+// The edits must not overlap, and their positions refer to the original src.
+func ApplyTextEdits(src []byte, edits []TextEdit) ([]byte, error) {
+	type span struct {
+		start, end int
+		text       string
+	}
+
+	lines := []int{0}
+	for i, c := range src {
+		if c == '\n' {
+			lines = append(lines, i+1)
+		}
+	}
+	offset := func(row, col int) (int, bool) {
+		if row < 0 || row >= len(lines) || col < 0 {
+			return 0, false
+		}
+		eol := len(src)
+		if row+1 < len(lines) {
+			eol = lines[row+1] - 1
+		}
+		ofs := lines[row] + col
+		return ofs, ofs <= eol
+	}
+
+	spans := make([]span, 0, len(edits))
+	for _, te := range edits {
+		start, ok1 := offset(te.Row, te.Col)
+		end, ok2 := offset(te.EndRow, te.EndCol)
+		if !ok1 || !ok2 || start > end {
+			return nil, fmt.Errorf("invalid edit range %d:%d-%d:%d", te.Row+1, te.Col+1, te.EndRow+1, te.EndCol+1)
+		}
+		spans = append(spans, span{start, end, te.Text})
+	}
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+
+	buf := bytes.NewBuffer(make([]byte, 0, len(src)))
+	pos := 0
+	for _, sp := range spans {
+		if sp.start < pos {
+			return nil, fmt.Errorf("overlapping edits")
+		}
+		buf.Write(src[pos:sp.start])
+		buf.WriteString(sp.text)
+		pos = sp.end
+	}
+	buf.Write(src[pos:])
+	return buf.Bytes(), nil
+}
+
+// issueFixSupport applies ApplyIssueFix actions
+type issueFixSupport struct{ ReducerType }
+
+func (ifs *issueFixSupport) Reduce(mx *Ctx) *State {
+	act, ok := mx.Action.(ApplyIssueFix)
+	if !ok {
+		return mx.State
+	}
+	fix, ok := act.lookup(mx.View, mx.Issues)
+	if !ok {
+		return mx.AddErrorf("ApplyIssueFix: cannot find the fix `%s` for the issue `%s`", act.Title, act.Message)
+	}
+	if fix.Hash != mx.View.Hash {
+		return mx.AddErrorf("ApplyIssueFix: %s: the view has changed since the fix was suggested, please try again", fix.Title)
+	}
+	src, err := mx.View.ReadAll()
+	if err == nil {
+		src, err = ApplyTextEdits(src, fix.Edits)
+	}
+	if err != nil {
+		return mx.AddErrorf("ApplyIssueFix: %s: %s", fix.Title, err)
+	}
+	return mx.SetViewSrc(src)
+}
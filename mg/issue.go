@@ -78,6 +78,9 @@ type Issue struct {
 	Tag     IssueTag
 	Label   string
 	Message string
+
+	// Fixes is the list of suggested fixes for the issue, see ApplyIssueFix
+	Fixes []IssueFix
 }
 
 func (isu Issue) Error() string {
@@ -167,23 +170,47 @@ func (s IssueSet) merge(view *View, l ...Issue) IssueSet {
 		return s
 	}
 	res := make(IssueSet, 0, len(s)+len(l))
-	seen := make(map[issueHash]bool, cap(res))
+	seen := make(map[issueHash]int, cap(res))
 	for _, isus := range [][]Issue{s, l} {
 		for _, isu := range isus {
 			if view != nil {
 				isu = isu.finalize(view)
 			}
 			ish := isu.hash()
-			if seen[ish] {
+			if i, ok := seen[ish]; ok {
+				res[i].Fixes = mergeIssueFixes(res[i].Fixes, isu.Fixes)
 				continue
 			}
-			seen[ish] = true
+			seen[ish] = len(res)
 			res = append(res, isu)
 		}
 	}
 	return res
 }
 
+// mergeIssueFixes returns the fixes in a, followed by those in b whose Title is not in a.
+// Fixes are identified by their Title (see ApplyIssueFix), so only the first fix with a given Title is kept.
+func mergeIssueFixes(a, b []IssueFix) []IssueFix {
+	var l []IssueFix
+	for _, fb := range b {
+		dup := false
+		for _, fa := range a {
+			dup = dup || fa.Title == fb.Title
+		}
+		for _, fl := range l {
+			dup = dup || fl.Title == fb.Title
+		}
+		if !dup {
+			l = append(l, fb)
+		}
+	}
+	if len(l) == 0 {
+		return a
+	}
+	// a might be shared with the issue it was copied from
+	return append(append(make([]IssueFix, 0, len(a)+len(l)), a...), l...)
+}
+
 func (s IssueSet) Remove(l ...Issue) IssueSet {
 	res := make(IssueSet, 0, len(s)+len(l))
 	q := IssueSet(l)
@@ -228,22 +255,30 @@ type IssueKey struct {
 	Dir  string
 }
 
+// clientIssueKey is the key of issues stored by a client.
+// View names are only unique per-client, so issues keyed by name are only matched in the client that stored them.
+type clientIssueKey struct {
+	IssueKey
+	client *Store
+}
+
 type issueKeySupport struct {
 	ReducerType
-	issues map[IssueKey]IssueSet
+	issues map[clientIssueKey]IssueSet
 }
 
 func (iks *issueKeySupport) RMount(mx *Ctx) {
-	iks.issues = map[IssueKey]IssueSet{}
+	iks.issues = map[clientIssueKey]IssueSet{}
 }
 
 func (iks *issueKeySupport) Reduce(mx *Ctx) *State {
 	switch act := mx.Action.(type) {
 	case StoreIssues:
+		ck := clientIssueKey{IssueKey: act.IssueKey, client: mx.Store}
 		if len(act.Issues) == 0 {
-			delete(iks.issues, act.IssueKey)
+			delete(iks.issues, ck)
 		} else {
-			iks.issues[act.IssueKey] = act.Issues
+			iks.issues[ck] = act.Issues
 		}
 	}
 
@@ -252,8 +287,9 @@ func (iks *issueKeySupport) Reduce(mx *Ctx) *State {
 	name := norm(mx.View.Name)
 	path := norm(mx.View.Path)
 	dir := norm(mx.View.Dir())
-	match := func(k IssueKey) bool {
+	match := func(ck clientIssueKey) bool {
 		// no restrictions were set
+		k := ck.IssueKey
 		k.Key = nil
 		if k == (IssueKey{}) {
 			return true
@@ -262,7 +298,7 @@ func (iks *issueKeySupport) Reduce(mx *Ctx) *State {
 		if path != "" && path == k.Path {
 			return true
 		}
-		if name != "" && name == k.Name {
+		if name != "" && name == k.Name && ck.client == mx.Store {
 			return true
 		}
 		// if the view doesn't exist on disk, the dir is unreliable
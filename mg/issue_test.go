@@ -54,3 +54,84 @@ func BenchmarkIssueSetAdd(b *testing.B) {
 	b.Run("small, small", func(b *testing.B) { run(b, small, small) })
 	b.Run("large, small", func(b *testing.B) { run(b, large, small) })
 }
+
+func TestApplyTextEdits(t *testing.T) {
+	src := []byte("package p\n\nfunc f() {\n\tx := 1\n}\n")
+	edits := []TextEdit{
+		NewTextEdit(src, len(src), len(src), "\nfunc g() {}\n"),
+		{Row: 3, Col: 7, EndRow: 3, EndCol: 7, Text: "\n\t_ = x"},
+		{Row: 2, Col: 5, EndRow: 2, EndCol: 6, Text: "h"},
+	}
+	expect := "package p\n\nfunc h() {\n\tx := 1\n\t_ = x\n}\n\nfunc g() {}\n"
+	got, err := ApplyTextEdits(src, edits)
+	if err != nil {
+		t.Fatalf("ApplyTextEdits failed: %s", err)
+	}
+	if string(got) != expect {
+		t.Errorf("ApplyTextEdits: expected %q, got %q", expect, got)
+	}
+
+	for _, te := range []TextEdit{
+		{Row: 0, Col: 11, EndRow: 0, EndCol: 11},
+		{Row: 6, Col: 0, EndRow: 6, EndCol: 0},
+		{Row: 2, Col: 2, EndRow: 1, EndCol: 0},
+	} {
+		if _, err := ApplyTextEdits(src, []TextEdit{te}); err == nil {
+			t.Errorf("ApplyTextEdits(%v) should fail", te)
+		}
+	}
+	overlap := []TextEdit{{Row: 2, Col: 0, EndRow: 2, EndCol: 6}, {Row: 2, Col: 5, EndRow: 2, EndCol: 7}}
+	if _, err := ApplyTextEdits(src, overlap); err == nil {
+		t.Errorf("ApplyTextEdits should fail for overlapping edits")
+	}
+}
+
+func TestApplyIssueFixHash(t *testing.T) {
+	src := []byte("package p\n")
+	fix := IssueFix{
+		Title: "Add a comment",
+		Edits: []TextEdit{NewTextEdit(src, len(src), len(src), "\n// c\n")},
+		Hash:  SrcHash(src),
+	}
+	isu := Issue{Name: "v", Message: "m", Fixes: []IssueFix{fix}}
+	apply := func(src []byte) *State {
+		mx := NewTestingCtx(ApplyIssueFix{Name: "v", Message: "m", Title: fix.Title})
+		v := &View{Name: "v", Src: src, Hash: SrcHash(src)}
+		mx = mx.SetState(mx.State.SetView(v).AddIssues(isu))
+		return (&issueFixSupport{}).Reduce(mx)
+	}
+
+	st := apply(src)
+	if got, _ := st.View.ReadAll(); string(got) != "package p\n\n// c\n" || len(st.Errors) != 0 {
+		t.Errorf("the fix was not applied: src=%q, errors=%v", got, st.Errors)
+	}
+
+	changed := []byte("package q\n")
+	st = apply(changed)
+	if got, _ := st.View.ReadAll(); string(got) != string(changed) || len(st.Errors) == 0 {
+		t.Errorf("the fix was applied to a view whose src changed: src=%q, errors=%v", got, st.Errors)
+	}
+}
+
+func TestIssueSetAddMergesFixes(t *testing.T) {
+	isu := Issue{Path: "/p/a.go", Row: 1, Message: "x declared and not used"}
+	a := isu
+	a.Fixes = []IssueFix{{Title: "remove x"}}
+	b := isu
+	b.Fixes = []IssueFix{{Title: "remove x"}, {Title: "use x"}}
+
+	s := IssueSet{a}.Add(b, isu)
+	if len(s) != 1 {
+		t.Fatalf("Add() returned %d issues, want the duplicates to be merged: %v", len(s), s)
+	}
+	var titles []string
+	for _, f := range s[0].Fixes {
+		titles = append(titles, f.Title)
+	}
+	if got := fmt.Sprint(titles); got != "[remove x use x]" {
+		t.Errorf("the merged issue has fixes %s, want [remove x use x]", got)
+	}
+	if len(a.Fixes) != 1 {
+		t.Errorf("Add() modified the fixes of the issue it merged into")
+	}
+}
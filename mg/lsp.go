@@ -0,0 +1,975 @@
+package mg
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/build"
+	"io"
+	"margo.sh/mg/actions"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+const (
+	// LSPProtocol is the name of the Language Server Protocol IPC protocol
+	LSPProtocol = "lsp"
+
+	lspNotifyCookie = "lsp:notify"
+)
+
+// lspServer implements the Language Server Protocol front-end of the Agent.
+//
+// Requests from the client are translated into agent requests (margo actions)
+// and the resulting states are translated back into LSP responses and notifications.
+// Only full text document sync is supported.
+type lspServer struct {
+	ag *Agent
+	rd *bufio.Reader
+	wr io.Writer
+
+	wmu sync.Mutex
+	mu  sync.Mutex
+
+	editor  EditorProps
+	env     EnvMap
+	docs    map[string]*lspDoc
+	cur     string
+	seq     int
+	pending map[string]lspPending
+	defs    []lspPending
+	diags   map[string]string
+}
+
+type lspDoc struct {
+	URI   string
+	Path  string
+	Lang  Lang
+	Src   []byte
+	Dirty bool
+}
+
+type lspPending struct {
+	ID     json.RawMessage
+	Method string
+	URI    string
+	Fd     string
+	Cookie string
+}
+
+type lspMessage struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  interface{}      `json:"result,omitempty"`
+	Error   *lspError        `json:"error,omitempty"`
+}
+
+type lspError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspLocation struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+type lspTextDocument struct {
+	URI        string `json:"uri"`
+	LanguageID string `json:"languageId"`
+	Text       string `json:"text"`
+}
+
+type lspDocParams struct {
+	TextDocument   lspTextDocument `json:"textDocument"`
+	Position       lspPosition     `json:"position"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+	Text *string `json:"text"`
+}
+
+type lspDiagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Source   string   `json:"source,omitempty"`
+	Message  string   `json:"message"`
+}
+
+func newLSPServer(ag *Agent) *lspServer {
+	return &lspServer{
+		ag:      ag,
+		rd:      bufio.NewReader(ag.stdin),
+		wr:      ag.stdout,
+		env:     lspEnv(),
+		docs:    map[string]*lspDoc{},
+		pending: map[string]lspPending{},
+		diags:   map[string]string{},
+		editor: EditorProps{
+			Name:     LSPProtocol,
+			Client:   EditorClientProps{Name: "margo.lsp"},
+			Protocol: LSPProtocol,
+		},
+	}
+}
+
+// lspEnv returns the agent's environment.
+// Unlike the Sublime Text client, LSP clients don't send their environment.
+func lspEnv() EnvMap {
+	env := EnvMap{}
+	for _, s := range os.Environ() {
+		if i := strings.IndexByte(s, '='); i > 0 {
+			env[s[:i]] = s[i+1:]
+		}
+	}
+	if env["GOROOT"] == "" {
+		env["GOROOT"] = build.Default.GOROOT
+	}
+	if env["GOPATH"] == "" {
+		env["GOPATH"] = build.Default.GOPATH
+	}
+	return env
+}
+
+func (ls *lspServer) serve() error {
+	for {
+		msg, err := lspReadMessage(ls.rd)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("lsp.read: %s", err)
+		}
+		if msg.Method == "exit" {
+			return nil
+		}
+		if err := ls.handle(msg); err != nil {
+			ls.ag.Log.Printf("lsp: %s: %s\n", msg.Method, err)
+			if msg.ID != nil {
+				ls.reply(*msg.ID, nil, &lspError{Code: -32603, Message: err.Error()})
+			}
+		}
+	}
+}
+
+func (ls *lspServer) handle(msg *lspMessage) error {
+	if msg.ID == nil {
+		return ls.notification(msg)
+	}
+
+	id := *msg.ID
+	switch msg.Method {
+	case "initialize":
+		return ls.initialize(id, msg.Params)
+	case "shutdown":
+		ls.reply(id, nil, nil)
+		return nil
+	case "textDocument/completion":
+		return ls.query(id, msg, "", actions.ActionData{Name: "QueryCompletions"})
+	case "textDocument/formatting":
+		return ls.query(id, msg, "", actions.ActionData{Name: "ViewFmt"})
+	case "textDocument/hover":
+		return ls.queryHover(id, msg)
+	case "textDocument/signatureHelp":
+		return ls.query(id, msg, "", actions.ActionData{Name: "QuerySignatureHelp"})
+	case "textDocument/documentSymbol":
+		return ls.query(id, msg, "", actions.ActionData{Name: "QueryOutline"})
+	case "textDocument/semanticTokens/full":
+		return ls.query(id, msg, "", actions.ActionData{Name: "QuerySemanticTokens"})
+	case "textDocument/definition":
+		return ls.queryDefinition(id, msg)
+	}
+	ls.reply(id, nil, &lspError{Code: -32601, Message: "method not found: " + msg.Method})
+	return nil
+}
+
+func (ls *lspServer) notification(msg *lspMessage) error {
+	p := lspDocParams{}
+	if len(msg.Params) != 0 {
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			return err
+		}
+	}
+
+	if rq := ls.notificationReq(msg.Method, p); rq != nil {
+		ls.ag.handleReq(rq)
+	}
+	return nil
+}
+
+func (ls *lspServer) notificationReq(method string, p lspDocParams) *agentReq {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	td := p.TextDocument
+	switch method {
+	case "textDocument/didOpen":
+		doc := &lspDoc{
+			URI:  td.URI,
+			Path: lspURIPath(td.URI),
+			Lang: Lang(td.LanguageID),
+			Src:  []byte(td.Text),
+		}
+		ls.docs[td.URI] = doc
+		ls.cur = td.URI
+		return ls.request(lspNotifyCookie, doc, 0, "ViewLoaded", "ViewActivated")
+	case "textDocument/didChange":
+		doc := ls.docs[td.URI]
+		if doc == nil || len(p.ContentChanges) == 0 {
+			return nil
+		}
+		doc.Src = []byte(p.ContentChanges[len(p.ContentChanges)-1].Text)
+		doc.Dirty = true
+		return ls.request(lspNotifyCookie, doc, 0, ls.activate(doc, "ViewModified")...)
+	case "textDocument/didSave":
+		doc := ls.docs[td.URI]
+		if doc == nil {
+			return nil
+		}
+		if p.Text != nil {
+			doc.Src = []byte(*p.Text)
+		}
+		doc.Dirty = false
+		return ls.request(lspNotifyCookie, doc, 0, ls.activate(doc, "ViewSaved")...)
+	case "textDocument/didClose":
+		delete(ls.docs, td.URI)
+		ls.ag.Store.views.forget(lspURIPath(td.URI))
+		if _, ok := ls.diags[td.URI]; ok {
+			delete(ls.diags, td.URI)
+			ls.notify("textDocument/publishDiagnostics", map[string]interface{}{
+				"uri":         td.URI,
+				"diagnostics": []lspDiagnostic{},
+			})
+		}
+	}
+	return nil
+}
+
+// activate returns the list of action names, prefixed with ViewActivated if doc is not the current view
+func (ls *lspServer) activate(doc *lspDoc, names ...string) []string {
+	if ls.cur == doc.URI {
+		return names
+	}
+	ls.cur = doc.URI
+	return append([]string{"ViewActivated"}, names...)
+}
+
+func (ls *lspServer) initialize(id json.RawMessage, params json.RawMessage) error {
+	p := struct {
+		ClientInfo struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"clientInfo"`
+	}{}
+	if len(params) != 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return err
+		}
+	}
+
+	ls.mu.Lock()
+	if s := p.ClientInfo.Name; s != "" {
+		ls.editor.Name = s
+		ls.editor.Version = p.ClientInfo.Version
+	}
+	ls.mu.Unlock()
+
+	ls.reply(id, map[string]interface{}{
+		"capabilities": map[string]interface{}{
+			"textDocumentSync": map[string]interface{}{
+				"openClose": true,
+				"change":    1,
+				"save":      map[string]interface{}{"includeText": true},
+			},
+			"completionProvider": map[string]interface{}{
+				"triggerCharacters": []string{"."},
+			},
+			"hoverProvider":              true,
+			"definitionProvider":         true,
+			"documentFormattingProvider": true,
+			"documentSymbolProvider":     true,
+			"signatureHelpProvider": map[string]interface{}{
+				"triggerCharacters": []string{"(", ","},
+			},
+			"semanticTokensProvider": map[string]interface{}{
+				"legend": map[string]interface{}{
+					"tokenTypes":     lspTokenTypes,
+					"tokenModifiers": SemanticTokenModNames,
+				},
+				"full": true,
+			},
+		},
+		"serverInfo": map[string]interface{}{
+			"name": ls.ag.Name,
+		},
+	}, nil)
+	return nil
+}
+
+// query sends act to the agent and records the request so its result can be sent
+// when the resulting state is received. fd is the output fd of RunCmd actions.
+func (ls *lspServer) query(id json.RawMessage, msg *lspMessage, fd string, act actions.ActionData) error {
+	p := lspDocParams{}
+	if err := json.Unmarshal(msg.Params, &p); err != nil {
+		return err
+	}
+	if rq := ls.queryReq(id, msg.Method, fd, p, act); rq != nil {
+		ls.ag.handleReq(rq)
+	}
+	return nil
+}
+
+func (ls *lspServer) queryReq(id json.RawMessage, method, fd string, p lspDocParams, act actions.ActionData) *agentReq {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	doc := ls.docs[p.TextDocument.URI]
+	if doc == nil {
+		ls.reply(id, nil, nil)
+		return nil
+	}
+
+	pos := lspOffset(doc.Src, p.Position)
+	acts := []actions.ActionData{}
+	for _, name := range ls.activate(doc) {
+		acts = append(acts, actions.ActionData{Name: name})
+	}
+	acts = append(acts, act)
+
+	ls.seq++
+	cookie := "lsp:" + strconv.Itoa(ls.seq)
+	ls.pending[cookie] = lspPending{ID: id, Method: method, URI: doc.URI, Fd: fd, Cookie: cookie}
+	return ls.agentReq(cookie, doc, utf8.RuneCount(doc.Src[:pos]), acts)
+}
+
+func (ls *lspServer) queryHover(id json.RawMessage, msg *lspMessage) error {
+	p := lspDocParams{}
+	if err := json.Unmarshal(msg.Params, &p); err != nil {
+		return err
+	}
+	ls.mu.Lock()
+	doc := ls.docs[p.TextDocument.URI]
+	ls.mu.Unlock()
+	if doc == nil {
+		ls.reply(id, nil, nil)
+		return nil
+	}
+
+	line := lspLine(doc.Src, p.Position.Line)
+	data, err := json.Marshal(map[string]int{
+		"Row": p.Position.Line,
+		"Col": lspByteCol(line, p.Position.Character),
+	})
+	if err != nil {
+		return err
+	}
+	return ls.query(id, msg, "", actions.ActionData{Name: "QueryTooltips", Data: data})
+}
+
+func (ls *lspServer) queryDefinition(id json.RawMessage, msg *lspMessage) error {
+	fd := "lsp.definition#" + string(id)
+	data, err := json.Marshal(map[string]string{
+		"Fd":   fd,
+		"Name": "goto.definition",
+	})
+	if err != nil {
+		return err
+	}
+	return ls.query(id, msg, fd, actions.ActionData{Name: "RunCmd", Data: data})
+}
+
+// request returns an agent request for the actions names
+func (ls *lspServer) request(cookie string, doc *lspDoc, pos int, names ...string) *agentReq {
+	acts := make([]actions.ActionData, len(names))
+	for i, name := range names {
+		acts[i].Name = name
+	}
+	return ls.agentReq(cookie, doc, pos, acts)
+}
+
+func (ls *lspServer) agentReq(cookie string, doc *lspDoc, pos int, acts []actions.ActionData) *agentReq {
+	ag := ls.ag
+	rq := newAgentReq(ag.Store)
+	rq.Cookie = cookie
+	rq.Actions = acts
+	rq.Props.Editor.EditorProps = ls.editor
+	rq.Props.Env = ls.env
+	v := rq.Props.View
+	v.Path = doc.Path
+	v.Wd = filepath.Dir(doc.Path)
+	v.Name = filepath.Base(doc.Path)
+	v.Src = doc.Src
+	v.Pos = pos
+	v.Dirty = doc.Dirty
+	v.Lang = doc.Lang
+	rq.finalize(ag)
+	return rq
+}
+
+// sub is the Store subscriber used in place of Agent.sub
+func (ls *lspServer) sub(mx *Ctx) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	st := mx.State
+	if p, ok := ls.pending[mx.Cookie]; ok {
+		delete(ls.pending, mx.Cookie)
+		ls.respond(p, st)
+	}
+	ls.resolveDefs(st)
+	ls.publishDiagnostics(mx)
+}
+
+func (ls *lspServer) respond(p lspPending, st *State) {
+	switch p.Method {
+	case "textDocument/completion":
+		src, pos := st.View.SrcPos()
+		items := make([]interface{}, len(st.Completions))
+		for i, c := range st.Completions {
+			item := map[string]interface{}{
+				"label":            c.Query,
+				"detail":           c.Title,
+				"filterText":       c.Query,
+				"insertText":       c.Src,
+				"insertTextFormat": 2,
+				"kind":             lspCompletionKind(c.Tag),
+			}
+			if c.Replace > 0 && c.Replace <= pos {
+				// the client filters against the text in the range,
+				// so filterText must start with the text before the current word
+				prefix := bytes.TrimRightFunc(src[pos-c.Replace:pos], lspIsWordRune)
+				rng := lspRange{Start: lspPos(src, pos-c.Replace), End: lspPos(src, pos)}
+				item["filterText"] = string(prefix) + c.Query
+				item["textEdit"] = map[string]interface{}{"range": rng, "newText": c.Src}
+				delete(item, "insertText")
+			}
+			if len(c.Edits) != 0 {
+				edits := make([]interface{}, len(c.Edits))
+				for j, te := range c.Edits {
+					edits[j] = map[string]interface{}{"range": lspEditRange(src, te), "newText": te.Text}
+				}
+				item["additionalTextEdits"] = edits
+			}
+			items[i] = item
+		}
+		ls.reply(p.ID, map[string]interface{}{
+			"isIncomplete": false,
+			"items":        items,
+		}, nil)
+	case "textDocument/hover":
+		if len(st.Tooltips) == 0 {
+			ls.reply(p.ID, nil, nil)
+			return
+		}
+		l := make([]string, len(st.Tooltips))
+		for i, t := range st.Tooltips {
+			l[i] = t.Content
+		}
+		ls.reply(p.ID, map[string]interface{}{
+			"contents": map[string]string{
+				"kind":  "markdown",
+				"value": strings.Join(l, "\n\n---\n\n"),
+			},
+		}, nil)
+	case "textDocument/signatureHelp":
+		if st.SignatureHelp == nil {
+			ls.reply(p.ID, nil, nil)
+			return
+		}
+		ls.reply(p.ID, lspSignatureHelp(st.SignatureHelp), nil)
+	case "textDocument/documentSymbol":
+		src, _ := st.View.SrcPos()
+		ls.reply(p.ID, lspDocumentSymbols(src, st.Outline), nil)
+	case "textDocument/semanticTokens/full":
+		if st.SemanticTokens == nil {
+			ls.reply(p.ID, nil, nil)
+			return
+		}
+		src, _ := st.View.SrcPos()
+		ls.reply(p.ID, map[string]interface{}{
+			"data": lspSemanticTokens(src, st.SemanticTokens.Tokens()),
+		}, nil)
+	case "textDocument/formatting":
+		doc := ls.docs[p.URI]
+		v := st.View
+		if doc == nil || v.changed == 0 || bytes.Equal(v.Src, doc.Src) {
+			ls.reply(p.ID, []interface{}{}, nil)
+			return
+		}
+		end := lspPos(doc.Src, len(doc.Src))
+		doc.Src = v.Src
+		ls.reply(p.ID, []interface{}{map[string]interface{}{
+			"range":   lspRange{End: end},
+			"newText": string(v.Src),
+		}}, nil)
+	case "textDocument/definition":
+		for _, ca := range st.clientActions {
+			if act, ok := ca.Data.(Activate); ok {
+				ls.reply(p.ID, ls.location(act), nil)
+				return
+			}
+		}
+		ls.defs = append(ls.defs, p)
+	}
+}
+
+// resolveDefs responds to pending definition requests.
+// The goto.definition command reports its result asynchronously through the Activate client action,
+// which carries the cookie of the request that ran the command.
+// If the command fails, its output is closed without an Activate.
+func (ls *lspServer) resolveDefs(st *State) {
+	if len(ls.defs) == 0 {
+		return
+	}
+	for _, ca := range st.clientActions {
+		switch act := ca.Data.(type) {
+		case Activate:
+			ls.resolveDef(func(p lspPending) bool { return act.Cookie != "" && p.Cookie == act.Cookie }, ls.location(act))
+		case CmdOutput:
+			if act.Close {
+				ls.resolveDef(func(p lspPending) bool { return p.Fd == act.Fd }, nil)
+			}
+		}
+	}
+}
+
+// resolveDef replies with result to the first pending definition request that matches
+func (ls *lspServer) resolveDef(match func(lspPending) bool, result interface{}) {
+	for i, p := range ls.defs {
+		if match(p) {
+			ls.reply(p.ID, result, nil)
+			ls.defs = append(ls.defs[:i:i], ls.defs[i+1:]...)
+			return
+		}
+	}
+}
+
+func (ls *lspServer) location(act Activate) interface{} {
+	fn := act.Path
+	if fn == "" {
+		return nil
+	}
+	uri := lspPathURI(fn)
+	src := []byte(nil)
+	if doc := ls.docs[uri]; doc != nil {
+		src = doc.Src
+	}
+	pos := lspPosition{Line: act.Row, Character: act.Col}
+	if src != nil {
+		pos.Character = lspCharCol(lspLine(src, act.Row), act.Col)
+	}
+	return lspLocation{URI: uri, Range: lspRange{Start: pos, End: pos}}
+}
+
+func (ls *lspServer) publishDiagnostics(mx *Ctx) {
+	diags := map[string][]lspDiagnostic{}
+	for _, isu := range mx.State.Issues {
+		fn := isu.Path
+		if fn == "" {
+			if !isu.InView(mx.View) {
+				continue
+			}
+			fn = mx.View.Path
+		}
+		if fn == "" {
+			continue
+		}
+		uri := lspPathURI(fn)
+		d := lspDiagnostic{
+			Severity: lspSeverity(isu.Tag),
+			Source:   isu.Label,
+			Message:  isu.Message,
+		}
+		d.Range.Start = lspPosition{Line: isu.Row, Character: isu.Col}
+		d.Range.End = d.Range.Start
+		if doc := ls.docs[uri]; doc != nil {
+			line := lspLine(doc.Src, isu.Row)
+			d.Range.Start.Character = lspCharCol(line, isu.Col)
+			d.Range.End.Character = d.Range.Start.Character
+			if isu.End > isu.Col {
+				d.Range.End.Character = lspCharCol(line, isu.End)
+			}
+		}
+		diags[uri] = append(diags[uri], d)
+	}
+
+	// only the current view's issues are known, so we can only clear those
+	if mx.View.Path != "" {
+		if uri := lspPathURI(mx.View.Path); diags[uri] == nil {
+			diags[uri] = []lspDiagnostic{}
+		}
+	}
+
+	uris := make([]string, 0, len(diags))
+	for uri := range diags {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+	for _, uri := range uris {
+		l := diags[uri]
+		sort.SliceStable(l, func(i, j int) bool {
+			return l[i].Range.Start.Line < l[j].Range.Start.Line
+		})
+		s, _ := json.Marshal(l)
+		key := string(s)
+		if prev, ok := ls.diags[uri]; ok && prev == key || !ok && len(l) == 0 {
+			continue
+		}
+		ls.diags[uri] = key
+		ls.notify("textDocument/publishDiagnostics", map[string]interface{}{
+			"uri":         uri,
+			"diagnostics": l,
+		})
+	}
+}
+
+func (ls *lspServer) reply(id json.RawMessage, result interface{}, err *lspError) {
+	msg := &lspMessage{ID: &id, Error: err}
+	if err == nil {
+		msg.Result = lspResult{result}
+	}
+	ls.write(msg)
+}
+
+func (ls *lspServer) notify(method string, params interface{}) {
+	p, err := json.Marshal(params)
+	if err != nil {
+		ls.ag.Log.Println("lsp.notify:", err)
+		return
+	}
+	ls.write(&lspMessage{Method: method, Params: p})
+}
+
+func (ls *lspServer) write(msg *lspMessage) {
+	ls.wmu.Lock()
+	defer ls.wmu.Unlock()
+
+	if err := lspWriteMessage(ls.wr, msg); err != nil {
+		ls.ag.Log.Println("lsp.write failed. shutting down ipc:", err)
+		go ls.ag.shutdown()
+	}
+}
+
+// lspResult wraps a result to ensure that a nil result is encoded as `null`
+// instead of being omitted
+type lspResult struct{ v interface{} }
+
+func (r lspResult) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.v)
+}
+
+func lspReadMessage(r *bufio.Reader) (*lspMessage, error) {
+	hdr, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+	n, err := strconv.Atoi(hdr.Get("Content-Length"))
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid Content-Length: %q", hdr.Get("Content-Length"))
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	msg := &lspMessage{}
+	if err := json.Unmarshal(body, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func lspWriteMessage(w io.Writer, msg *lspMessage) error {
+	msg.JSONRPC = "2.0"
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "Content-Length: %d\r\n\r\n", len(body))
+	buf.Write(body)
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+func lspURIPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	p := u.Path
+	// Windows paths are in the form /C:/path
+	if len(p) >= 3 && p[0] == '/' && p[2] == ':' {
+		p = p[1:]
+	}
+	return filepath.FromSlash(p)
+}
+
+func lspPathURI(fn string) string {
+	p := filepath.ToSlash(fn)
+	// the path must be absolute i.e. Windows paths like C:/path are written as /C:/path
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	u := url.URL{Scheme: "file", Path: p}
+	return u.String()
+}
+
+// lspLine returns the content of line row in src, without the trailing newline
+func lspLine(src []byte, row int) []byte {
+	for ; row > 0; row-- {
+		i := bytes.IndexByte(src, '\n')
+		if i < 0 {
+			return nil
+		}
+		src = src[i+1:]
+	}
+	if i := bytes.IndexByte(src, '\n'); i >= 0 {
+		src = src[:i]
+	}
+	return src
+}
+
+// lspOffset converts the LSP (UTF-16 based) position pos into a byte offset in src
+func lspOffset(src []byte, pos lspPosition) int {
+	off := 0
+	for row := pos.Line; row > 0; row-- {
+		i := bytes.IndexByte(src[off:], '\n')
+		if i < 0 {
+			return len(src)
+		}
+		off += i + 1
+	}
+	return off + lspByteCol(lspLine(src[off:], 0), pos.Character)
+}
+
+// lspSignatureHelp converts sh into an LSP SignatureHelp
+func lspSignatureHelp(sh *SignatureHelp) map[string]interface{} {
+	field := func(p SignatureParam) string {
+		if p.Name == "" {
+			return p.Type
+		}
+		return p.Name + " " + p.Type
+	}
+	params := make([]interface{}, len(sh.Params))
+	label := &strings.Builder{}
+	label.WriteString(sh.Name)
+	label.WriteByte('(')
+	for i, p := range sh.Params {
+		if i > 0 {
+			label.WriteString(", ")
+		}
+		label.WriteString(field(p))
+		params[i] = map[string]string{"label": field(p)}
+	}
+	label.WriteByte(')')
+	switch n := len(sh.Results); {
+	case n == 1 && sh.Results[0].Name == "":
+		label.WriteString(" " + sh.Results[0].Type)
+	case n != 0:
+		l := make([]string, n)
+		for i, p := range sh.Results {
+			l[i] = field(p)
+		}
+		label.WriteString(" (" + strings.Join(l, ", ") + ")")
+	}
+	sig := map[string]interface{}{
+		"label":      label.String(),
+		"parameters": params,
+	}
+	if sh.Doc != "" {
+		sig["documentation"] = sh.Doc
+	}
+	return map[string]interface{}{
+		"signatures":      []interface{}{sig},
+		"activeSignature": 0,
+		"activeParameter": sh.ActiveParam,
+	}
+}
+
+// lspDocumentSymbols converts the outline items into a list of LSP DocumentSymbols
+func lspDocumentSymbols(src []byte, items []OutlineItem) []interface{} {
+	rowColPos := func(row, col int) lspPosition {
+		return lspPosition{Line: row, Character: lspCharCol(lspLine(src, row), col)}
+	}
+	l := make([]interface{}, len(items))
+	for i, it := range items {
+		// methods of types declared in other files are named e.g. `T.Method`
+		name := it.Name[strings.LastIndexByte(it.Name, '.')+1:]
+		start := rowColPos(it.Row, it.Col)
+		sel := lspRange{Start: start, End: rowColPos(it.Row, it.Col+len(name))}
+		sym := map[string]interface{}{
+			"name":           it.Name,
+			"kind":           lspSymbolKind(it),
+			"range":          lspRange{Start: start, End: rowColPos(it.EndRow, it.EndCol)},
+			"selectionRange": sel,
+			"children":       lspDocumentSymbols(src, it.Children),
+		}
+		if it.Detail != "" {
+			sym["detail"] = it.Detail
+		}
+		l[i] = sym
+	}
+	return l
+}
+
+func lspSymbolKind(it OutlineItem) int {
+	switch it.Kind {
+	case "func":
+		return 12
+	case "method":
+		return 6
+	case "field":
+		return 8
+	case "var":
+		return 13
+	case "const":
+		return 14
+	case "type":
+		switch it.Detail {
+		case "struct":
+			return 23
+		case "interface":
+			return 11
+		}
+		return 5
+	default:
+		return 13
+	}
+}
+
+// lspTokenTypes is the legend of LSP token types, indexed by SemanticTokenKind.
+// Fields are called properties, and constants are readonly variables.
+var lspTokenTypes = []string{
+	NamespaceToken: "namespace",
+	TypeToken:      "type",
+	FunctionToken:  "function",
+	MethodToken:    "method",
+	VariableToken:  "variable",
+	ParameterToken: "parameter",
+	FieldToken:     "property",
+	ConstantToken:  "variable",
+	LabelToken:     "label",
+}
+
+// lspSemanticTokens encodes toks in the LSP format i.e. 5 ints for each token:
+// the line and (UTF-16) start character relative to the previous token, the length, type and modifiers
+func lspSemanticTokens(src []byte, toks []SemanticToken) []int {
+	data := make([]int, 0, len(toks)*5)
+	prevRow, prevChar := 0, 0
+	for _, t := range toks {
+		line := lspLine(src, t.Row)
+		char := lspCharCol(line, t.Col)
+		n := lspCharCol(line, t.Col+t.Len) - char
+		kind := t.Kind
+		if kind == ConstantToken {
+			kind = VariableToken
+		}
+		if t.Row != prevRow {
+			prevChar = 0
+		}
+		data = append(data, t.Row-prevRow, char-prevChar, n, int(kind), int(t.Mods))
+		prevRow, prevChar = t.Row, char
+	}
+	return data
+}
+
+func lspIsWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// lspPos converts the byte offset off in src into an LSP position
+func lspPos(src []byte, off int) lspPosition {
+	if off > len(src) {
+		off = len(src)
+	}
+	s := src[:off]
+	row := bytes.Count(s, []byte{'\n'})
+	bol := bytes.LastIndexByte(s, '\n') + 1
+	return lspPosition{Line: row, Character: lspCharCol(s[bol:], len(s)-bol)}
+}
+
+// lspEditRange converts the range replaced by te in src into an LSP range
+func lspEditRange(src []byte, te TextEdit) lspRange {
+	return lspRange{
+		Start: lspPosition{Line: te.Row, Character: lspCharCol(lspLine(src, te.Row), te.Col)},
+		End:   lspPosition{Line: te.EndRow, Character: lspCharCol(lspLine(src, te.EndRow), te.EndCol)},
+	}
+}
+
+// lspByteCol converts the UTF-16 column char in line into a byte column
+func lspByteCol(line []byte, char int) int {
+	col := 0
+	for col < len(line) && char > 0 {
+		r, n := utf8.DecodeRune(line[col:])
+		char -= len(utf16.Encode([]rune{r}))
+		col += n
+	}
+	return col
+}
+
+// lspCharCol converts the byte column col in line into a UTF-16 column
+func lspCharCol(line []byte, col int) int {
+	if col > len(line) {
+		col = len(line)
+	}
+	char := 0
+	for _, r := range string(line[:col]) {
+		char += len(utf16.Encode([]rune{r}))
+	}
+	return char
+}
+
+func lspSeverity(tag IssueTag) int {
+	switch tag {
+	case Warning:
+		return 2
+	case Notice:
+		return 3
+	default:
+		return 1
+	}
+}
+
+func lspCompletionKind(tag CompletionTag) int {
+	switch tag {
+	case SnippetTag:
+		return 15
+	case VariableTag:
+		return 6
+	case TypeTag:
+		return 7
+	case ConstantTag:
+		return 21
+	case FunctionTag:
+		return 3
+	case PackageTag:
+		return 9
+	default:
+		return 1
+	}
+}
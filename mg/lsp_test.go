@@ -0,0 +1,240 @@
+package mg
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"margo.sh/mgutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLSPMessageFraming(t *testing.T) {
+	buf := &bytes.Buffer{}
+	id := json.RawMessage(`1`)
+	err := lspWriteMessage(buf, &lspMessage{ID: &id, Method: "initialize", Params: json.RawMessage(`{}`)})
+	if err != nil {
+		t.Fatalf("lspWriteMessage: %s", err)
+	}
+	if s := buf.String(); !strings.HasPrefix(s, "Content-Length: ") {
+		t.Fatalf("message `%s` has no Content-Length header", s)
+	}
+
+	msg, err := lspReadMessage(bufio.NewReader(buf))
+	if err != nil {
+		t.Fatalf("lspReadMessage: %s", err)
+	}
+	if msg.JSONRPC != "2.0" || msg.Method != "initialize" || msg.ID == nil || string(*msg.ID) != "1" {
+		t.Errorf("lspReadMessage returned %+v, want an initialize request with id 1", msg)
+	}
+
+	if _, err := lspReadMessage(bufio.NewReader(buf)); err != io.EOF {
+		t.Errorf("lspReadMessage at EOF returned error `%v`, want `%v`", err, io.EOF)
+	}
+}
+
+func TestLSPPositions(t *testing.T) {
+	src := []byte("package p\n\nvar s = \"𝄞x\"\n")
+	cases := []struct {
+		pos lspPosition
+		off int
+	}{
+		{lspPosition{Line: 0, Character: 0}, 0},
+		{lspPosition{Line: 0, Character: 7}, 7},
+		{lspPosition{Line: 2, Character: 9}, 20},
+		// 𝄞 is 2 UTF-16 code units and 4 bytes
+		{lspPosition{Line: 2, Character: 11}, 24},
+		{lspPosition{Line: 2, Character: 12}, 25},
+	}
+	for _, c := range cases {
+		if off := lspOffset(src, c.pos); off != c.off {
+			t.Errorf("lspOffset(%+v) = %d, want %d", c.pos, off, c.off)
+		}
+		if pos := lspPos(src, c.off); pos != c.pos {
+			t.Errorf("lspPos(%d) = %+v, want %+v", c.off, pos, c.pos)
+		}
+	}
+}
+
+func TestLSPEditRange(t *testing.T) {
+	src := []byte("package p\n\nvar s = \"𝄞x\"\n")
+	te := NewTextEdit(src, 20, 25, "")
+	want := lspRange{Start: lspPosition{Line: 2, Character: 9}, End: lspPosition{Line: 2, Character: 12}}
+	if rng := lspEditRange(src, te); rng != want {
+		t.Errorf("lspEditRange(%+v) = %+v, want %+v", te, rng, want)
+	}
+}
+
+func TestLSPInitialize(t *testing.T) {
+	in := &bytes.Buffer{}
+	for i, method := range []string{"initialize", "shutdown"} {
+		id := json.RawMessage{byte('1' + i)}
+		lspWriteMessage(in, &lspMessage{ID: &id, Method: method})
+	}
+	lspWriteMessage(in, &lspMessage{Method: "exit"})
+
+	out := &bytes.Buffer{}
+	ag, err := NewAgent(AgentConfig{
+		Protocol: LSPProtocol,
+		Stdin:    ioutil.NopCloser(in),
+		Stdout:   &mgutil.IOWrapper{Writer: out},
+		Stderr:   ioutil.Discard,
+	})
+	if err != nil {
+		t.Fatalf("agent creation failed: %s", err)
+	}
+	if err := ag.Run(); err != nil {
+		t.Fatalf("agent failed: %s", err)
+	}
+
+	raw := out.String()
+	rd := bufio.NewReader(out)
+	res, err := lspReadMessage(rd)
+	if err != nil {
+		t.Fatalf("cannot read initialize response: %s", err)
+	}
+	v := struct {
+		Result struct {
+			Capabilities map[string]interface{}
+		}
+	}{}
+	s, _ := json.Marshal(res)
+	json.Unmarshal(s, &v)
+	if v.Result.Capabilities["completionProvider"] == nil {
+		t.Errorf("initialize response `%s` doesn't advertise completion support", s)
+	}
+
+	if _, err := lspReadMessage(rd); err != nil {
+		t.Fatalf("cannot read shutdown response: %s", err)
+	}
+	if !strings.Contains(raw, `"id":2,"result":null`) {
+		t.Errorf("shutdown response in `%s` has no null result", raw)
+	}
+}
+
+func TestLSPInitializeClientInfo(t *testing.T) {
+	ag, err := NewAgent(AgentConfig{
+		Protocol: LSPProtocol,
+		Stdin:    ioutil.NopCloser(&bytes.Buffer{}),
+		Stdout:   &mgutil.IOWrapper{Writer: &bytes.Buffer{}},
+		Stderr:   ioutil.Discard,
+	})
+	if err != nil {
+		t.Fatalf("agent creation failed: %s", err)
+	}
+	ls := ag.lsp
+	id := json.RawMessage(`1`)
+	params := json.RawMessage(`{"clientInfo":{"name":"Visual Studio Code","version":"1.80.0"}}`)
+	if err := ls.initialize(id, params); err != nil {
+		t.Fatalf("initialize failed: %s", err)
+	}
+
+	ep := ls.editor
+	if ep.Name != "Visual Studio Code" || ep.Version != "1.80.0" {
+		t.Errorf("editor is %s %s, want the client's name and version", ep.Name, ep.Version)
+	}
+	if !ep.ReplaceCompletions() {
+		t.Errorf("ReplaceCompletions() = false for LSP client %s", ep.Name)
+	}
+}
+
+func TestLSPSignatureHelp(t *testing.T) {
+	sh := &SignatureHelp{
+		Name: "Printf",
+		Params: []SignatureParam{
+			{Name: "format", Type: "string"},
+			{Name: "a", Type: "...interface{}"},
+		},
+		Results: []SignatureParam{
+			{Name: "n", Type: "int"},
+			{Name: "err", Type: "error"},
+		},
+		Variadic:    true,
+		ActiveParam: 1,
+	}
+	res := lspSignatureHelp(sh)
+	sig := res["signatures"].([]interface{})[0].(map[string]interface{})
+	label := sig["label"].(string)
+	if want := "Printf(format string, a ...interface{}) (n int, err error)"; label != want {
+		t.Errorf("label is `%s`, expected `%s`", label, want)
+	}
+	for _, p := range sig["parameters"].([]interface{}) {
+		if s := p.(map[string]string)["label"]; !strings.Contains(label, s) {
+			t.Errorf("parameter label `%s` is not a substring of `%s`", s, label)
+		}
+	}
+	if n := res["activeParameter"]; n != 1 {
+		t.Errorf("activeParameter is %v, expected 1", n)
+	}
+}
+
+func TestLSPSemanticTokens(t *testing.T) {
+	src := []byte("var x = \"é\" + y\nconst z = x\n")
+	toks := []SemanticToken{
+		{Row: 0, Col: 4, Len: 1, Kind: VariableToken, Mods: DeclarationMod},
+		{Row: 0, Col: 15, Len: 1, Kind: VariableToken},
+		{Row: 1, Col: 6, Len: 1, Kind: ConstantToken, Mods: DeclarationMod | ReadonlyMod},
+		{Row: 1, Col: 10, Len: 1, Kind: VariableToken},
+	}
+	got := fmt.Sprint(lspSemanticTokens(src, toks))
+	want := fmt.Sprint([]int{
+		0, 4, 1, int(VariableToken), int(DeclarationMod),
+		0, 10, 1, int(VariableToken), 0,
+		1, 6, 1, int(VariableToken), int(DeclarationMod | ReadonlyMod),
+		0, 4, 1, int(VariableToken), 0,
+	})
+	if got != want {
+		t.Errorf("lspSemanticTokens() = %s, expected %s", got, want)
+	}
+}
+
+func TestLSPPathURI(t *testing.T) {
+	cases := []struct {
+		path, uri string
+	}{
+		{"/home/a/b c.go", "file:///home/a/b%20c.go"},
+		{"C:/a/b.go", "file:///C:/a/b.go"},
+	}
+	for _, c := range cases {
+		if uri := lspPathURI(c.path); uri != c.uri {
+			t.Errorf("lspPathURI(%q) = %q, want %q", c.path, uri, c.uri)
+		}
+		if fn := lspURIPath(c.uri); filepath.ToSlash(fn) != c.path {
+			t.Errorf("lspURIPath(%q) = %q, want %q", c.uri, fn, c.path)
+		}
+	}
+}
+
+func TestLSPResolveDefs(t *testing.T) {
+	out := &bytes.Buffer{}
+	ls := &lspServer{wr: out}
+	ls.defs = []lspPending{
+		{ID: json.RawMessage(`1`), Cookie: "lsp:1", Fd: "lsp.definition#1"},
+		{ID: json.RawMessage(`2`), Cookie: "lsp:2", Fd: "lsp.definition#2"},
+	}
+	// the second request is resolved first
+	st := (&State{}).addClientActions(Activate{Path: "/a.go", Cookie: "lsp:2"})
+	ls.resolveDefs(st)
+	if len(ls.defs) != 1 || string(ls.defs[0].ID) != "1" {
+		t.Fatalf("after resolving lsp:2, the pending requests are %+v, want request 1", ls.defs)
+	}
+	if s := out.String(); !strings.Contains(s, `"id":2,"result":{`) || !strings.Contains(s, "file:///a.go") {
+		t.Errorf("request 2 wasn't answered with the location of /a.go: %s", s)
+	}
+
+	// an Activate without a cookie e.g. from the outline, doesn't resolve anything
+	ls.resolveDefs((&State{}).addClientActions(Activate{Path: "/b.go"}))
+	if len(ls.defs) != 1 {
+		t.Fatalf("an Activate without a cookie resolved a definition request")
+	}
+
+	out.Reset()
+	ls.resolveDefs((&State{}).addClientActions(CmdOutput{Fd: "lsp.definition#1", Close: true}))
+	if len(ls.defs) != 0 || !strings.Contains(out.String(), `"id":1,"result":null`) {
+		t.Errorf("closing the output of request 1 didn't answer it with null: %s", out.String())
+	}
+}
@@ -1,5 +1,19 @@
 package mg
 
+import (
+	"sync/atomic"
+)
+
 const (
 	DefaultMemoryLimit = 2 << 30
 )
+
+var (
+	// memoryLimit is the limit set by SetMemoryLimit, it's accessed atomically
+	memoryLimit uint64
+)
+
+// MemoryLimit returns the memory limit set by SetMemoryLimit, or 0 if no limit was set
+func MemoryLimit() uint64 {
+	return atomic.LoadUint64(&memoryLimit)
+}
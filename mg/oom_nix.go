@@ -3,6 +3,7 @@
 package mg
 
 import (
+	"sync/atomic"
 	"syscall"
 )
 
@@ -22,5 +23,6 @@ func SetMemoryLimit(logs interface {
 	}
 	// re-read it so we see what it was actually set to
 	syscall.Getrlimit(syscall.RLIMIT_DATA, rlim)
+	atomic.StoreUint64(&memoryLimit, rlim.Cur)
 	logs.Printf("SetMemoryLimit: limit=%dMiB, RLIMIT_DATA={Cur: %dMiB, Max:%dMiB}\n", mib, rlim.Cur/(1<<20), rlim.Max/(1<<20))
 }
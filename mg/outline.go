@@ -0,0 +1,35 @@
+package mg
+
+// OutlineItem is a declaration in the outline of a view
+type OutlineItem struct {
+	// Name is the name of the declaration
+	Name string
+
+	// Kind is the kind of declaration e.g. `func`, `method`, `type`, `field`, `var` or `const`
+	Kind string
+
+	// Detail is a short description of the declaration e.g. its type or signature
+	Detail string
+
+	// Row and Col are the (0-based) position of the name
+	Row int
+	Col int
+
+	// EndRow and EndCol are the (0-based) position of the end of the declaration
+	EndRow int
+	EndCol int
+
+	// Children is the list of declarations nested inside this one
+	// e.g. the fields and methods of a type
+	Children []OutlineItem
+}
+
+// QueryOutline is dispatched by the client to request State.Outline
+type QueryOutline struct{ ActionType }
+
+// SetOutline sets State.Outline to l
+func (st *State) SetOutline(l []OutlineItem) *State {
+	return st.Copy(func(st *State) {
+		st.Outline = l
+	})
+}
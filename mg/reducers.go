@@ -20,6 +20,7 @@ var (
 			Builtins,
 		},
 		after: reducerList{
+			&issueFixSupport{},
 			&issueStatusSupport{},
 			&cmdSupport{},
 			&restartSupport{},
@@ -118,6 +119,7 @@ type Reducer interface {
 	// If a reducer is slow it might block the editor UI because some actions like
 	// fmt'ing the view must wait for the new src before the user
 	// can continue editing or saving the file.
+	// Reducers that exceed their time budget are reported by a watchdog, see WatchdogConfig.
 	//
 	// e.g. during the ViewFmt or ViewPreSave action, a reducer that knows how to
 	// fmt the file might update the state to hold a fmt'd copy of the view's src.
@@ -234,7 +236,15 @@ func (rt *ReducerType) bootstrap(parent Reducer) {
 func (rt *ReducerType) reduction(mx *Ctx, r Reducer) *Ctx {
 	rt.bootstrap(r)
 
-	defer mx.Profile.Push(ReducerLabel(r)).Pop()
+	lbl := ReducerLabel(r)
+	defer mx.Profile.Push(lbl).Pop()
+
+	// disabled reducers must still be unmounted
+	wd := mx.watchdog()
+	if wd.disabled(rt) && !mx.ActionIs(unmount{}) {
+		return mx
+	}
+	defer wd.watch(mx, r, lbl)()
 
 	rt.init(mx)
 
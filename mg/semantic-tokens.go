@@ -0,0 +1,137 @@
+package mg
+
+// SemanticTokenKind is the kind of identifier a SemanticToken refers to
+type SemanticTokenKind int
+
+const (
+	NamespaceToken SemanticTokenKind = iota
+	TypeToken
+	FunctionToken
+	MethodToken
+	VariableToken
+	ParameterToken
+	FieldToken
+	ConstantToken
+	LabelToken
+)
+
+// SemanticTokenKinds is the list of SemanticTokenKind names, indexed by kind
+var SemanticTokenKinds = []string{
+	NamespaceToken: "namespace",
+	TypeToken:      "type",
+	FunctionToken:  "function",
+	MethodToken:    "method",
+	VariableToken:  "variable",
+	ParameterToken: "parameter",
+	FieldToken:     "field",
+	ConstantToken:  "constant",
+	LabelToken:     "label",
+}
+
+func (k SemanticTokenKind) String() string {
+	if k >= 0 && int(k) < len(SemanticTokenKinds) {
+		return SemanticTokenKinds[k]
+	}
+	return "unknown"
+}
+
+// SemanticTokenMods is a set of SemanticToken modifiers
+type SemanticTokenMods uint
+
+const (
+	// DeclarationMod is set where the identifier is declared
+	DeclarationMod SemanticTokenMods = 1 << iota
+	// ReadonlyMod is set for constants
+	ReadonlyMod
+	// DeprecatedMod is set if the declaration's doc comment has a `Deprecated:` paragraph
+	DeprecatedMod
+	// UnusedMod is set for local variables that are declared but never used
+	UnusedMod
+	// LocalMod is set for identifiers that are declared inside a function
+	LocalMod
+)
+
+// SemanticTokenModNames is the list of SemanticTokenMods names, indexed by bit
+var SemanticTokenModNames = []string{
+	"declaration",
+	"readonly",
+	"deprecated",
+	"unused",
+	"local",
+}
+
+// Is returns true if all the modifiers in m are set
+func (mods SemanticTokenMods) Is(m SemanticTokenMods) bool {
+	return mods&m == m
+}
+
+// SemanticToken is the kind and modifiers of an identifier in a view
+type SemanticToken struct {
+	// Row and Col are the (0-based) position of the identifier
+	Row int
+	Col int
+	// Len is the length of the identifier in bytes
+	Len  int
+	Kind SemanticTokenKind
+	Mods SemanticTokenMods
+}
+
+// SemanticTokens holds the semantic tokens of a view in a compact form
+type SemanticTokens struct {
+	// Path and Name identify the view and Hash is the hash of the src the tokens refer to.
+	// Clients should ignore the tokens if the view has changed since.
+	Path string
+	Name string
+	Hash string
+
+	// Kinds and Mods are the names of the token kinds and modifier bits, used to decode Data
+	Kinds []string
+	Mods  []string
+
+	// Data holds 5 ints for each token: row, col, length, kind and modifiers
+	Data []int
+}
+
+// NewSemanticTokens returns the SemanticTokens of view v
+func NewSemanticTokens(v *View, l []SemanticToken) *SemanticTokens {
+	st := &SemanticTokens{
+		Path:  v.Path,
+		Name:  v.Name,
+		Hash:  v.Hash,
+		Kinds: SemanticTokenKinds,
+		Mods:  SemanticTokenModNames,
+		Data:  make([]int, 0, len(l)*5),
+	}
+	for _, t := range l {
+		st.Data = append(st.Data, t.Row, t.Col, t.Len, int(t.Kind), int(t.Mods))
+	}
+	return st
+}
+
+// Tokens decodes the list of tokens from Data
+func (st *SemanticTokens) Tokens() []SemanticToken {
+	l := make([]SemanticToken, 0, len(st.Data)/5)
+	for d := st.Data; len(d) >= 5; d = d[5:] {
+		l = append(l, SemanticToken{
+			Row:  d[0],
+			Col:  d[1],
+			Len:  d[2],
+			Kind: SemanticTokenKind(d[3]),
+			Mods: SemanticTokenMods(d[4]),
+		})
+	}
+	return l
+}
+
+// QuerySemanticTokens is dispatched by the client to request State.SemanticTokens
+type QuerySemanticTokens struct{ ActionType }
+
+// SetSemanticTokens sets State.SemanticTokens to toks
+func (st *State) SetSemanticTokens(toks *SemanticTokens) *State {
+	if st.SemanticTokens == toks {
+		return st
+	}
+	return st.Copy(func(st *State) {
+		st.SemanticTokens = toks
+	})
+}
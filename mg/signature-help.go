@@ -0,0 +1,49 @@
+package mg
+
+// SignatureHelp describes the signature of the function being called at the cursor
+type SignatureHelp struct {
+	// Name is the name of the function or method, it's empty if the function is not named
+	// e.g. when calling the result of another call
+	Name string
+
+	// Recv is the receiver type of a method e.g. `*bytes.Buffer`
+	Recv string
+
+	// Params is the list of parameters
+	Params []SignatureParam
+
+	// Results is the list of results
+	Results []SignatureParam
+
+	// Variadic is true if the last parameter is variadic
+	Variadic bool
+
+	// ActiveParam is the index in Params of the parameter at the cursor, or -1
+	ActiveParam int
+
+	// Doc is the doc comment of the function
+	Doc string
+}
+
+// SignatureParam is a function parameter or result
+type SignatureParam struct {
+	// Name is the name of the parameter, it may be empty
+	Name string
+
+	// Type is the type of the parameter.
+	// For variadic parameters, it includes the `...` prefix e.g. `...interface{}`
+	Type string
+}
+
+// QuerySignatureHelp is dispatched by the client to request State.SignatureHelp at the cursor
+type QuerySignatureHelp struct{ ActionType }
+
+// SetSignatureHelp sets State.SignatureHelp to sh
+func (st *State) SetSignatureHelp(sh *SignatureHelp) *State {
+	if st.SignatureHelp == sh {
+		return st
+	}
+	return st.Copy(func(st *State) {
+		st.SignatureHelp = sh
+	})
+}
@@ -33,6 +33,10 @@ type EditorProps struct {
 	// Client hold details about client (the editor plugin)
 	Client EditorClientProps
 
+	// Protocol is the IPC protocol used to communicate with the editor e.g. LSPProtocol.
+	// It's set by the agent, and unlike Name, it's not changed by the editor.
+	Protocol string
+
 	handle   codec.Handle `mg.Nillable:"true"`
 	settings codec.Raw
 }
@@ -46,6 +50,14 @@ func (ep *EditorProps) Ready() bool {
 	return ep.Name != ""
 }
 
+// ReplaceCompletions returns true if the editor honours Completion.Replace and Completion.Edits.
+//
+// Completions that rely on them e.g. postfix completions should not be offered to other editors,
+// where they'd be inserted at the cursor instead.
+func (ep *EditorProps) ReplaceCompletions() bool {
+	return ep.Protocol == LSPProtocol
+}
+
 // Settings unmarshals the internal settings sent from the editor into v.
 // If no settings were sent, it returns ErrNoSettings,
 // otherwise it returns any error from unmarshalling.
@@ -140,6 +152,16 @@ type State struct {
 	// HUD contains information to the displayed to the user
 	HUD HUDState
 
+	// SignatureHelp describes the function being called at the cursor, if any
+	SignatureHelp *SignatureHelp `mg.Nillable:"true"`
+
+	// Outline is the hierarchical list of declarations in the current view
+	Outline []OutlineItem
+
+	// SemanticTokens holds the kinds of the identifiers in the view.
+	// It's only set when the tokens change, so clients should keep the last tokens they received.
+	SemanticTokens *SemanticTokens `mg.Nillable:"true"`
+
 	// clientActions is a list of client actions to dispatch in the editor
 	clientActions []actions.ClientData
 }
@@ -52,22 +52,30 @@ type Store struct {
 	// NOTE: it's not safe to store values with *Ctx objects here; use *Ctx.KVMap instead
 	KVMap
 
-	mu       sync.Mutex
-	state    *State
-	subs     []*struct{ Subscriber }
-	sub      Subscriber
-	reducers struct {
-		sync.Mutex
-		storeReducers
-	}
-	cfg   EditorConfig `mg.Nillable:"true"`
+	*storeCore
+
+	mu    sync.Mutex
+	state *State
+	subs  []*struct{ Subscriber }
+	sub   Subscriber
 	ag    *Agent
-	tasks *taskTracker
+	views viewRegistry
 	cache struct {
 		sync.RWMutex
 		vName string
 		vHash string
 	}
+}
+
+// storeCore is the part of the Store that's shared with the stores of the agent's daemon clients
+type storeCore struct {
+	reducers struct {
+		sync.Mutex
+		storeReducers
+	}
+	cfg   EditorConfig `mg.Nillable:"true"`
+	tasks *taskTracker
+	wdog  *reducerWatchdog
 
 	dsp struct {
 		sync.RWMutex
@@ -135,6 +143,7 @@ func (sto *Store) nextDispatcher() dispatchHandler {
 
 func (sto *Store) dispatcher() {
 	sto.ag.Log.Println("started")
+	sto.wdog.setGoroutine()
 	sto.handleAct(initAction{}, nil)
 
 	for {
@@ -217,6 +226,7 @@ func (sto *Store) handleReqInit(rq *agentReq, mx *Ctx) *Ctx {
 		mx.View = v
 		sto.initCache(v)
 		v.finalize()
+		sto.views.observe(v)
 	}
 	if len(props.Env) != 0 {
 		mx.Env = props.Env
@@ -252,14 +262,16 @@ func (sto *Store) NewCtx(act Action) *Ctx {
 
 func newStore(ag *Agent, sub Subscriber) *Store {
 	sto := &Store{
-		sub: sub,
-		ag:  ag,
+		storeCore: &storeCore{},
+		sub:       sub,
+		ag:        ag,
 	}
 	sto.state = &State{
 		StickyState: StickyState{View: newView(sto)},
 	}
 	sto.tasks = &taskTracker{}
-	sto.After(sto.tasks)
+	sto.wdog = newReducerWatchdog()
+	sto.After(sto.tasks, sto.wdog)
 
 	// 640 slots ought to be enough for anybody
 	sto.dsp.lo = make(chan dispatchHandler, 640)
@@ -268,6 +280,22 @@ func newStore(ag *Agent, sub Subscriber) *Store {
 	return sto
 }
 
+// newClientStore returns a new Store for the daemon client ag.
+//
+// It shares its reducers, tasks, config and dispatcher with sto,
+// but has its own state, subscribers and KVMap,
+// so reductions, including those of the actions it dispatches, are only seen by the client.
+func (sto *Store) newClientStore(ag *Agent) *Store {
+	cs := &Store{
+		storeCore: sto.storeCore,
+		ag:        ag,
+	}
+	cs.state = &State{
+		StickyState: StickyState{View: newView(cs)},
+	}
+	return cs
+}
+
 // Subscribe arranges for sub to be called after each reduction takes place
 // the function returned can be used to unsubscribe from further notifications
 func (sto *Store) Subscribe(sub Subscriber) (unsubscribe func()) {
@@ -336,6 +364,12 @@ func (sto *Store) SetBaseConfig(cfg EditorConfig) *Store {
 	return sto
 }
 
+// SetWatchdogConfig sets the configuration of the watchdog that enforces the time budget of reducers
+func (sto *Store) SetWatchdogConfig(cfg WatchdogConfig) *Store {
+	sto.wdog.setConfig(cfg)
+	return sto
+}
+
 // Begin starts a new task and returns its ticket
 func (sto *Store) Begin(t Task) *TaskTicket {
 	return sto.tasks.Begin(t)
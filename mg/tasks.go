@@ -85,6 +85,14 @@ func (tr *taskTracker) Reduce(mx *Ctx) *State {
 	return st
 }
 
+// active returns the number of tasks that haven't finished
+func (tr *taskTracker) active() int {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	return len(tr.tickets)
+}
+
 func (tr *taskTracker) resetTimer() {
 	d := 1 * time.Second
 	if tr.timer == nil {
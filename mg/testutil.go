@@ -51,3 +51,10 @@ func NewTestingStore() *Store {
 func NewTestingCtx(act Action) *Ctx {
 	return NewTestingStore().NewCtx(act)
 }
+
+// ObserveTestingView records the state of v as if the client had sent it in a request
+//
+// It's used to make Ctx.ViewIsDirty aware of views other than Ctx.View
+func (sto *Store) ObserveTestingView(v *View) {
+	sto.views.observe(v)
+}
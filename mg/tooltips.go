@@ -1,5 +1,9 @@
 package mg
 
 type Tooltip struct {
+	// Content is the content of the tooltip as plain text or Markdown
 	Content string
+
+	// HTML, if set, is the content rendered as HTML, for editors that can display it
+	HTML string
 }
@@ -3,16 +3,172 @@ package mg
 import (
 	"fmt"
 	hmnz "github.com/dustin/go-humanize"
+	"margo.sh/mgutil"
 	"margo.sh/vfs"
 	"path/filepath"
+	"runtime"
+	"runtime/debug"
 	"strings"
+	"sync"
+	"time"
 )
 
 var (
 	VFS = vfs.New()
+
+	vfsCmdR = &vfsCmd{}
 )
 
-type vfsCmd struct{ ReducerType }
+// VFSTrim configures the trimming of the VFS.
+//
+// The VFS caches file contents and data derived from them, e.g. parsed packages,
+// so it grows as more files are opened. It's trimmed periodically by removing the
+// least-recently-used leaf nodes and cached values until it's within MaxNodes and MaxMemos.
+// If the memory usage approaches the limit set by SetMemoryLimit, it's trimmed to half its size.
+//
+// Trimming is enabled by default with the defaults documented below,
+// this reducer only changes its configuration. Set NoAutoTrim to disable it.
+// The command `.vfs-trim` trims the VFS manually, even if NoAutoTrim is set.
+type VFSTrim struct {
+	ReducerType
+
+	// NoAutoTrim disables the periodic trimming.
+	NoAutoTrim bool
+
+	// MaxNodes is the number of nodes (files and directories) to keep. The default is 200,000.
+	MaxNodes int
+
+	// MaxMemos is the number of cached values to keep. The default is 20,000.
+	MaxMemos int
+
+	// MinIdle is the time for which a node or value must be unused before it's removed.
+	// It's ignored when memory usage approaches the limit. The default is 5m.
+	MinIdle time.Duration
+
+	// MemoryThreshold is the fraction of the memory limit above which the VFS is trimmed to half its size.
+	// The default is 0.8.
+	MemoryThreshold float64
+
+	// Interval is the time between checks. The default is 1m.
+	Interval time.Duration
+}
+
+func (vt *VFSTrim) RInit(mx *Ctx) {
+	vfsCmdR.configure(*vt)
+}
+
+func (vt *VFSTrim) Reduce(mx *Ctx) *State {
+	return mx.State
+}
+
+func (vt VFSTrim) defaults() VFSTrim {
+	if vt.MaxNodes <= 0 {
+		vt.MaxNodes = 200000
+	}
+	if vt.MaxMemos <= 0 {
+		vt.MaxMemos = 20000
+	}
+	if vt.MinIdle <= 0 {
+		vt.MinIdle = 5 * time.Minute
+	}
+	if vt.MemoryThreshold <= 0 || vt.MemoryThreshold > 1 {
+		vt.MemoryThreshold = 0.8
+	}
+	if vt.Interval <= 0 {
+		vt.Interval = 1 * time.Minute
+	}
+	return vt
+}
+
+func (vt VFSTrim) opts() vfs.TrimOptions {
+	return vfs.TrimOptions{
+		MaxNodes: vt.MaxNodes,
+		MaxMemos: vt.MaxMemos,
+		MinIdle:  vt.MinIdle,
+	}
+}
+
+type vfsCmd struct {
+	ReducerType
+
+	mu   sync.Mutex
+	cfg  VFSTrim
+	done chan struct{}
+}
+
+func (vc *vfsCmd) configure(c VFSTrim) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	vc.cfg = c
+}
+
+func (vc *vfsCmd) config() VFSTrim {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	return vc.cfg.defaults()
+}
+
+func (vc *vfsCmd) RMount(mx *Ctx) {
+	vc.done = make(chan struct{})
+	go vc.trimLoop(mx)
+}
+
+func (vc *vfsCmd) RUnmount(mx *Ctx) {
+	close(vc.done)
+}
+
+func (vc *vfsCmd) trimLoop(mx *Ctx) {
+	for {
+		select {
+		case <-vc.done:
+			return
+		case <-time.After(vc.config().Interval):
+			if !vc.config().NoAutoTrim {
+				vc.autoTrim(mx)
+			}
+		}
+	}
+}
+
+// autoTrim trims the VFS to the configured size,
+// or to half its size if the memory usage is close to the limit set by SetMemoryLimit
+func (vc *vfsCmd) autoTrim(mx *Ctx) {
+	cfg := vc.config()
+	opts := cfg.opts()
+
+	ms := runtime.MemStats{}
+	runtime.ReadMemStats(&ms)
+	lim := MemoryLimit()
+	pressure := lim > 0 && float64(ms.HeapAlloc) >= cfg.MemoryThreshold*float64(lim)
+	if pressure {
+		st := mx.VFS.Stats()
+		opts.MinIdle = 0
+		opts.MaxNodes = mgutil.Clamp(1, opts.MaxNodes, st.Nodes/2)
+		opts.MaxMemos = mgutil.Clamp(1, opts.MaxMemos, st.Memos/2)
+	}
+
+	before, after := mx.VFS.Trim(opts)
+	if pressure {
+		debug.FreeOSMemory()
+	}
+	if before == after {
+		return
+	}
+	mx.Log.Printf("VFS.Trim: heap=%s, limit=%s\n\tbefore: %s\n\tafter: %s\n",
+		hmnz.IBytes(ms.HeapAlloc), hmnz.IBytes(lim),
+		vfsTrimStats(before), vfsTrimStats(after),
+	)
+}
+
+func vfsTrimStats(st vfs.TrimStats) string {
+	return fmt.Sprintf("%s nodes (%s leaves), %s memos (%s sticky), %s blobs (%s)",
+		hmnz.Comma(int64(st.Nodes)), hmnz.Comma(int64(st.Leaves)),
+		hmnz.Comma(int64(st.Memos)), hmnz.Comma(int64(st.Sticky)),
+		hmnz.Comma(int64(st.Blobs)), hmnz.IBytes(uint64(st.BlobBytes)),
+	)
+}
 
 func (vc *vfsCmd) Reduce(mx *Ctx) *State {
 	v := mx.View
@@ -40,6 +196,14 @@ func (vc *vfsCmd) Reduce(mx *Ctx) *State {
 					return cx.State
 				},
 			},
+			BuiltinCmd{
+				Name: ".vfs-trim",
+				Desc: "Remove unused nodes and cached data from the VFS, and print its size before and after. Usage: .vfs-trim [-nodes=N] [-memos=N] [-idle=duration]",
+				Run: func(cx *CmdCtx) *State {
+					go vc.cmdVfsTrim(cx)
+					return cx.State
+				},
+			},
 		)
 	}
 	return mx.State
@@ -93,6 +257,103 @@ func (vc *vfsCmd) cmdVfsBlobs(cx *CmdCtx) {
 	)
 }
 
+func (vc *vfsCmd) cmdVfsTrim(cx *CmdCtx) {
+	defer cx.Output.Close()
+
+	opts := vc.config().opts()
+	fs := cx.Flags()
+	fs.IntVar(&opts.MaxNodes, "nodes", opts.MaxNodes, "The number of nodes to keep")
+	fs.IntVar(&opts.MaxMemos, "memos", opts.MaxMemos, "The number of cached values to keep")
+	fs.DurationVar(&opts.MinIdle, "idle", opts.MinIdle, "The time for which a node or value must be unused")
+	if err := fs.Parse(); err != nil {
+		fmt.Fprintln(cx.Output, ".vfs-trim:", err)
+		return
+	}
+
+	before, after := cx.VFS.Trim(opts)
+	fmt.Fprintf(cx.Output, "before: %s\nafter:  %s\n", vfsTrimStats(before), vfsTrimStats(after))
+}
+
+// VFSChanged is dispatched by VFSWatcher when files or directories change on disk.
+//
+// The corresponding VFS nodes are already invalidated,
+// it allows reducers to drop any other data they cached for those paths.
+type VFSChanged struct {
+	ActionType
+
+	// Paths is the list of files and directories that changed
+	Paths []string
+}
+
+// VFSWatcher watches the directories scanned by the VFS for changes made outside the editor
+// e.g. by `git checkout` or code generators, and invalidates the corresponding nodes.
+//
+// On Linux, inotify is used unless Poll is set, other platforms poll the directories.
+// The action VFSChanged is dispatched after each batch of changes.
+type VFSWatcher struct {
+	ReducerType
+
+	// Poll forces the directories to be polled for changes, instead of using inotify
+	Poll bool
+
+	// PollInterval is the time between polls. The default is 2s.
+	PollInterval time.Duration
+
+	// MaxDirs is the maximum number of directories to watch.
+	// The default is 4096, or 256 when polling.
+	MaxDirs int
+
+	w *vfs.Watcher
+	q *mgutil.ChanQ
+}
+
+func (vw *VFSWatcher) RMount(mx *Ctx) {
+	vw.w = mx.VFS.Watch(vfs.WatchOptions{
+		Poll:         vw.Poll,
+		PollInterval: vw.PollInterval,
+		MaxDirs:      vw.MaxDirs,
+		Changed: func(paths []string) {
+			mx.Store.Dispatch(VFSChanged{Paths: paths})
+		},
+	})
+	vw.q = mgutil.NewChanQLoop(1, func(v interface{}) {
+		if dir, _ := v.(string); dir != "" {
+			vw.w.Add(dir)
+		}
+		vw.w.Sync()
+	})
+}
+
+func (vw *VFSWatcher) RUnmount(mx *Ctx) {
+	vw.q.Close()
+	vw.w.Close()
+}
+
+func (vw *VFSWatcher) Reduce(mx *Ctx) *State {
+	switch mx.Action.(type) {
+	case ViewActivated, ViewSaved:
+		// new directories were probably scanned since the last sync
+		dir := ""
+		if mx.View.Path != "" {
+			dir = mx.View.Dir()
+		}
+		vw.q.Put(dir)
+	case RunCmd:
+		return mx.AddBuiltinCmds(BuiltinCmd{
+			Name: ".vfs-watch",
+			Desc: "Print the status of the VFS watcher",
+			Run: func(cx *CmdCtx) *State {
+				fmt.Fprintf(cx.Output, "VFSWatcher: mode: %s, watching %s directories\n",
+					vw.w.Mode(), hmnz.Comma(int64(vw.w.Len())),
+				)
+				cx.Output.Close()
+				return cx.State
+			},
+		})
+	}
+	return mx.State
+}
+
 func init() {
-	DefaultReducers.Before(&vfsCmd{})
+	DefaultReducers.Before(vfsCmdR)
 }
@@ -10,6 +10,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sync"
 	"unicode/utf8"
 )
 
@@ -30,6 +31,76 @@ type View struct {
 	kvs     KVStore
 }
 
+// ViewKey identifies a view across the clients of the agent.
+//
+// When the agent is a daemon (see Agent.Serve), its reducers are shared by all clients,
+// whose views might have the same name, so reducers should key per-view state by ViewKey instead of View.Name.
+type ViewKey struct {
+	Name string
+
+	client *Store
+}
+
+// ViewKey returns the key of the view mx.View
+func (mx *Ctx) ViewKey() ViewKey {
+	return ViewKey{Name: mx.View.Name, client: mx.Store}
+}
+
+// ViewIsDirty returns true if the client's view of the file path has unsaved changes.
+//
+// Clients only send the state of the active view, so a view is only known after it has been active.
+// A view that was closed without saving its changes is considered dirty until it's saved again,
+// unless the client reports it being closed.
+func (mx *Ctx) ViewIsDirty(path string) bool {
+	if v := mx.View; v != nil && v.Path != "" && filepath.Clean(v.Path) == filepath.Clean(path) && v.Dirty {
+		return true
+	}
+	if mx.Store == nil {
+		return false
+	}
+	return mx.Store.views.isDirty(path)
+}
+
+// viewRegistry records which of a client's views have unsaved changes, by path
+type viewRegistry struct {
+	mu    sync.Mutex
+	dirty map[string]bool
+}
+
+// observe records the state of v, as sent by the client
+func (vr *viewRegistry) observe(v *View) {
+	if v.Path == "" {
+		return
+	}
+	vr.mu.Lock()
+	defer vr.mu.Unlock()
+
+	fn := filepath.Clean(v.Path)
+	if !v.Dirty {
+		delete(vr.dirty, fn)
+		return
+	}
+	if vr.dirty == nil {
+		vr.dirty = map[string]bool{}
+	}
+	vr.dirty[fn] = true
+}
+
+// forget removes the view of the file path, after the client closed it
+func (vr *viewRegistry) forget(path string) {
+	vr.mu.Lock()
+	defer vr.mu.Unlock()
+
+	delete(vr.dirty, filepath.Clean(path))
+}
+
+func (vr *viewRegistry) isDirty(path string) bool {
+	vr.mu.Lock()
+	defer vr.mu.Unlock()
+
+	return vr.dirty[filepath.Clean(path)]
+}
+
 func newView(kvs KVStore) *View {
 	return &View{kvs: kvs}
 }
@@ -1,6 +1,7 @@
 package mg
 
 import (
+	"path/filepath"
 	"testing"
 )
 
@@ -18,3 +19,49 @@ func TestBytePos(t *testing.T) {
 		}
 	}
 }
+
+func TestViewIsDirty(t *testing.T) {
+	sto := NewTestingStore()
+	send := func(path string, dirty bool) {
+		rq := newAgentReq(sto)
+		v := rq.Props.View
+		v.Path = path
+		v.Name = filepath.Base(path)
+		v.Src = []byte("package p\n")
+		v.Dirty = dirty
+		mx := sto.NewCtx(nil)
+		defer mx.Cancel()
+		sto.handleReqInit(rq, mx)
+	}
+	isDirty := func(path string) bool {
+		mx := sto.NewCtx(nil)
+		defer mx.Cancel()
+		return mx.ViewIsDirty(path)
+	}
+
+	a := filepath.FromSlash("/p/a.go")
+	b := filepath.FromSlash("/p/b.go")
+	send(a, true)
+	send(b, false)
+	if !isDirty(a) {
+		t.Errorf("ViewIsDirty(%s) = false after it was modified", a)
+	}
+	if isDirty(b) {
+		t.Errorf("ViewIsDirty(%s) = true, but it wasn't modified", b)
+	}
+
+	send(a, false)
+	if isDirty(a) {
+		t.Errorf("ViewIsDirty(%s) = true after it was saved", a)
+	}
+
+	send(b, true)
+	sto.views.forget(b)
+	if isDirty(b) {
+		t.Errorf("ViewIsDirty(%s) = true after it was closed", b)
+	}
+
+	if NewTestingStore().NewCtx(nil).ViewIsDirty(a) {
+		t.Errorf("ViewIsDirty(%s) = true in another client's store", a)
+	}
+}
@@ -0,0 +1,359 @@
+package mg
+
+import (
+	"bytes"
+	"fmt"
+	"margo.sh/htm"
+	"margo.sh/mgpf"
+	"margo.sh/mgutil"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// watchdogWindow is how long overruns are remembered
+	// i.e. displayed in the HUD and counted towards WatchdogConfig.DisableAfter.
+	// It's also the minimum interval between the logged reports of a reducer's overruns.
+	watchdogWindow = time.Minute
+
+	// watchdogMaxStack is the maximum size of the goroutine dump from which the reduction's stack trace is taken
+	watchdogMaxStack = 16 << 20
+)
+
+// WatchdogConfig is the configuration of the watchdog that enforces the time budget of reducers.
+//
+// All reducers are run sequentially, so a slow reducer delays every reduction,
+// and might block the editor e.g. while it waits for the view to be fmt'ed.
+// When a reducer takes longer than its budget to handle an action,
+// the overrun is recorded in the profile of the reduction, displayed in the HUD
+// and logged, along with the stack trace of the reducer at the time its budget expired.
+// Overruns are logged at most once a minute per reducer.
+//
+// The watchdog is disabled by default: only reducers with a budget are watched.
+type WatchdogConfig struct {
+	// Budget is how long a reducer may take to handle an action, including its lifecycle methods e.g. RCond.
+	// If it's zero or negative, reducers without an entry in Budgets are not watched.
+	// Default: 0
+	Budget time.Duration
+
+	// Budgets overrides Budget for the reducers with the specified labels (see ReducerLabel)
+	// e.g. for reducers that are expected to be slow, like fmt'ers that run external commands.
+	// A zero or negative budget disables the watchdog for the reducer.
+	Budgets map[string]time.Duration
+
+	// DisableAfter, if greater than zero, is the number of overruns, within a minute,
+	// after which a reducer is disabled.
+	// A disabled reducer is skipped until it's re-enabled with the command `.reducer.enable`.
+	DisableAfter int
+}
+
+// budget returns the budget of the reducer labelled lbl, or zero if it's not watched
+func (wc WatchdogConfig) budget(lbl string) time.Duration {
+	d, ok := wc.Budgets[lbl]
+	if !ok {
+		d = wc.Budget
+	}
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+type watchdogReducer struct {
+	label    string
+	budget   time.Duration
+	overruns []time.Time
+	last     time.Duration
+	disabled bool
+	reported time.Time
+}
+
+// reducerWatchdog enforces the time budget of reducers.
+// It's also the reducer that displays their overruns, and implements the `.reducer.enable` command.
+type reducerWatchdog struct {
+	ReducerType
+
+	mu       sync.Mutex
+	cfg      WatchdogConfig
+	gid      []byte
+	reducers map[*ReducerType]*watchdogReducer
+}
+
+func newReducerWatchdog() *reducerWatchdog {
+	return &reducerWatchdog{reducers: map[*ReducerType]*watchdogReducer{}}
+}
+
+func (wd *reducerWatchdog) setConfig(cfg WatchdogConfig) {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+
+	wd.cfg = cfg
+}
+
+// setGoroutine records the current goroutine as the one in which reductions take place.
+func (wd *reducerWatchdog) setGoroutine() {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	if i := bytes.IndexByte(buf, '['); i > 0 {
+		buf = buf[:i]
+	}
+
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+
+	wd.gid = buf
+}
+
+// stack returns the stack trace of the goroutine in which reductions take place
+func (wd *reducerWatchdog) stack() []byte {
+	wd.mu.Lock()
+	gid := wd.gid
+	wd.mu.Unlock()
+
+	if len(gid) == 0 {
+		return nil
+	}
+	// there's no way to get the stack trace of another goroutine,
+	// so all of them are dumped, and all but the reduction's are discarded
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= watchdogMaxStack {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, len(buf)*2)
+	}
+	for _, s := range bytes.Split(buf, []byte("\n\n")) {
+		if bytes.HasPrefix(s, gid) {
+			return s
+		}
+	}
+	return nil
+}
+
+// disabled returns true if the reducer rt was disabled because it repeatedly exceeded its budget
+func (wd *reducerWatchdog) disabled(rt *ReducerType) bool {
+	if wd == nil {
+		return false
+	}
+
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+
+	wr := wd.reducers[rt]
+	return wr != nil && wr.disabled
+}
+
+// watch starts watching the reduction of r, labelled lbl.
+// The returned function must be called when the reduction completes.
+func (wd *reducerWatchdog) watch(mx *Ctx, r Reducer, lbl string) (stop func()) {
+	if wd == nil || mx.ActionIs(initAction{}, unmount{}) {
+		return func() {}
+	}
+
+	wd.mu.Lock()
+	budget := wd.cfg.budget(lbl)
+	wd.mu.Unlock()
+
+	if budget <= 0 {
+		return func() {}
+	}
+
+	start := time.Now()
+	reported := make(chan bool, 1)
+	tmr := time.AfterFunc(budget, func() {
+		report := wd.report(r, lbl)
+		if report {
+			mx.Log.Printf("watchdog: %s exceeded its budget of %s while handling %s:\n%s\n",
+				lbl, mgpf.D(budget), ActionLabel(mx.Action), wd.stack())
+		}
+		reported <- report
+	})
+	return func() {
+		dur := time.Since(start)
+		if tmr.Stop() {
+			return
+		}
+		mx.Profile.Sample("Overrun", dur-budget)
+		wd.overrun(mx, r, lbl, budget, dur, <-reported)
+	}
+}
+
+// reducer returns the state of the reducer r, creating it if necessary.
+// wd.mu must be held.
+func (wd *reducerWatchdog) reducer(r Reducer, lbl string) *watchdogReducer {
+	rt := r.reducerType()
+	wr := wd.reducers[rt]
+	if wr == nil {
+		wr = &watchdogReducer{}
+		wd.reducers[rt] = wr
+	}
+	wr.label = lbl
+	return wr
+}
+
+// report returns true if the overrun of the reducer r should be logged
+// i.e. its last overrun wasn't logged within watchdogWindow
+func (wd *reducerWatchdog) report(r Reducer, lbl string) bool {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+
+	wr := wd.reducer(r, lbl)
+	now := time.Now()
+	if !wr.reported.IsZero() && now.Sub(wr.reported) < watchdogWindow {
+		return false
+	}
+	wr.reported = now
+	return true
+}
+
+func (wd *reducerWatchdog) overrun(mx *Ctx, r Reducer, lbl string, budget, dur time.Duration, reported bool) {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+
+	wr := wd.reducer(r, lbl)
+	now := time.Now()
+	wr.budget = budget
+	wr.last = dur
+	wr.overruns = append(wr.overruns, now)
+	for len(wr.overruns) != 0 && now.Sub(wr.overruns[0]) > watchdogWindow {
+		wr.overruns = wr.overruns[1:]
+	}
+
+	if reported {
+		mx.Log.Printf("watchdog: %s took %s to handle %s\n", lbl, mgpf.D(dur), ActionLabel(mx.Action))
+	}
+	if n := wd.cfg.DisableAfter; n > 0 && len(wr.overruns) >= n && !wr.disabled && wd.canDisable(r) {
+		wr.disabled = true
+		mx.Log.Printf("watchdog: %s was disabled after %d overruns. Use the command `%s` to re-enable it\n",
+			lbl, len(wr.overruns), mgutil.QuoteCmd(".reducer.enable", lbl))
+	}
+}
+
+// canDisable returns false for the reducers that margo itself depends on
+// e.g. to run the command that re-enables reducers
+func (wd *reducerWatchdog) canDisable(r Reducer) bool {
+	switch r.(type) {
+	case *issueKeySupport, *builtins, *issueFixSupport, *issueStatusSupport,
+		*cmdSupport, *restartSupport, *clientActionSupport, *taskTracker, *reducerWatchdog:
+		return false
+	}
+	return true
+}
+
+// enable re-enables the disabled reducers with labels in labels, or all of them if labels is empty.
+// It returns the labels of the reducers that were re-enabled.
+func (wd *reducerWatchdog) enable(labels ...string) []string {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+
+	var enabled []string
+	for _, wr := range wd.reducers {
+		if !wr.disabled {
+			continue
+		}
+		if len(labels) != 0 && !StrSet(labels).Has(wr.label) {
+			continue
+		}
+		wr.disabled = false
+		wr.overruns = nil
+		enabled = append(enabled, wr.label)
+	}
+	sort.Strings(enabled)
+	return enabled
+}
+
+// list returns the reducers that are disabled, or overran their budget recently, sorted by label
+func (wd *reducerWatchdog) list() []watchdogReducer {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+
+	var l []watchdogReducer
+	now := time.Now()
+	for _, wr := range wd.reducers {
+		n := len(wr.overruns)
+		if wr.disabled || (n != 0 && now.Sub(wr.overruns[n-1]) <= watchdogWindow) {
+			l = append(l, *wr)
+		}
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].label < l[j].label })
+	return l
+}
+
+func (wd *reducerWatchdog) Reduce(mx *Ctx) *State {
+	st := mx.State
+	switch mx.Action.(type) {
+	case RunCmd:
+		st = st.AddBuiltinCmds(BuiltinCmd{
+			Name: ".reducer.enable",
+			Desc: "Re-enable the reducers disabled by the watchdog, or all of them if no reducer labels are specified",
+			Run:  wd.enableCmd,
+		})
+	case QueryUserCmds:
+		st = wd.userCmds(st)
+	}
+	return wd.hud(st)
+}
+
+func (wd *reducerWatchdog) enableCmd(cx *CmdCtx) *State {
+	defer cx.Output.Close()
+
+	l := wd.enable(cx.Args...)
+	if len(l) == 0 {
+		fmt.Fprintln(cx.Output, "No disabled reducers were re-enabled")
+		return cx.State
+	}
+	for _, lbl := range l {
+		fmt.Fprintln(cx.Output, "Re-enabled", lbl)
+	}
+	return cx.State
+}
+
+func (wd *reducerWatchdog) userCmds(st *State) *State {
+	var cl []UserCmd
+	for _, wr := range wd.list() {
+		if wr.disabled {
+			cl = append(cl, UserCmd{
+				Title: "Reducer: Enable " + wr.label,
+				Desc:  fmt.Sprintf("re-enable the reducer disabled after it exceeded its budget of %s", mgpf.D(wr.budget)),
+				Name:  ".reducer.enable",
+				Args:  []string{wr.label},
+			})
+		}
+	}
+	return st.AddUserCmds(cl...)
+}
+
+func (wd *reducerWatchdog) hud(st *State) *State {
+	l := wd.list()
+	if len(l) == 0 {
+		return st
+	}
+
+	els := make([]htm.Element, 0, len(l))
+	disabled := 0
+	for _, wr := range l {
+		s := fmt.Sprintf("%s: took %s, budget %s, %d overruns", wr.label, mgpf.D(wr.last), mgpf.D(wr.budget), len(wr.overruns))
+		if wr.disabled {
+			disabled++
+			s += " (disabled)"
+		}
+		els = append(els, htm.Text(s))
+	}
+	st = st.AddHUD(htm.Text("Reducer Watchdog"), els...)
+	if disabled != 0 {
+		st = st.AddStatus(fmt.Sprintf("Reducers disabled: %d", disabled))
+	}
+	return st
+}
+
+// watchdog returns the store's watchdog, or nil if mx has no store
+func (mx *Ctx) watchdog() *reducerWatchdog {
+	if mx.Store == nil || mx.Store.storeCore == nil {
+		return nil
+	}
+	return mx.Store.wdog
+}
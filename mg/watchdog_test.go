@@ -0,0 +1,97 @@
+package mg
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchdog(t *testing.T) {
+	calls := 0
+	ha, err := newHeadlessAgent(func(ma Args) {
+		ma.SetWatchdogConfig(WatchdogConfig{Budget: 10 * time.Millisecond, DisableAfter: 2})
+		ma.Use(NewReducer(func(mx *Ctx) *State {
+			if !mx.ActionIs(QueryUserCmds{}) {
+				return mx.State
+			}
+			calls++
+			time.Sleep(30 * time.Millisecond)
+			return mx.AddStatus("slow")
+		}, func(rf *RFunc) { rf.Label = "slow" }))
+	}, nil, nil, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ha.close()
+
+	query := func() *State {
+		t.Helper()
+		mx, err := ha.request(func(*View) {}, "QueryUserCmds")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return mx.State
+	}
+
+	for i := 0; i < 3; i++ {
+		query()
+	}
+	if calls != 2 {
+		t.Fatalf("the reducer was called %d times, want it to be disabled after 2 overruns", calls)
+	}
+
+	st := query()
+	if hud := strings.Join(st.HUD.Articles, "\n"); !strings.Contains(hud, "slow: took") || !strings.Contains(hud, "(disabled)") {
+		t.Errorf("the HUD doesn't list the disabled reducer:\n%s", hud)
+	}
+	if !StrSet(st.Status).Has("Reducers disabled: 1") {
+		t.Errorf("the status %q doesn't report the disabled reducer", st.Status)
+	}
+	found := false
+	for _, c := range st.UserCmds {
+		found = found || (c.Name == ".reducer.enable" && len(c.Args) == 1 && c.Args[0] == "slow")
+	}
+	if !found {
+		t.Errorf("there's no UserCmd to re-enable the reducer: %v", st.UserCmds)
+	}
+
+	if l := ha.ag.Store.wdog.enable("slow"); len(l) != 1 || l[0] != "slow" {
+		t.Fatalf("enable(slow) = %q, want [slow]", l)
+	}
+	if st := query(); calls != 3 || !StrSet(st.Status).Has("slow") {
+		t.Errorf("the reducer wasn't re-enabled: it was called %d times, status %q", calls, st.Status)
+	}
+}
+
+func TestWatchdogBudget(t *testing.T) {
+	cases := []struct {
+		cfg  WatchdogConfig
+		want time.Duration
+	}{
+		{WatchdogConfig{}, 0},
+		{WatchdogConfig{Budget: time.Second}, time.Second},
+		{WatchdogConfig{Budget: -1}, 0},
+		{WatchdogConfig{Budgets: map[string]time.Duration{"r": time.Second}}, time.Second},
+		{WatchdogConfig{Budget: time.Second, Budgets: map[string]time.Duration{"r": -1}}, 0},
+	}
+	for _, c := range cases {
+		if d := c.cfg.budget("r"); d != c.want {
+			t.Errorf("%+v.budget(r) = %s, want %s", c.cfg, d, c.want)
+		}
+	}
+}
+
+func TestWatchdogReportRateLimit(t *testing.T) {
+	wd := newReducerWatchdog()
+	r := NewReducer(func(mx *Ctx) *State { return mx.State })
+	if !wd.report(r, "r") {
+		t.Fatalf("the first overrun was not reported")
+	}
+	if wd.report(r, "r") {
+		t.Errorf("the second overrun within %s was reported", watchdogWindow)
+	}
+	wd.reducers[r.reducerType()].reported = time.Now().Add(-watchdogWindow)
+	if !wd.report(r, "r") {
+		t.Errorf("an overrun more than %s after the last report was not reported", watchdogWindow)
+	}
+}
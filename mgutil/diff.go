@@ -0,0 +1,195 @@
+package mgutil
+
+import (
+	"bytes"
+	"fmt"
+)
+
+const (
+	// diffContext is the number of unchanged lines shown around each change
+	diffContext = 3
+)
+
+type diffOp struct {
+	kind byte
+	line []byte
+}
+
+// UnifiedDiff returns the unified diff between a and b, or nil if they're the same.
+// aName and bName are the names of the files shown in the diff header.
+func UnifiedDiff(aName, bName string, a, b []byte) []byte {
+	if bytes.Equal(a, b) {
+		return nil
+	}
+
+	ops := diffLines(splitLines(a), splitLines(b))
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "--- %s\n+++ %s\n", aName, bName)
+
+	// ai and bi are the line indexes into a and b, at the start of ops[i]
+	ai, bi := make([]int, len(ops)+1), make([]int, len(ops)+1)
+	for i, op := range ops {
+		ai[i+1], bi[i+1] = ai[i], bi[i]
+		if op.kind != '+' {
+			ai[i+1]++
+		}
+		if op.kind != '-' {
+			bi[i+1]++
+		}
+	}
+
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < len(ops); j++ {
+			if ops[j].kind != ' ' {
+				end = j + 1
+				continue
+			}
+			if j-end >= 2*diffContext {
+				break
+			}
+		}
+		stop := end + diffContext
+		if stop > len(ops) {
+			stop = len(ops)
+		}
+
+		fmt.Fprintf(buf, "@@ -%s +%s @@\n",
+			diffRange(ai[start], ai[stop]-ai[start]),
+			diffRange(bi[start], bi[stop]-bi[start]),
+		)
+		for _, op := range ops[start:stop] {
+			buf.WriteByte(op.kind)
+			buf.Write(op.line)
+			if len(op.line) == 0 || op.line[len(op.line)-1] != '\n' {
+				buf.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = stop
+	}
+	return buf.Bytes()
+}
+
+func diffRange(start, n int) string {
+	switch n {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	default:
+		return fmt.Sprintf("%d,%d", start+1, n)
+	}
+}
+
+// splitLines splits s into lines, retaining the trailing newline
+func splitLines(s []byte) [][]byte {
+	l := [][]byte{}
+	for len(s) != 0 {
+		i := bytes.IndexByte(s, '\n') + 1
+		if i == 0 {
+			i = len(s)
+		}
+		l = append(l, s[:i])
+		s = s[i:]
+	}
+	return l
+}
+
+// diffLines returns the edit script transforming a into b, using Myers' diff algorithm
+func diffLines(a, b [][]byte) []diffOp {
+	// common prefixes and suffixes are trimmed because the algorithm's memory usage
+	// is proportional to the number of lines and edits
+	pfx := 0
+	for pfx < len(a) && pfx < len(b) && bytes.Equal(a[pfx], b[pfx]) {
+		pfx++
+	}
+	sfx := 0
+	for sfx < len(a)-pfx && sfx < len(b)-pfx && bytes.Equal(a[len(a)-1-sfx], b[len(b)-1-sfx]) {
+		sfx++
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, s := range a[:pfx] {
+		ops = append(ops, diffOp{' ', s})
+	}
+	ops = append(ops, myersDiff(a[pfx:len(a)-sfx], b[pfx:len(b)-sfx])...)
+	for _, s := range a[len(a)-sfx:] {
+		ops = append(ops, diffOp{' ', s})
+	}
+	return ops
+}
+
+func myersDiff(a, b [][]byte) []diffOp {
+	n, m := len(a), len(b)
+	max := n + m
+	off := max + 1
+	v := make([]int, 2*max+2)
+	trace := [][]int{}
+
+search:
+	for d := 0; d <= max; d++ {
+		for k := -d; k <= d; k += 2 {
+			x := 0
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && bytes.Equal(a[x], b[y]) {
+				x++
+				y++
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				trace = append(trace, append([]int(nil), v...))
+				break search
+			}
+		}
+		trace = append(trace, append([]int(nil), v...))
+	}
+
+	ops := []diffOp{}
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d-1]
+		k := x - y
+		pk := k - 1
+		if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+			pk = k + 1
+		}
+		px := v[off+pk]
+		py := px - pk
+		for x > px && y > py {
+			ops = append(ops, diffOp{' ', a[x-1]})
+			x--
+			y--
+		}
+		if x == px {
+			ops = append(ops, diffOp{'+', b[y-1]})
+			y--
+		} else {
+			ops = append(ops, diffOp{'-', a[x-1]})
+			x--
+		}
+	}
+	for x > 0 && y > 0 {
+		ops = append(ops, diffOp{' ', a[x-1]})
+		x--
+		y--
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
@@ -41,7 +41,11 @@ type meta struct {
 	fmode fmode
 	modts timestamp
 	expts timestamp
+	atime timestamp
 	mo    *memo.M
+
+	// listed is true if the node is a directory whose entries were read
+	listed bool
 }
 
 func (mt *meta) memo(poke bool) *memo.M {
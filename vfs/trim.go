@@ -0,0 +1,209 @@
+package vfs
+
+import (
+	"margo.sh/memo"
+	"sort"
+	"time"
+)
+
+// TrimOptions configures FS.Trim
+type TrimOptions struct {
+	// MaxNodes is the number of nodes to keep.
+	// If it's <= 0, no nodes are removed.
+	MaxNodes int
+
+	// MaxMemos is the number of memoized values to keep.
+	// If it's <= 0, no memoized values are removed.
+	MaxMemos int
+
+	// MinIdle is the time for which a node or memoized value must not have been used
+	// before it can be removed.
+	MinIdle time.Duration
+}
+
+// TrimStats reports the size of the tree
+type TrimStats struct {
+	// Nodes is the number of nodes in the tree
+	Nodes int
+
+	// Leaves is the number of nodes without children
+	Leaves int
+
+	// Memos is the number of memoized values
+	Memos int
+
+	// Sticky is the number of memoized values that implement memo.Sticky
+	Sticky int
+
+	// Blobs is the number of blobs (file contents) cached
+	Blobs int
+
+	// BlobBytes is the total size of the cached blobs
+	BlobBytes int64
+}
+
+type trimMemo struct {
+	mo *memo.M
+	k  memo.K
+	at int64
+}
+
+type trimLeaf struct {
+	nd *Node
+	at timestamp
+}
+
+// Stats walks the tree and reports its size
+func (fs *FS) Stats() TrimStats {
+	st, _, _ := fs.trimWalk()
+	return st
+}
+
+// Trim reduces the size of the tree by removing the least-recently-used memoized values
+// and leaf nodes, until the limits in opts are satisfied.
+//
+// Memoized values implementing memo.Sticky are never removed,
+// and neither are nodes that still have memoized values, or view nodes.
+// A directory whose entries were removed is re-listed the next time it's used.
+//
+// It returns the size of the tree before and after it was trimmed.
+func (fs *FS) Trim(opts TrimOptions) (before, after TrimStats) {
+	before, memos, _ := fs.trimWalk()
+	now := time.Now().Add(-opts.MinIdle)
+
+	if n := before.Memos - opts.MaxMemos; opts.MaxMemos > 0 && n > 0 {
+		fs.trimMemos(memos, now.UnixNano(), n)
+	}
+
+	after, _, leaves := fs.trimWalk()
+	if n := after.Nodes - opts.MaxNodes; opts.MaxNodes > 0 && n > 0 {
+		fs.trimLeaves(leaves, tsTime(now), n)
+		after, _, _ = fs.trimWalk()
+	}
+	return before, after
+}
+
+func (fs *FS) trimMemos(memos []trimMemo, usedBefore int64, n int) {
+	sort.Slice(memos, func(i, j int) bool { return memos[i].at < memos[j].at })
+	for _, m := range memos {
+		if n <= 0 || m.at >= usedBefore {
+			return
+		}
+		if m.mo.Evict(m.k, usedBefore) {
+			n--
+		}
+	}
+}
+
+func (fs *FS) trimLeaves(leaves []trimLeaf, cutoff timestamp, n int) {
+	// leaves are removed a directory at a time, to avoid re-listing it for each leaf
+	type dir struct {
+		nd *Node
+		at timestamp
+		l  []*Node
+	}
+	dirs := map[*Node]*dir{}
+	for _, lf := range leaves {
+		if lf.at > cutoff {
+			continue
+		}
+		p := lf.nd.parent
+		d := dirs[p]
+		if d == nil {
+			d = &dir{nd: p}
+			dirs[p] = d
+		}
+		if lf.at > d.at {
+			d.at = lf.at
+		}
+		d.l = append(d.l, lf.nd)
+	}
+	lru := make([]*dir, 0, len(dirs))
+	for _, d := range dirs {
+		lru = append(lru, d)
+	}
+	sort.Slice(lru, func(i, j int) bool { return lru[i].at < lru[j].at })
+	for _, d := range lru {
+		if n <= 0 {
+			return
+		}
+		n -= d.nd.removeLeaves(d.l, cutoff)
+	}
+}
+
+// removeLeaves removes the children in l that are still leaves, and weren't used after cutoff
+func (nd *Node) removeLeaves(l []*Node, cutoff timestamp) int {
+	nd.mu.Lock()
+	defer nd.mu.Unlock()
+
+	rm := make(map[*Node]bool, len(l))
+	for _, c := range l {
+		if c.trimmable(cutoff) {
+			rm[c] = true
+		}
+	}
+	if len(rm) == 0 {
+		return 0
+	}
+	nd.setCl(nd.cl().Filter(func(c *Node) bool { return !rm[c] }))
+	if mt := nd.meta(false); mt != nil && mt.listed {
+		mt.listed = false
+		mt.expts = 0
+	}
+	return len(rm)
+}
+
+func (nd *Node) trimmable(cutoff timestamp) bool {
+	nd.mu.Lock()
+	defer nd.mu.Unlock()
+
+	if nd.cl().Len() != 0 {
+		return false
+	}
+	mt := nd.meta(false)
+	return mt == nil || (mt.atime <= cutoff && mt.mo.Len() == 0)
+}
+
+func (fs *FS) trimWalk() (st TrimStats, memos []trimMemo, leaves []trimLeaf) {
+	var walk func(nd *Node)
+	walk = func(nd *Node) {
+		st.Nodes++
+
+		nd.mu.Lock()
+		mt := nd.meta(false)
+		at, mo := timestamp(0), mt.memo(false)
+		if mt != nil {
+			at = mt.atime
+		}
+		nd.mu.Unlock()
+
+		sticky := false
+		for _, e := range mo.Entries() {
+			st.Memos++
+			if _, ok := e.V.(memo.Sticky); ok {
+				st.Sticky++
+				sticky = true
+				continue
+			}
+			if b, ok := e.V.(*Blob); ok {
+				st.Blobs++
+				st.BlobBytes += int64(b.Len())
+			}
+			memos = append(memos, trimMemo{mo: mo, k: e.K, at: e.Used})
+		}
+
+		cl := nd.Children().Nodes()
+		if len(cl) == 0 {
+			st.Leaves++
+			view := nd.parent.IsRoot() && IsViewPath(nd.name)
+			if !sticky && !view && !nd.IsRoot() {
+				leaves = append(leaves, trimLeaf{nd: nd, at: at})
+			}
+		}
+		for _, c := range cl {
+			walk(c)
+		}
+	}
+	walk(&fs.Node)
+	return st, memos, leaves
+}
@@ -0,0 +1,58 @@
+package vfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type stickyTestValue struct{}
+
+func (stickyTestValue) InvalidateMemo(int64) {}
+
+func TestTrim(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vfs-trim-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	names := []string{"a.go", "b.go", "c.go", "d.go"}
+	for _, nm := range names {
+		if err := ioutil.WriteFile(filepath.Join(dir, nm), []byte(nm), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fs := New()
+	for _, nm := range names {
+		fs.ReadBlob(filepath.Join(dir, nm))
+	}
+	fs.ReadMemo(filepath.Join(dir, "a.go"), "sticky", func() interface{} { return stickyTestValue{} })
+
+	st := fs.Stats()
+	if st.Blobs != len(names) || st.Sticky != 1 || st.Memos != len(names)+1 {
+		t.Fatalf("Stats() = %+v, expected %d blobs and 1 sticky value", st, len(names))
+	}
+
+	before, after := fs.Trim(TrimOptions{MaxMemos: 1})
+	if before.Memos != st.Memos {
+		t.Fatalf("Trim() before = %+v, expected %+v", before, st)
+	}
+	if after.Memos != 1 || after.Sticky != 1 {
+		t.Fatalf("Trim() after = %+v, expected only the sticky value to remain", after)
+	}
+
+	_, after = fs.Trim(TrimOptions{MaxNodes: 1})
+	if nd := fs.Peek(filepath.Join(dir, "b.go")); nd != nil {
+		t.Fatalf("Trim() didn't remove unused leaf %s, after = %+v", nd.Path(), after)
+	}
+	if nd := fs.Peek(filepath.Join(dir, "a.go")); nd == nil {
+		t.Fatal("Trim() removed a leaf with a sticky value")
+	}
+
+	if n := fs.Poke(dir).Ls().Len(); n != len(names) {
+		t.Fatalf("Ls() after Trim() returned %d entries, expected %d", n, len(names))
+	}
+}
@@ -49,8 +49,6 @@ func IsViewPath(fn string) bool {
 	return strings.HasPrefix(fn, ViewNamePrefix)
 }
 
-// TODO: add .Trim() support to allow periodically removing unused leaf nodes to reduce memory.
-
 type ScanOptions struct {
 	Filter   func(de *Dirent) bool
 	Dirs     func(nd *Node)
@@ -194,6 +192,7 @@ func (nd *Node) scanEnts(so *ScanOptions, dl []*godirwalk.Dirent) (dirs []*Node)
 		cl = append(cl, c)
 	}
 	nd.setCl(&NodeList{l: cl})
+	nd.meta(true).listed = true
 	return dirs
 }
 
@@ -424,7 +423,9 @@ func (nd *Node) Memo() (*memo.M, error) {
 	defer nd.mu.Unlock()
 
 	if nd.parent.IsRoot() && IsViewPath(nd.name) {
-		return nd.meta(true).memo(true), nil
+		mt := nd.meta(true)
+		mt.atime = tsNow()
+		return mt.memo(true), nil
 	}
 
 	mt, err := nd.sync()
@@ -479,6 +480,7 @@ func (nd *Node) Stat() (os.FileInfo, error) {
 
 func (nd *Node) sync() (*meta, error) {
 	mt := nd.meta(true)
+	mt.atime = tsNow()
 	if mt.ok() {
 		return mt, nil
 	}
@@ -505,7 +507,8 @@ func (nd *Node) sync() (*meta, error) {
 		return nil, err
 	}
 	mt.resetInfo(fi.Mode(), fi.ModTime())
-	if reset && fi.IsDir() {
+	// the dir is also re-listed if some of its entries were removed by Trim
+	if (reset || !mt.listed) && fi.IsDir() {
 		so := &ScanOptions{MaxDepth: 1}
 		nd.scanEnts(so, nd.readDirents(path, so))
 	}
@@ -0,0 +1,230 @@
+package vfs
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrWatchLimit is returned by Watcher.Add when the maximum number of directories are being watched
+	ErrWatchLimit = errors.New("vfs: watch limit reached")
+)
+
+// WatchOptions configures a Watcher
+type WatchOptions struct {
+	// Changed is called with the list of files and directories that changed.
+	// Changes are batched, so it's called at most once every Latency.
+	Changed func(paths []string)
+
+	// Latency is the time to wait for more changes before calling Changed.
+	// The default is 100ms.
+	Latency time.Duration
+
+	// Poll forces the use of the polling watcher even if the platform supports notifications
+	Poll bool
+
+	// PollInterval is the time between polls of the watched directories.
+	// The default is 2s.
+	PollInterval time.Duration
+
+	// MaxDirs is the maximum number of directories to watch.
+	// The default is 4096, or 256 when polling.
+	MaxDirs int
+}
+
+// watcherImpl is the interface implemented by platform watchers
+type watcherImpl interface {
+	add(dir string) error
+	close() error
+}
+
+// Watcher watches directories for changes and invalidates the corresponding nodes in the FS.
+type Watcher struct {
+	fs   *FS
+	opts WatchOptions
+	impl watcherImpl
+	mode string
+
+	mu      sync.Mutex
+	dirs    map[string]bool
+	pending map[string]bool
+	timer   *time.Timer
+	closed  bool
+}
+
+// Watch returns a new Watcher for fs.
+//
+// No directories are watched until Add or Sync is called.
+// If the platform doesn't support notifications, the polling watcher is used.
+func (fs *FS) Watch(opts WatchOptions) *Watcher {
+	if opts.Latency <= 0 {
+		opts.Latency = 100 * time.Millisecond
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 2 * time.Second
+	}
+	w := &Watcher{
+		fs:      fs,
+		opts:    opts,
+		dirs:    map[string]bool{},
+		pending: map[string]bool{},
+	}
+	if !opts.Poll {
+		impl, err := newPlatformWatcher(w)
+		if err == nil {
+			w.impl, w.mode = impl, "notify"
+		}
+	}
+	if w.impl == nil {
+		w.impl, w.mode = newPollWatcher(w), "poll"
+	}
+	if w.opts.MaxDirs <= 0 {
+		w.opts.MaxDirs = 4096
+		if w.mode == "poll" {
+			w.opts.MaxDirs = 256
+		}
+	}
+	return w
+}
+
+// Mode returns the name of the watcher implementation: `notify` or `poll`
+func (w *Watcher) Mode() string {
+	return w.mode
+}
+
+// Len returns the number of directories being watched
+func (w *Watcher) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return len(w.dirs)
+}
+
+// Add starts watching the directories dirs.
+// Directories that are already being watched are ignored.
+func (w *Watcher) Add(dirs ...string) error {
+	for _, dir := range dirs {
+		if err := w.add(filepath.Clean(dir)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Watcher) add(dir string) error {
+	w.mu.Lock()
+	switch {
+	case w.closed:
+		w.mu.Unlock()
+		return errors.New("vfs: watcher is closed")
+	case w.dirs[dir]:
+		w.mu.Unlock()
+		return nil
+	case len(w.dirs) >= w.opts.MaxDirs:
+		w.mu.Unlock()
+		return ErrWatchLimit
+	}
+	w.dirs[dir] = true
+	w.mu.Unlock()
+
+	if err := w.impl.add(dir); err != nil {
+		w.mu.Lock()
+		delete(w.dirs, dir)
+		w.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Sync starts watching the directories in the FS whose entries have been read e.g. by Scan.
+// It stops when the watch limit is reached.
+func (w *Watcher) Sync() {
+	dirs := []string{}
+	w.fs.Branches(func(nd *Node) {
+		nd.mu.Lock()
+		mt := nd.meta(false)
+		ok := mt != nil && mt.listed
+		nd.mu.Unlock()
+		if ok {
+			dirs = append(dirs, nd.Path())
+		}
+	})
+	for _, dir := range dirs {
+		if err := w.Add(dir); err == ErrWatchLimit {
+			return
+		}
+	}
+}
+
+// Close stops watching all directories
+func (w *Watcher) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.mu.Unlock()
+
+	return w.impl.close()
+}
+
+// changed is called by the implementation when path, in the watched directory dir, changed.
+// If path is the dir itself, the directory was removed, or its contents are unknown.
+func (w *Watcher) changed(dir, path string, isDir bool) {
+	w.fs.Peek(path).Invalidate()
+	if path != dir {
+		w.fs.Peek(dir).Invalidate()
+	} else {
+		for _, c := range w.fs.Peek(dir).Children().Nodes() {
+			c.Invalidate()
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return
+	}
+	w.pending[path] = true
+	if w.timer == nil {
+		w.timer = time.AfterFunc(w.opts.Latency, w.flush)
+	}
+	if isDir && path != dir && w.dirs[dir] && !w.dirs[path] && len(w.dirs) < w.opts.MaxDirs {
+		// watch new sub-directories of watched directories
+		go w.add(path)
+	}
+}
+
+// forget is called by the implementation when dir is no longer being watched
+func (w *Watcher) forget(dir string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	delete(w.dirs, dir)
+}
+
+func (w *Watcher) flush() {
+	w.mu.Lock()
+	paths := make([]string, 0, len(w.pending))
+	for p := range w.pending {
+		paths = append(paths, p)
+	}
+	w.pending = map[string]bool{}
+	w.timer = nil
+	closed := w.closed
+	w.mu.Unlock()
+
+	if closed || len(paths) == 0 || w.opts.Changed == nil {
+		return
+	}
+	sort.Strings(paths)
+	w.opts.Changed(paths)
+}
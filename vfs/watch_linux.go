@@ -0,0 +1,123 @@
+package vfs
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	inotifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY | syscall.IN_ATTRIB |
+		syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF |
+		syscall.IN_ONLYDIR
+)
+
+// inotifyWatcher watches directories using inotify(7)
+type inotifyWatcher struct {
+	w  *Watcher
+	fd int
+	f  *os.File
+
+	mu   sync.Mutex
+	wds  map[int]string
+	dirs map[string]int
+}
+
+func newPlatformWatcher(w *Watcher) (watcherImpl, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	iw := &inotifyWatcher{
+		w:    w,
+		fd:   fd,
+		f:    os.NewFile(uintptr(fd), "inotify"),
+		wds:  map[int]string{},
+		dirs: map[string]int{},
+	}
+	go iw.loop()
+	return iw, nil
+}
+
+func (iw *inotifyWatcher) add(dir string) error {
+	wd, err := syscall.InotifyAddWatch(iw.fd, dir, inotifyMask)
+	if err != nil {
+		return &os.PathError{Op: "inotify_add_watch", Path: dir, Err: err}
+	}
+
+	iw.mu.Lock()
+	defer iw.mu.Unlock()
+
+	iw.wds[wd] = dir
+	iw.dirs[dir] = wd
+	return nil
+}
+
+func (iw *inotifyWatcher) close() error {
+	// closing the file unblocks the Read in loop()
+	return iw.f.Close()
+}
+
+func (iw *inotifyWatcher) loop() {
+	buf := make([]byte, 64<<10)
+	for {
+		n, err := iw.f.Read(buf)
+		if err != nil {
+			return
+		}
+		iw.events(buf[:n])
+	}
+}
+
+func (iw *inotifyWatcher) events(buf []byte) {
+	for len(buf) >= syscall.SizeofInotifyEvent {
+		ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[0]))
+		end := syscall.SizeofInotifyEvent + int(ev.Len)
+		if end > len(buf) {
+			return
+		}
+		name := string(bytes.TrimRight(buf[syscall.SizeofInotifyEvent:end], "\x00"))
+		buf = buf[end:]
+
+		if ev.Mask&syscall.IN_Q_OVERFLOW != 0 {
+			iw.overflow()
+			continue
+		}
+
+		iw.mu.Lock()
+		dir, ok := iw.wds[int(ev.Wd)]
+		if ok && ev.Mask&syscall.IN_IGNORED != 0 {
+			delete(iw.wds, int(ev.Wd))
+			delete(iw.dirs, dir)
+		}
+		iw.mu.Unlock()
+
+		switch {
+		case !ok:
+		case ev.Mask&syscall.IN_IGNORED != 0:
+			iw.w.forget(dir)
+		case name == "":
+			// the event is for the directory itself e.g. it was deleted
+			iw.w.changed(dir, dir, true)
+		default:
+			iw.w.changed(dir, filepath.Join(dir, name), ev.Mask&syscall.IN_ISDIR != 0)
+		}
+	}
+}
+
+// overflow is called when events were lost, so all directories are reported as changed
+func (iw *inotifyWatcher) overflow() {
+	iw.mu.Lock()
+	dirs := make([]string, 0, len(iw.dirs))
+	for dir := range iw.dirs {
+		dirs = append(dirs, dir)
+	}
+	iw.mu.Unlock()
+
+	for _, dir := range dirs {
+		iw.w.changed(dir, dir, true)
+	}
+}
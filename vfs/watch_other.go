@@ -0,0 +1,11 @@
+// +build !linux
+
+package vfs
+
+import (
+	"errors"
+)
+
+func newPlatformWatcher(w *Watcher) (watcherImpl, error) {
+	return nil, errors.New("vfs: notifications are not supported on this platform")
+}
@@ -0,0 +1,134 @@
+package vfs
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// pollEnt is the state of a directory entry at the time of the last poll
+type pollEnt struct {
+	mode  os.FileMode
+	mtime time.Time
+	size  int64
+}
+
+// pollWatcher watches directories by periodically comparing their contents
+type pollWatcher struct {
+	w    *Watcher
+	done chan struct{}
+
+	mu   sync.Mutex
+	dirs map[string]map[string]pollEnt
+}
+
+func newPollWatcher(w *Watcher) *pollWatcher {
+	pw := &pollWatcher{
+		w:    w,
+		done: make(chan struct{}),
+		dirs: map[string]map[string]pollEnt{},
+	}
+	go pw.loop()
+	return pw
+}
+
+func (pw *pollWatcher) add(dir string) error {
+	ents, err := pollDir(dir)
+	if err != nil {
+		return err
+	}
+
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	pw.dirs[dir] = ents
+	return nil
+}
+
+func (pw *pollWatcher) close() error {
+	close(pw.done)
+	return nil
+}
+
+func (pw *pollWatcher) loop() {
+	tick := time.NewTicker(pw.w.opts.PollInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-pw.done:
+			return
+		case <-tick.C:
+			pw.poll()
+		}
+	}
+}
+
+func (pw *pollWatcher) poll() {
+	pw.mu.Lock()
+	dirs := make([]string, 0, len(pw.dirs))
+	for dir := range pw.dirs {
+		dirs = append(dirs, dir)
+	}
+	pw.mu.Unlock()
+
+	for _, dir := range dirs {
+		ents, err := pollDir(dir)
+
+		pw.mu.Lock()
+		prev, ok := pw.dirs[dir]
+		if ok && err != nil {
+			delete(pw.dirs, dir)
+		} else if ok {
+			pw.dirs[dir] = ents
+		}
+		pw.mu.Unlock()
+
+		switch {
+		case !ok:
+			// it was removed while we were polling
+		case err != nil:
+			pw.w.forget(dir)
+			pw.w.changed(dir, dir, true)
+		default:
+			pw.diff(dir, prev, ents)
+		}
+	}
+}
+
+// diff reports the differences between the entries prev and next of the directory dir
+func (pw *pollWatcher) diff(dir string, prev, next map[string]pollEnt) {
+	for name, p := range prev {
+		if n, ok := next[name]; !ok || n != p {
+			pw.w.changed(dir, filepath.Join(dir, name), p.mode.IsDir())
+		}
+	}
+	for name, n := range next {
+		if _, ok := prev[name]; !ok {
+			pw.w.changed(dir, filepath.Join(dir, name), n.mode.IsDir())
+		}
+	}
+}
+
+func pollDir(dir string) (map[string]pollEnt, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	l, err := f.Readdir(-1)
+	if err != nil {
+		return nil, err
+	}
+	ents := make(map[string]pollEnt, len(l))
+	for _, fi := range l {
+		ents[fi.Name()] = pollEnt{
+			mode:  fi.Mode(),
+			mtime: fi.ModTime(),
+			size:  fi.Size(),
+		}
+	}
+	return ents, nil
+}
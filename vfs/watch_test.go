@@ -0,0 +1,59 @@
+package vfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	for _, poll := range []bool{false, true} {
+		dir, err := ioutil.TempDir("", "vfs-watch-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		fn := filepath.Join(dir, "a.go")
+		if err := ioutil.WriteFile(fn, []byte("a"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		fs := New()
+		fs.Scan(dir, ScanOptions{})
+		if s, _ := fs.ReadBlob(fn).ReadFile(); string(s) != "a" {
+			t.Fatalf("ReadFile returned %q, expected %q", s, "a")
+		}
+
+		changed := make(chan []string, 10)
+		w := fs.Watch(WatchOptions{
+			Poll:         poll,
+			PollInterval: 50 * time.Millisecond,
+			Latency:      10 * time.Millisecond,
+			Changed:      func(paths []string) { changed <- paths },
+		})
+		defer w.Close()
+		w.Sync()
+		if w.Len() == 0 {
+			t.Fatalf("%s: Sync didn't add the scanned directory", w.Mode())
+		}
+
+		// make sure the modification time changes when polling
+		time.Sleep(10 * time.Millisecond)
+		if err := ioutil.WriteFile(fn, []byte("bb"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case paths := <-changed:
+			if len(paths) != 1 || paths[0] != fn {
+				t.Errorf("%s: expected changes to %q, got %q", w.Mode(), fn, paths)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: no changes reported", w.Mode())
+		}
+		if s, _ := fs.ReadBlob(fn).ReadFile(); string(s) != "bb" {
+			t.Errorf("%s: ReadFile returned %q after the change, expected %q", w.Mode(), s, "bb")
+		}
+	}
+}